@@ -0,0 +1,144 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package audit
+
+import (
+	"fmt"
+
+	"go.bytebuilders.dev/aceshifter/pkg/tracker"
+
+	core "k8s.io/api/core/v1"
+)
+
+const (
+	// KeySCC is set by OpenShift on pods to the SCC that admitted them.
+	KeySCC = "openshift.io/scc"
+
+	LabelInstance = "app.kubernetes.io/instance"
+	// UnknownFeature groups pods that do not carry the LabelInstance label.
+	UnknownFeature = "-"
+)
+
+type Reason string
+
+const (
+	ReasonUidOutOfRange   Reason = "UidOutOfRange"
+	ReasonGroupOutOfRange Reason = "GroupOutOfRange"
+	ReasonPrivilegedSCC   Reason = "PrivilegedSCC"
+)
+
+// PrivilegedSCCs are the SCCs that let pods bypass the namespace uid range.
+var PrivilegedSCCs = map[string]bool{
+	"anyuid":           true,
+	"privileged":       true,
+	"hostaccess":       true,
+	"hostmount-anyuid": true,
+}
+
+type Violation struct {
+	Pod       string `json:"pod"`
+	Container string `json:"container,omitempty"`
+	Reason    Reason `json:"reason"`
+	Message   string `json:"message"`
+}
+
+// Report is the audit result of the pods of one feature in a namespace.
+type Report struct {
+	Namespace  string      `json:"namespace"`
+	Range      string      `json:"range"`
+	Pods       int         `json:"pods"`
+	Violations []Violation `json:"violations,omitempty"`
+}
+
+// FeatureOf returns the feature (Helm release) a pod belongs to.
+func FeatureOf(pod *core.Pod) string {
+	if v, ok := pod.Labels[LabelInstance]; ok && v != "" {
+		return v
+	}
+	return UnknownFeature
+}
+
+// Pods audits the effective security context of pods against the ranges of
+// their namespace, and reports pods admitted by a privileged SCC. Reports are
+// keyed by feature.
+func Pods(pods []core.Pod, ranges tracker.Ranges) map[string]*Report {
+	reports := map[string]*Report{}
+	for i := range pods {
+		pod := &pods[i]
+		if pod.Status.Phase == core.PodSucceeded || pod.Status.Phase == core.PodFailed {
+			continue
+		}
+		feature := FeatureOf(pod)
+		rep, ok := reports[feature]
+		if !ok {
+			rep = &Report{Namespace: pod.Namespace, Range: fmt.Sprintf("%v", ranges.Uid)}
+			reports[feature] = rep
+		}
+		rep.Pods++
+		rep.Violations = append(rep.Violations, auditPod(pod, ranges)...)
+	}
+	return reports
+}
+
+func auditPod(pod *core.Pod, ranges tracker.Ranges) []Violation {
+	var out []Violation
+	if scc := pod.Annotations[KeySCC]; PrivilegedSCCs[scc] {
+		out = append(out, Violation{
+			Pod:     pod.Name,
+			Reason:  ReasonPrivilegedSCC,
+			Message: fmt.Sprintf("admitted by SCC %s", scc),
+		})
+	}
+
+	psc := pod.Spec.SecurityContext
+	if psc == nil {
+		psc = &core.PodSecurityContext{}
+	}
+	if psc.FSGroup != nil && !ranges.ContainsGroup(*psc.FSGroup) {
+		out = append(out, Violation{
+			Pod:     pod.Name,
+			Reason:  ReasonGroupOutOfRange,
+			Message: fmt.Sprintf("fsGroup %d is outside %v", *psc.FSGroup, ranges.Groups),
+		})
+	}
+	for _, gid := range psc.SupplementalGroups {
+		if !ranges.ContainsGroup(gid) {
+			out = append(out, Violation{
+				Pod:     pod.Name,
+				Reason:  ReasonGroupOutOfRange,
+				Message: fmt.Sprintf("supplemental group %d is outside %v", gid, ranges.Groups),
+			})
+		}
+	}
+
+	containers := append(append([]core.Container{}, pod.Spec.InitContainers...), pod.Spec.Containers...)
+	for _, c := range containers {
+		uid := psc.RunAsUser
+		if c.SecurityContext != nil && c.SecurityContext.RunAsUser != nil {
+			uid = c.SecurityContext.RunAsUser
+		}
+		if uid != nil && !ranges.ContainsUid(*uid) {
+			out = append(out, Violation{
+				Pod:       pod.Name,
+				Container: c.Name,
+				Reason:    ReasonUidOutOfRange,
+				Message:   fmt.Sprintf("runAsUser %d is outside %v", *uid, ranges.Uid),
+			})
+		}
+	}
+	return out
+}
@@ -0,0 +1,86 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package audit
+
+import (
+	"testing"
+
+	"go.bytebuilders.dev/aceshifter/pkg/tracker"
+
+	core "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+)
+
+func TestPods(t *testing.T) {
+	ranges := tracker.Ranges{
+		Uid:    []tracker.Range{{Start: 1000, Size: 100}},
+		Groups: []tracker.Range{{Start: 1000, Size: 100}},
+	}
+	pod := func(name, instance string, psc *core.PodSecurityContext, containers ...core.Container) core.Pod {
+		return core.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: "kubeops",
+				Labels:    map[string]string{LabelInstance: instance},
+			},
+			Spec: core.PodSpec{
+				SecurityContext: psc,
+				Containers:      containers,
+			},
+			Status: core.PodStatus{Phase: core.PodRunning},
+		}
+	}
+
+	compliant := pod("ok", "kubedb", &core.PodSecurityContext{RunAsUser: ptr.To[int64](1000), FSGroup: ptr.To[int64](1000)},
+		core.Container{Name: "operator"})
+	outOfRange := pod("bad", "kubedb", &core.PodSecurityContext{FSGroup: ptr.To[int64](65534), SupplementalGroups: []int64{1001, 2000}},
+		core.Container{Name: "operator", SecurityContext: &core.SecurityContext{RunAsUser: ptr.To[int64](0)}},
+		core.Container{Name: "sidecar"})
+	privileged := pod("csi", "", nil, core.Container{Name: "driver"})
+	privileged.Annotations = map[string]string{KeySCC: "privileged"}
+	finished := pod("job", "kubedb", &core.PodSecurityContext{RunAsUser: ptr.To[int64](0)}, core.Container{Name: "job"})
+	finished.Status.Phase = core.PodSucceeded
+
+	reports := Pods([]core.Pod{compliant, outOfRange, privileged, finished}, ranges)
+	if len(reports) != 2 {
+		t.Fatalf("expected reports of 2 features, got %d", len(reports))
+	}
+
+	kubedb := reports["kubedb"]
+	if kubedb.Pods != 2 {
+		t.Errorf("expected 2 running kubedb pods, got %d", kubedb.Pods)
+	}
+	expected := []Violation{
+		{Pod: "bad", Reason: ReasonGroupOutOfRange, Message: "fsGroup 65534 is outside [1000/100]"},
+		{Pod: "bad", Reason: ReasonGroupOutOfRange, Message: "supplemental group 2000 is outside [1000/100]"},
+		{Pod: "bad", Container: "operator", Reason: ReasonUidOutOfRange, Message: "runAsUser 0 is outside [1000/100]"},
+	}
+	if len(kubedb.Violations) != len(expected) {
+		t.Fatalf("expected violations %v, got %v", expected, kubedb.Violations)
+	}
+	for i := range expected {
+		if kubedb.Violations[i] != expected[i] {
+			t.Errorf("expected violation %v, got %v", expected[i], kubedb.Violations[i])
+		}
+	}
+
+	unknown := reports[UnknownFeature]
+	if unknown == nil || len(unknown.Violations) != 1 || unknown.Violations[0].Reason != ReasonPrivilegedSCC {
+		t.Errorf("expected a privileged SCC violation for pods without an instance label, got %v", unknown)
+	}
+}
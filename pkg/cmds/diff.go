@@ -0,0 +1,95 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmds
+
+import (
+	"errors"
+	"fmt"
+
+	"go.bytebuilders.dev/aceshifter/pkg/diff"
+
+	"github.com/spf13/cobra"
+	core "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+	clustermeta "kmodules.xyz/client-go/cluster"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func NewCmdDiff() *cobra.Command {
+	var file string
+	var overlay overlayOptions
+	cmd := &cobra.Command{
+		Use:   "diff",
+		Short: "Show how the rendered overlays differ from the deployed ones",
+		Long: `Render the desired overlay of every ACE HelmRelease and compare it key by key with the
+live overlay ConfigMap, or with an overlay ConfigMap exported to a file. A unified YAML
+diff is printed per feature. The command exits with a non-zero code if any overlay changes.
+The overlay flags are the ones of the run command and must be set to the same values.`,
+		DisableAutoGenTag: true,
+		SilenceUsage:      true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := ctrl.GetConfig()
+			if err != nil {
+				return err
+			}
+			kc, err := client.New(cfg, client.Options{Scheme: scheme})
+			if err != nil {
+				return err
+			}
+
+			var live *core.ConfigMap
+			if file != "" {
+				live, err = diff.LoadOverlay(file)
+			} else {
+				live, err = diff.LiveOverlay(cmd.Context(), kc)
+			}
+			if err != nil {
+				return err
+			}
+
+			r, err := overlay.reconciler(cfg, kc, clustermeta.IsOpenShiftManaged(kc.RESTMapper()), klog.NewKlogr())
+			if err != nil {
+				return err
+			}
+			changes, err := diff.Overlays(cmd.Context(), r, live)
+			if err != nil {
+				return err
+			}
+
+			out := cmd.OutOrStdout()
+			for _, c := range changes {
+				if c.Error != nil {
+					_, _ = fmt.Fprintf(cmd.ErrOrStderr(), "%s: %v\n", c.Key, c.Error)
+					continue
+				}
+				s, err := c.Unified()
+				if err != nil {
+					return err
+				}
+				_, _ = fmt.Fprint(out, s)
+			}
+			if len(changes) > 0 {
+				return errors.New("overlays differ")
+			}
+			return nil
+		},
+	}
+	cmd.Flags().StringVarP(&file, "file", "f", "", "Compare with an overlay ConfigMap exported to this file instead of the live one")
+	overlay.addFlags(cmd.Flags())
+	return cmd
+}
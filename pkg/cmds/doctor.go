@@ -0,0 +1,86 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmds
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"go.bytebuilders.dev/aceshifter/pkg/doctor"
+
+	"github.com/spf13/cobra"
+	"k8s.io/klog/v2"
+	clustermeta "kmodules.xyz/client-go/cluster"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func NewCmdDoctor() *cobra.Command {
+	var output string
+	var overlay overlayOptions
+	cmd := &cobra.Command{
+		Use:   "doctor",
+		Short: "Check the OpenShift readiness of the cluster for ACE",
+		Long: `Connect to the cluster and report ACE namespaces without uid range annotations,
+mismatched uid and supplemental group ranges, features with empty overlays,
+required SCCs that are not bound and HelmReleases that do not use their overlay.
+The overlays are rendered with the overlay flags, which are the ones of the run
+command and must be set to the same values.`,
+		DisableAutoGenTag: true,
+		SilenceUsage:      true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := ctrl.GetConfig()
+			if err != nil {
+				return err
+			}
+			kc, err := client.New(cfg, client.Options{Scheme: scheme})
+			if err != nil {
+				return err
+			}
+
+			r, err := overlay.reconciler(cfg, kc, clustermeta.IsOpenShiftManaged(kc.RESTMapper()), klog.NewKlogr())
+			if err != nil {
+				return err
+			}
+			report, err := doctor.Run(cmd.Context(), r)
+			if err != nil {
+				return err
+			}
+			switch output {
+			case "table":
+				err = report.PrintTable(cmd.OutOrStdout())
+			case "json":
+				enc := json.NewEncoder(cmd.OutOrStdout())
+				enc.SetIndent("", "  ")
+				err = enc.Encode(report)
+			default:
+				return fmt.Errorf("unknown output format %q", output)
+			}
+			if err != nil {
+				return err
+			}
+			if report.HasErrors() {
+				return errors.New("cluster is not ready for ACE")
+			}
+			return nil
+		},
+	}
+	cmd.Flags().StringVarP(&output, "output", "o", "table", "Output format. One of: table|json")
+	overlay.addFlags(cmd.Flags())
+	return cmd
+}
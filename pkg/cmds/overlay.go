@@ -0,0 +1,178 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmds
+
+import (
+	"fmt"
+
+	"go.bytebuilders.dev/aceshifter/pkg/controller"
+	"go.bytebuilders.dev/aceshifter/pkg/featuresets"
+	"go.bytebuilders.dev/aceshifter/pkg/mirror"
+	"go.bytebuilders.dev/aceshifter/pkg/tracker"
+
+	"github.com/go-logr/logr"
+	"github.com/spf13/pflag"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// overlayOptions are the flags that decide how the overlays are rendered. The run and
+// diff commands share them, so that diff renders what run writes.
+type overlayOptions struct {
+	uidStrategy         string
+	uidOffset           int64
+	ingressMode         string
+	serviceCA           bool
+	monitoringMode      string
+	propagateProxy      bool
+	imageMirrors        []string
+	clusterImageMirrors bool
+	infraFeaturesets    []string
+	applyTLSProfile     bool
+	fipsMode            string
+	storageOverlays     bool
+}
+
+func (o *overlayOptions) addFlags(fs *pflag.FlagSet) {
+	fs.StringVar(&o.uidStrategy, "uid-strategy", string(featuresets.StrategyPin),
+		"Default uid strategy for the overlays. One of: pin|omit|offset. "+
+			"Features, HelmReleases and templates may override it with the "+featuresets.KeyUidStrategy+" annotation.")
+	fs.Int64Var(&o.uidOffset, "uid-offset", 0, "Default offset from the namespace uid range start used by the offset uid strategy")
+	fs.StringVar(&o.ingressMode, "ingress-mode", string(featuresets.IngressModeIngress),
+		"Default networking overlay. One of: ingress|route. The route mode disables the chart ingress controllers and "+
+			"exposes their Ingresses and Gateways with OpenShift Routes. Features and HelmReleases may override it with the "+
+			featuresets.KeyIngressMode+" annotation.")
+	fs.BoolVar(&o.serviceCA, "service-ca", false,
+		"If set, charts that allow it use webhook and API server certificates issued by the OpenShift service-ca operator "+
+			"instead of generating their own. Features and HelmReleases may override it with the "+featuresets.KeyServiceCA+" annotation.")
+	fs.StringVar(&o.monitoringMode, "monitoring-mode", string(featuresets.MonitoringModePrometheus),
+		"Default monitoring overlay. One of: auto|prometheus|user-workload. The user-workload mode disables the ACE Prometheus stack "+
+			"and queries the OpenShift Thanos Querier, with the service accounts of the querying features bound to the "+
+			tracker.ClusterMonitoringViewRole+" ClusterRole. auto selects it when OpenShift user-workload monitoring is enabled. "+
+			"Features and HelmReleases may override it with the "+featuresets.KeyMonitoringMode+" annotation.")
+	fs.BoolVar(&o.propagateProxy, "propagate-proxy", true,
+		"If set, the OpenShift cluster-wide proxy and trusted CA bundle are rendered into the overlays of features that talk to external services")
+	fs.StringSliceVar(&o.imageMirrors, "image-mirror", nil,
+		"Rewrite the images of every feature from a source registry or repository to a mirror, as source=mirror. "+
+			"May be repeated; the longest matching source wins.")
+	fs.BoolVar(&o.clusterImageMirrors, "cluster-image-mirrors", true,
+		"If set, the mirrors of the OpenShift ImageDigestMirrorSets, ImageTagMirrorSets and ImageContentSourcePolicies "+
+			"are added to the image mirrors. Mirrors given with --image-mirror take precedence.")
+	fs.StringSliceVar(&o.infraFeaturesets, "infra-featuresets", nil,
+		"Featuresets whose pods are placed on OpenShift infra nodes with a "+tracker.LabelInfraNode+" node selector and toleration, "+
+			"if the cluster has infra nodes, eg, opscenter-core. aceshifter itself is never moved. "+
+			"Features and HelmReleases may override it with the "+featuresets.KeyInfraPlacement+" annotation.")
+	fs.BoolVar(&o.applyTLSProfile, "apply-tls-profile", true,
+		"If set, the TLS security profile of the OpenShift cluster API server is applied to the metrics and webhook servers "+
+			"and rendered into the overlays of components that serve TLS, if their chart declares the tls values. "+
+			"The profile of the default IngressController is rendered into the overlays of ingress controllers. "+
+			"aceshifter restarts when the API server profile changes.")
+	fs.StringVar(&o.fipsMode, "fips-mode", string(featuresets.FIPSModeAuto),
+		"FIPS overlays. One of: auto|on|off. The on mode runs the Go components in FIPS 140-3 mode, "+
+			"selects the FIPS image variants of the features whose charts ship them "+
+			"and refuses the features whose crypto is not provided by Go. "+
+			"auto selects it when an OpenShift cluster was installed in FIPS mode or a node has the "+tracker.LabelFIPSNode+" label, "+
+			"and refuses the Go components whose images are not known to support the FIPS mode instead of enabling it.")
+	fs.BoolVar(&o.storageOverlays, "storage-overlays", false,
+		"If set, the default StorageClass is pinned at the first install and the volume permission settings of its CSI driver "+
+			"(fsGroupChangePolicy, and seLinuxChangePolicy if the API server supports it) are rendered into the overlays "+
+			"of features with persistent volumes")
+}
+
+// reconciler returns a HelmReleaseReconciler that renders the overlays as set by the
+// flags. The overlays that need OpenShift are disabled on other clusters.
+func (o *overlayOptions) reconciler(cfg *rest.Config, kc client.Client, isOpenShift bool, log logr.Logger) (*controller.HelmReleaseReconciler, error) {
+	strategy, err := featuresets.ParseStrategy(o.uidStrategy)
+	if err != nil {
+		return nil, fmt.Errorf("invalid flag uid-strategy: %w", err)
+	}
+	mode, err := featuresets.ParseIngressMode(o.ingressMode)
+	if err != nil {
+		return nil, fmt.Errorf("invalid flag ingress-mode: %w", err)
+	}
+	monitoring, err := featuresets.ParseMonitoringMode(o.monitoringMode)
+	if err != nil {
+		return nil, fmt.Errorf("invalid flag monitoring-mode: %w", err)
+	}
+	fips, err := featuresets.ParseFIPSMode(o.fipsMode)
+	if err != nil {
+		return nil, fmt.Errorf("invalid flag fips-mode: %w", err)
+	}
+	mirrors, err := mirror.ParseRules(o.imageMirrors)
+	if err != nil {
+		return nil, fmt.Errorf("invalid flag image-mirror: %w", err)
+	}
+
+	r := &controller.HelmReleaseReconciler{
+		Client:              kc,
+		Scheme:              scheme,
+		UidStrategy:         strategy,
+		UidOffset:           o.uidOffset,
+		IngressMode:         mode,
+		ServiceCA:           o.serviceCA,
+		MonitoringMode:      monitoring,
+		PropagateProxy:      o.propagateProxy,
+		ImageMirrors:        mirrors,
+		ClusterImageMirrors: o.clusterImageMirrors,
+		InfraFeaturesets:    o.infraFeaturesets,
+		ApplyTLSProfile:     o.applyTLSProfile,
+		FIPSMode:            fips,
+		StorageOverlays:     o.storageOverlays,
+	}
+	if isOpenShift {
+		if r.StorageOverlays {
+			dc, err := discovery.NewDiscoveryClientForConfig(cfg)
+			if err != nil {
+				return nil, err
+			}
+			if r.SELinuxChangePolicy, err = tracker.SupportsSELinuxChangePolicy(dc); err != nil {
+				return nil, err
+			}
+		}
+		return r, nil
+	}
+	if r.ServiceCA {
+		log.Info("not an OpenShift cluster, service-ca overlays are disabled")
+		r.ServiceCA = false
+	}
+	if r.PropagateProxy {
+		log.Info("not an OpenShift cluster, cluster proxy propagation is disabled")
+		r.PropagateProxy = false
+	}
+	if r.ClusterImageMirrors {
+		log.Info("not an OpenShift cluster, cluster image mirrors are disabled")
+		r.ClusterImageMirrors = false
+	}
+	if len(r.InfraFeaturesets) > 0 {
+		log.Info("not an OpenShift cluster, infra node placement is disabled")
+		r.InfraFeaturesets = nil
+	}
+	if r.ApplyTLSProfile {
+		log.Info("not an OpenShift cluster, the TLS security profile is not applied")
+		r.ApplyTLSProfile = false
+	}
+	if r.StorageOverlays {
+		log.Info("not an OpenShift cluster, storage overlays are disabled")
+		r.StorageOverlays = false
+	}
+	if r.FIPSMode == featuresets.FIPSModeAuto {
+		log.Info("not an OpenShift cluster, FIPS mode is not detected")
+		r.FIPSMode = featuresets.FIPSModeOff
+	}
+	return r, nil
+}
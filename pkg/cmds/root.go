@@ -18,7 +18,6 @@ package cmds
 
 import (
 	"github.com/spf13/cobra"
-	v "gomodules.xyz/x/version"
 )
 
 func NewRootCmd() *cobra.Command {
@@ -29,7 +28,10 @@ func NewRootCmd() *cobra.Command {
 	}
 
 	rootCmd.AddCommand(NewCmdRun())
-	rootCmd.AddCommand(v.NewCmdVersion())
+	rootCmd.AddCommand(NewCmdScaffold())
+	rootCmd.AddCommand(NewCmdDoctor())
+	rootCmd.AddCommand(NewCmdDiff())
+	rootCmd.AddCommand(NewCmdVersion())
 	rootCmd.AddCommand(NewCmdCompletion())
 
 	return rootCmd
@@ -17,11 +17,15 @@ limitations under the License.
 package cmds
 
 import (
+	"context"
 	"crypto/tls"
 	"flag"
 	"os"
+	"time"
 
 	"go.bytebuilders.dev/aceshifter/pkg/controller"
+	"go.bytebuilders.dev/aceshifter/pkg/featuresets"
+	"go.bytebuilders.dev/aceshifter/pkg/tracker"
 
 	helmapi "github.com/fluxcd/helm-controller/api/v2"
 	"github.com/spf13/cobra"
@@ -33,6 +37,7 @@ import (
 	clustermeta "kmodules.xyz/client-go/cluster"
 	uiapi "kmodules.xyz/resource-metadata/apis/ui/v1alpha1"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	"sigs.k8s.io/controller-runtime/pkg/metrics/filters"
 	metricsserver "sigs.k8s.io/controller-runtime/pkg/metrics/server"
@@ -57,6 +62,20 @@ func NewCmdRun() *cobra.Command {
 	var secureMetrics bool
 	var enableHTTP2 bool
 	var tlsOpts []func(*tls.Config)
+	var gateInstall bool
+	var createNamespace bool
+	var pinRanges bool
+	var remediateVolumes bool
+	var restartOnRangeChange bool
+	var restartInterval time.Duration
+	var auditInterval time.Duration
+	var remediation controller.VolumeRemediation
+	var overlay overlayOptions
+	var namespaceTemplate string
+	var dryRun bool
+	var consoleLink bool
+	var consolePluginService string
+	var consolePluginPort int32
 	cmd := &cobra.Command{
 		Use:               "run",
 		Short:             "Launch aceshifter",
@@ -79,6 +98,27 @@ func NewCmdRun() *cobra.Command {
 				tlsOpts = append(tlsOpts, disableHTTP2)
 			}
 
+			cfg := ctrl.GetConfigOrDie()
+			var tlsProfile *tracker.TLSProfile
+			if overlay.applyTLSProfile {
+				kc, err := client.New(cfg, client.Options{Scheme: scheme})
+				if err != nil {
+					setupLog.Error(err, "unable to create client")
+					os.Exit(1)
+				}
+				// the HelmRelease reconciler logs that the profile is not applied on other clusters
+				if clustermeta.IsOpenShiftManaged(kc.RESTMapper()) {
+					if tlsProfile, err = tracker.GetTLSProfile(context.Background(), kc); err != nil {
+						setupLog.Error(err, "unable to read the TLS security profile")
+						os.Exit(1)
+					}
+				}
+			}
+			if tlsProfile != nil {
+				setupLog.Info("applying the cluster TLS security profile", "type", tlsProfile.Type, "minTLSVersion", tlsProfile.MinTLSVersion)
+				tlsOpts = append(tlsOpts, tlsProfile.Apply)
+			}
+
 			webhookServer := webhook.NewServer(webhook.Options{
 				TLSOpts: tlsOpts,
 			})
@@ -107,7 +147,7 @@ func NewCmdRun() *cobra.Command {
 				metricsServerOptions.FilterProvider = filters.WithAuthenticationAndAuthorization
 			}
 
-			mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
+			mgr, err := ctrl.NewManager(cfg, ctrl.Options{
 				Scheme:                 scheme,
 				Metrics:                metricsServerOptions,
 				WebhookServer:          webhookServer,
@@ -131,25 +171,125 @@ func NewCmdRun() *cobra.Command {
 				os.Exit(1)
 			}
 
+			kc := mgr.GetClient()
+			recorder := mgr.GetEventRecorderFor("aceshifter")
+			if dryRun {
+				setupLog.Info("running in dry-run mode, changes are reported but not persisted")
+				kc = controller.NewDryRunClient(kc)
+				recorder = controller.NewDryRunRecorder(recorder)
+			}
+
 			isOcmSpoke := clustermeta.IsOpenClusterSpoke(mgr.GetAPIReader())
 			if isOcmSpoke {
 				if err = (&controller.NamespaceReconciler{
-					Client: mgr.GetClient(),
-					Scheme: mgr.GetScheme(),
+					Client:   kc,
+					Scheme:   mgr.GetScheme(),
+					Recorder: recorder,
+					DryRun:   dryRun,
 				}).SetupWithManager(mgr); err != nil {
 					setupLog.Error(err, "unable to create controller", "controller", "Namespace")
 					os.Exit(1)
 				}
 			}
 
-			if err = (&controller.HelmReleaseReconciler{
-				Client: mgr.GetClient(),
-				Scheme: mgr.GetScheme(),
-			}).SetupWithManager(mgr); err != nil {
+			var nsTemplate *tracker.NamespaceTemplate
+			if createNamespace {
+				nsTemplate = tracker.DefaultNamespaceTemplate()
+				if namespaceTemplate != "" {
+					if nsTemplate, err = tracker.LoadNamespaceTemplate(namespaceTemplate); err != nil {
+						setupLog.Error(err, "invalid flag", "flag", "namespace-template")
+						os.Exit(1)
+					}
+				}
+			}
+
+			var volumeRemediation *controller.VolumeRemediation
+			if remediateVolumes {
+				volumeRemediation = &remediation
+			}
+
+			isOpenShift := clustermeta.IsOpenShiftManaged(mgr.GetRESTMapper())
+			if remediation.SCC != "" && !isOpenShift {
+				remediation.SCC = ""
+			}
+			if gateInstall && !isOpenShift {
+				setupLog.Info("not an OpenShift cluster, HelmRelease gating is disabled")
+				gateInstall = false
+			}
+			r, err := overlay.reconciler(cfg, kc, isOpenShift, setupLog)
+			if err != nil {
+				setupLog.Error(err, "invalid flag")
+				os.Exit(1)
+			}
+			r.Recorder = recorder
+			r.GateInstall = gateInstall
+			r.PinRanges = pinRanges
+			r.VolumeRemediation = volumeRemediation
+			r.NamespaceTemplate = nsTemplate
+			r.RestartOnRangeChange = restartOnRangeChange
+			r.RestartInterval = restartInterval
+			r.DryRun = dryRun
+			if err = r.SetupWithManager(mgr); err != nil {
 				setupLog.Error(err, "unable to create controller", "controller", "HelmRelease")
 				os.Exit(1)
 			}
 
+			if isOpenShift {
+				if err = (&controller.RouteReconciler{
+					Client:      kc,
+					APIReader:   mgr.GetAPIReader(),
+					Scheme:      mgr.GetScheme(),
+					Recorder:    recorder,
+					IngressMode: r.IngressMode,
+					DryRun:      dryRun,
+				}).SetupWithManager(mgr); err != nil {
+					setupLog.Error(err, "unable to create controller", "controller", "Route")
+					os.Exit(1)
+				}
+				if consoleLink {
+					if err = (&controller.ConsoleReconciler{
+						Client:        kc,
+						Recorder:      recorder,
+						PluginService: consolePluginService,
+						PluginPort:    consolePluginPort,
+						DryRun:        dryRun,
+					}).SetupWithManager(mgr); err != nil {
+						setupLog.Error(err, "unable to create controller", "controller", "Console")
+						os.Exit(1)
+					}
+				}
+			} else if r.IngressMode == featuresets.IngressModeRoute {
+				setupLog.Info("not an OpenShift cluster, Routes are not generated for the route ingress mode")
+			}
+
+			ctx, cancel := context.WithCancel(ctrl.SetupSignalHandler())
+			defer cancel()
+			if tlsProfile != nil {
+				if err = (&controller.TLSProfileReconciler{
+					Client:  kc,
+					Profile: tlsProfile,
+					OnChange: func() {
+						setupLog.Info("TLS security profile changed, restarting to apply it")
+						cancel()
+					},
+				}).SetupWithManager(mgr); err != nil {
+					setupLog.Error(err, "unable to create controller", "controller", "TLSProfile")
+					os.Exit(1)
+				}
+			}
+
+			if auditInterval > 0 {
+				if err = (&controller.AuditReconciler{
+					Client:   kc,
+					Scheme:   mgr.GetScheme(),
+					Interval: auditInterval,
+					DryRun:   dryRun,
+				}).SetupWithManager(mgr); err != nil {
+					setupLog.Error(err, "unable to create controller", "controller", "Audit")
+					os.Exit(1)
+				}
+			}
+
 			if err := mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {
 				setupLog.Error(err, "unable to set up health check")
 				os.Exit(1)
@@ -160,7 +300,7 @@ func NewCmdRun() *cobra.Command {
 			}
 
 			setupLog.Info("starting manager")
-			if err := mgr.Start(ctrl.SetupSignalHandler()); err != nil {
+			if err := mgr.Start(ctx); err != nil {
 				setupLog.Error(err, "problem running manager")
 				os.Exit(1)
 			}
@@ -181,5 +321,44 @@ func NewCmdRun() *cobra.Command {
 		"If set, the metrics endpoint is served securely via HTTPS. Use --metrics-secure=false to use HTTP instead.")
 	cmd.Flags().BoolVar(&enableHTTP2, "enable-http2", false,
 		"If set, HTTP/2 will be enabled for the metrics and webhook servers")
+	overlay.addFlags(cmd.Flags())
+	cmd.Flags().BoolVar(&gateInstall, "gate-helmreleases", false,
+		"If set, HelmReleases that were never installed are suspended until their SCC overlay is ready, "+
+			"including the image mirrors of their chart defaults")
+	cmd.Flags().BoolVar(&createNamespace, "create-namespace", true,
+		"If set, missing HelmRelease target namespaces are created. Use --create-namespace=false to leave them to the installer.")
+	cmd.Flags().StringVar(&namespaceTemplate, "namespace-template", "",
+		"Path to a file with the labels, annotations and pinned uid ranges of the namespaces aceshifter creates")
+	cmd.Flags().BoolVar(&pinRanges, "pin-uid-ranges", false,
+		"If set, the uid range of each target namespace is recorded in the "+tracker.RegistryNamespace+"/"+tracker.RegistryName+
+			" ConfigMap and re-applied when the namespace is recreated or restored, before any pod runs in it. "+
+			"The range is updated when it is changed on the live namespace and forgotten once the namespace is deleted and no HelmRelease targets it")
+	cmd.Flags().BoolVar(&remediateVolumes, "remediate-volumes", false,
+		"If set, the workloads of a release are scaled down and its PVC data is moved to the new uid range by Jobs before a namespace uid range change is rendered into the overlays. "+
+			"The Jobs only change the file ownership, SELinux labels are left to the kubelet, which relabels volumes whose plugin supports it when they are mounted")
+	cmd.Flags().StringVar(&remediation.Image, "remediation-image", "busybox:1.36", "Image of the volume remediation Jobs")
+	cmd.Flags().StringVar(&remediation.ServiceAccount, "remediation-service-account", "aceshifter-remediation",
+		"ServiceAccount of the volume remediation Jobs, created in the target namespaces if missing")
+	cmd.Flags().StringVar(&remediation.SCC, "remediation-scc", "aceshifter-remediation",
+		"SCC required by the volume remediation pods, created if missing")
+	cmd.Flags().DurationVar(&remediation.Timeout, "remediation-timeout", time.Hour,
+		"Deadline of a volume remediation Job")
+	cmd.Flags().BoolVar(&remediation.ResumeOnFailure, "remediation-resume-on-failure", false,
+		"If set, the workloads are scaled back up with the new uid range when a volume remediation Job fails. "+
+			"Otherwise they stay scaled down until the failed Jobs are deleted to retry the remediation")
+	cmd.Flags().BoolVar(&restartOnRangeChange, "restart-on-range-change", false,
+		"If set, the workloads of a HelmRelease are restarted when its namespace uid range changes but its overlay does not")
+	cmd.Flags().DurationVar(&restartInterval, "restart-interval", 30*time.Second,
+		"Interval at which a HelmRelease whose workloads are restarted for a uid range change is checked to restart the next workload")
+	cmd.Flags().DurationVar(&auditInterval, "audit-interval", 0,
+		"If set, the pods of ACE managed namespaces are audited against their namespace uid range at this interval")
+	cmd.Flags().BoolVar(&consoleLink, "console-link", false,
+		"If set, the ACE UI of each ace HelmRelease is linked from the OpenShift console application menu, using the host of its Ingress or Route")
+	cmd.Flags().StringVar(&consolePluginService, "console-plugin-service", "",
+		"Service in the ace release namespace that serves the ACE console plugin. If set, a ConsolePlugin is registered "+
+			"and enabled in the console operator config. Requires --console-link.")
+	cmd.Flags().Int32Var(&consolePluginPort, "console-plugin-port", 9443, "Port of the ACE console plugin Service")
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false,
+		"If set, changes are computed, validated with server-side dry-run and reported as logs, events and metrics, but never persisted")
 	return cmd
 }
@@ -0,0 +1,80 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmds
+
+import (
+	"fmt"
+
+	"go.bytebuilders.dev/aceshifter/pkg/featuresets"
+	"go.bytebuilders.dev/aceshifter/pkg/scaffold"
+
+	"github.com/spf13/cobra"
+	"sigs.k8s.io/yaml"
+)
+
+func NewCmdScaffold() *cobra.Command {
+	var chartPath string
+	var featureSet string
+	var feature string
+	var output string
+	cmd := &cobra.Command{
+		Use:   "scaffold",
+		Short: "Generate a draft featureset template from a chart",
+		Long: `Discover the securityContext values paths of a chart (directory or .tgz) and its subcharts,
+and print a draft featureset template or catalog entry for review.`,
+		DisableAutoGenTag: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			chart, err := scaffold.LoadChart(chartPath)
+			if err != nil {
+				return err
+			}
+			if feature == "" {
+				feature = chart.Name
+			}
+			entry := scaffold.Discover(chart)
+
+			var out []byte
+			switch output {
+			case "template":
+				out, err = entry.Template()
+			case "catalog":
+				out, err = yaml.Marshal(featuresets.Catalog{
+					featureSet + "/" + feature: entry,
+				})
+			default:
+				return fmt.Errorf("unknown output format %q", output)
+			}
+			if err != nil {
+				return err
+			}
+
+			if output == "template" {
+				_, _ = fmt.Fprintf(cmd.OutOrStdout(), "# pkg/featuresets/%s/%s.yaml\n", featureSet, feature)
+			}
+			_, err = fmt.Fprintln(cmd.OutOrStdout(), string(out))
+			return err
+		},
+	}
+
+	cmd.Flags().StringVar(&chartPath, "chart", "", "Path to the chart directory or .tgz archive")
+	cmd.Flags().StringVar(&featureSet, "featureset", "", "Name of the featureset the chart belongs to")
+	cmd.Flags().StringVar(&feature, "feature", "", "Name of the feature. Defaults to the chart name")
+	cmd.Flags().StringVarP(&output, "output", "o", "template", "Output format. One of: template|catalog")
+	_ = cmd.MarkFlagRequired("chart")
+	_ = cmd.MarkFlagRequired("featureset")
+	return cmd
+}
@@ -0,0 +1,43 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmds
+
+import (
+	"crypto/fips140"
+	"fmt"
+
+	"go.bytebuilders.dev/aceshifter/pkg/controller"
+
+	"github.com/spf13/cobra"
+	v "gomodules.xyz/x/version"
+)
+
+// NewCmdVersion extends the version command with the FIPS 140-3 crypto aceshifter
+// was built with.
+func NewCmdVersion() *cobra.Command {
+	cmd := v.NewCmdVersion()
+	run := cmd.RunE
+	cmd.RunE = func(cmd *cobra.Command, args []string) error {
+		err := run(cmd, args)
+		if short, _ := cmd.Flags().GetBool("short"); !short {
+			_, _ = fmt.Fprintf(cmd.OutOrStdout(), "FIPS140Module = %v\n", controller.FIPSModule())
+			_, _ = fmt.Fprintf(cmd.OutOrStdout(), "FIPS140Enabled = %v\n", fips140.Enabled())
+		}
+		return err
+	}
+	return cmd
+}
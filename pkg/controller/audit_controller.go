@@ -0,0 +1,171 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.bytebuilders.dev/aceshifter/pkg/audit"
+	"go.bytebuilders.dev/aceshifter/pkg/tracker"
+
+	helmapi "github.com/fluxcd/helm-controller/api/v2"
+	core "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/yaml"
+)
+
+// AuditReportName is the ConfigMap that holds the audit report of each feature.
+const AuditReportName = "ace-openshift-audit"
+
+// AuditReconciler reports running pods of ACE managed namespaces that violate
+// the uid range of their namespace or were admitted by a privileged SCC.
+// It never modifies the audited pods.
+type AuditReconciler struct {
+	client.Client
+	Scheme   *runtime.Scheme
+	Interval time.Duration
+	// DryRun reports the audit report changes instead of persisting them.
+	DryRun bool
+}
+
+func (r *AuditReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	var ns core.Namespace
+	if err := r.Get(ctx, req.NamespacedName, &ns); apierrors.IsNotFound(err) {
+		// the namespace is deleted, drop its violations
+		return ctrl.Result{}, r.report(ctx, req.Name, nil)
+	} else if err != nil {
+		return ctrl.Result{}, err
+	}
+	ranges, err := tracker.NamespaceRanges(&ns)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if ranges == nil {
+		return ctrl.Result{}, r.report(ctx, ns.Name, nil)
+	}
+
+	var pods core.PodList
+	if err := r.List(ctx, &pods, client.InNamespace(ns.Name)); err != nil {
+		return ctrl.Result{}, err
+	}
+	if err := r.report(ctx, ns.Name, audit.Pods(pods.Items, *ranges)); err != nil {
+		return ctrl.Result{}, err
+	}
+	return ctrl.Result{RequeueAfter: r.Interval}, nil
+}
+
+// report exports the violations of the pods of a namespace and writes its audit
+// reports, replacing the previous ones.
+func (r *AuditReconciler) report(ctx context.Context, ns string, reports map[string]*audit.Report) error {
+	auditViolations.DeletePartialMatch(map[string]string{"namespace": ns})
+	for feature, rep := range reports {
+		counts := map[audit.Reason]int{}
+		for _, v := range rep.Violations {
+			counts[v.Reason]++
+		}
+		for reason, n := range counts {
+			auditViolations.WithLabelValues(ns, feature, string(reason)).Set(float64(n))
+		}
+	}
+
+	cm := core.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      AuditReportName,
+			Namespace: tracker.OverlayNamespace,
+		},
+	}
+	result, err := controllerutil.CreateOrPatch(ctx, r.Client, &cm, func() error {
+		if cm.Data == nil {
+			cm.Data = map[string]string{}
+		}
+		prefix := ns + "."
+		for key := range cm.Data {
+			if strings.HasPrefix(key, prefix) {
+				delete(cm.Data, key)
+			}
+		}
+		for feature, rep := range reports {
+			data, err := yaml.Marshal(rep)
+			if err != nil {
+				return err
+			}
+			cm.Data[prefix+feature+".yaml"] = string(data)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if r.DryRun {
+		reportDryRun(ctx, nil, nil, "audit", "ConfigMap", tracker.OverlayNamespace+"/"+AuditReportName, result)
+	} else if result != controllerutil.OperationResultNone {
+		log.FromContext(ctx).Info(fmt.Sprintf("%s audit report of namespace %s", result, ns))
+	}
+	return nil
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *AuditReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		Named("audit").
+		For(&core.Namespace{}, builder.WithPredicates(auditedNamespace(r.Client))).
+		Complete(r)
+}
+
+// auditedNamespace selects the namespaces featureNamespace selects and the target
+// namespaces of the ace HelmReleases, which have no Feature. Updates that remove the
+// uid range of a namespace are selected too, so that its violations are dropped.
+func auditedNamespace(kc client.Reader) predicate.Predicate {
+	aceNamespace := predicate.NewPredicateFuncs(func(obj client.Object) bool {
+		if _, ok := obj.GetAnnotations()[tracker.KeyUid]; !ok {
+			return false
+		}
+		var list helmapi.HelmReleaseList
+		if err := kc.List(context.TODO(), &list); err != nil {
+			return false
+		}
+		for _, hr := range list.Items {
+			if hr.GetReleaseNamespace() == obj.GetName() && hr.Spec.Chart != nil && hr.Spec.Chart.Spec.Chart == "ace" {
+				return true
+			}
+		}
+		return false
+	})
+	rangeRemoved := predicate.Funcs{
+		CreateFunc: func(event.CreateEvent) bool { return false },
+		UpdateFunc: func(e event.UpdateEvent) bool {
+			_, had := e.ObjectOld.GetAnnotations()[tracker.KeyUid]
+			_, has := e.ObjectNew.GetAnnotations()[tracker.KeyUid]
+			return had && !has
+		},
+		DeleteFunc:  func(event.DeleteEvent) bool { return false },
+		GenericFunc: func(event.GenericEvent) bool { return false },
+	}
+	return predicate.Or(featureNamespace(kc), aceNamespace, rangeRemoved)
+}
@@ -0,0 +1,176 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"go.bytebuilders.dev/aceshifter/pkg/audit"
+	"go.bytebuilders.dev/aceshifter/pkg/tracker"
+
+	helmapi "github.com/fluxcd/helm-controller/api/v2"
+	core "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	uiapi "kmodules.xyz/resource-metadata/apis/ui/v1alpha1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+)
+
+func TestAuditDropsViolations(t *testing.T) {
+	tests := []struct {
+		name      string
+		namespace *core.Namespace
+	}{
+		{name: "namespace deleted"},
+		{name: "namespace without range", namespace: &core.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "demo"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			auditViolations.WithLabelValues("demo", "kubedb", string(audit.ReasonUidOutOfRange)).Set(1)
+			auditViolations.WithLabelValues("other", "kubedb", string(audit.ReasonUidOutOfRange)).Set(1)
+			defer auditViolations.Reset()
+
+			kc := &fakeAuditClient{
+				namespace: tt.namespace,
+				report: &core.ConfigMap{
+					ObjectMeta: metav1.ObjectMeta{Namespace: tracker.OverlayNamespace, Name: AuditReportName},
+					Data:       map[string]string{"demo.kubedb.yaml": "pods: 1\n", "other.kubedb.yaml": "pods: 1\n"},
+				},
+			}
+			r := &AuditReconciler{Client: kc}
+			if _, err := r.Reconcile(context.TODO(), ctrl.Request{NamespacedName: types.NamespacedName{Name: "demo"}}); err != nil {
+				t.Fatal(err)
+			}
+
+			if auditViolations.DeleteLabelValues("demo", "kubedb", string(audit.ReasonUidOutOfRange)) {
+				t.Error("expected the violations of namespace demo to be dropped")
+			}
+			if !auditViolations.DeleteLabelValues("other", "kubedb", string(audit.ReasonUidOutOfRange)) {
+				t.Error("expected the violations of namespace other to be kept")
+			}
+			if expected := map[string]string{"other.kubedb.yaml": "pods: 1\n"}; !reflect.DeepEqual(kc.report.Data, expected) {
+				t.Errorf("expected reports %v, got %v", expected, kc.report.Data)
+			}
+		})
+	}
+}
+
+func TestAuditedNamespace(t *testing.T) {
+	withRange := func(name string) *core.Namespace {
+		return &core.Namespace{ObjectMeta: metav1.ObjectMeta{
+			Name:        name,
+			Annotations: map[string]string{tracker.KeyUid: "1000000/10000"},
+		}}
+	}
+	kc := &fakeAuditClient{
+		releases: []helmapi.HelmRelease{
+			{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "kubeops", Name: "ace"},
+				Spec: helmapi.HelmReleaseSpec{
+					TargetNamespace: "ace",
+					Chart:           &helmapi.HelmChartTemplate{Spec: helmapi.HelmChartTemplateSpec{Chart: "ace"}},
+				},
+			},
+			{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "kubeops", Name: "nginx"},
+				Spec: helmapi.HelmReleaseSpec{
+					TargetNamespace: "web",
+					Chart:           &helmapi.HelmChartTemplate{Spec: helmapi.HelmChartTemplateSpec{Chart: "nginx"}},
+				},
+			},
+		},
+		features: []uiapi.Feature{{
+			ObjectMeta: metav1.ObjectMeta{Name: "kubedb"},
+			Spec:       uiapi.FeatureSpec{Chart: uiapi.ChartInfo{Namespace: "kubedb"}},
+		}},
+	}
+	p := auditedNamespace(kc)
+
+	for _, tt := range []struct {
+		namespace *core.Namespace
+		want      bool
+	}{
+		{namespace: withRange("kubedb"), want: true},
+		{namespace: withRange("ace"), want: true},
+		{namespace: &core.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "ace"}}, want: false},
+		{namespace: withRange("web"), want: false},
+	} {
+		if got := p.Create(event.CreateEvent{Object: tt.namespace}); got != tt.want {
+			t.Errorf("%s: expected %v, got %v", tt.namespace.Name, tt.want, got)
+		}
+	}
+
+	old, removed := withRange("web"), &core.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "web"}}
+	if !p.Update(event.UpdateEvent{ObjectOld: old, ObjectNew: removed}) {
+		t.Error("expected the removal of a uid range to be selected")
+	}
+	if p.Update(event.UpdateEvent{ObjectOld: removed, ObjectNew: removed}) {
+		t.Error("expected a namespace without range to be ignored")
+	}
+}
+
+// fakeAuditClient serves a namespace, the audit report ConfigMap, the HelmReleases
+// and the Features read by the audit.
+type fakeAuditClient struct {
+	client.Client
+	namespace *core.Namespace
+	report    *core.ConfigMap
+	releases  []helmapi.HelmRelease
+	features  []uiapi.Feature
+}
+
+func (c *fakeAuditClient) Get(_ context.Context, key client.ObjectKey, obj client.Object, _ ...client.GetOption) error {
+	switch o := obj.(type) {
+	case *core.Namespace:
+		if c.namespace != nil && c.namespace.Name == key.Name {
+			c.namespace.DeepCopyInto(o)
+			return nil
+		}
+	case *core.ConfigMap:
+		if c.report != nil && key.Name == AuditReportName {
+			c.report.DeepCopyInto(o)
+			return nil
+		}
+	}
+	return apierrors.NewNotFound(schema.GroupResource{}, key.Name)
+}
+
+func (c *fakeAuditClient) List(_ context.Context, list client.ObjectList, _ ...client.ListOption) error {
+	switch l := list.(type) {
+	case *helmapi.HelmReleaseList:
+		l.Items = append(l.Items, c.releases...)
+	case *uiapi.FeatureList:
+		l.Items = append(l.Items, c.features...)
+	}
+	return nil
+}
+
+func (c *fakeAuditClient) Create(_ context.Context, obj client.Object, _ ...client.CreateOption) error {
+	c.report = obj.(*core.ConfigMap).DeepCopy()
+	return nil
+}
+
+func (c *fakeAuditClient) Patch(_ context.Context, obj client.Object, _ client.Patch, _ ...client.PatchOption) error {
+	c.report = obj.(*core.ConfigMap).DeepCopy()
+	return nil
+}
@@ -0,0 +1,472 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	"go.bytebuilders.dev/aceshifter/pkg/tracker"
+
+	helmapi "github.com/fluxcd/helm-controller/api/v2"
+	core "k8s.io/api/core/v1"
+	networking "k8s.io/api/networking/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+const (
+	// KeyConsoleSource is set on generated console objects to the
+	// HelmRelease/<namespace>/<name> of the ace release they link to.
+	KeyConsoleSource = "aceshifter.appscode.com/console-source"
+	// LabelConsoleSource selects the console objects generated for a release. The
+	// value is a hash of their KeyConsoleSource annotation.
+	LabelConsoleSource = "aceshifter.appscode.com/console-source-hash"
+
+	// ConsoleName is the cluster console operator config that enables plugins.
+	ConsoleName = "cluster"
+
+	EventReasonConsoleSynced = "ConsoleSynced"
+
+	consoleText    = "AppsCode Container Engine"
+	consoleSection = "AppsCode"
+)
+
+var (
+	ConsoleLinkGVK   = schema.GroupVersionKind{Group: "console.openshift.io", Version: "v1", Kind: "ConsoleLink"}
+	ConsolePluginGVK = schema.GroupVersionKind{Group: "console.openshift.io", Version: "v1", Kind: "ConsolePlugin"}
+	ConsoleGVK       = schema.GroupVersionKind{Group: "operator.openshift.io", Version: "v1", Kind: "Console"}
+
+	// consoleGVKs are the kinds of the generated console objects.
+	consoleGVKs = []schema.GroupVersionKind{ConsoleLinkGVK, ConsolePluginGVK}
+)
+
+// ConsoleReconciler registers the ACE UI of each ace HelmRelease with the OpenShift
+// console, as a ConsoleLink in the application menu and, optionally, a ConsolePlugin
+// served by the release. The objects are removed when the release is uninstalled, or
+// on the next start if aceshifter was not running then.
+type ConsoleReconciler struct {
+	client.Client
+	Recorder record.EventRecorder
+	// PluginService is the Service in the release namespace that serves the ACE
+	// console plugin. No ConsolePlugin is registered if it is empty.
+	PluginService string
+	PluginPort    int32
+	// DryRun reports the console changes instead of persisting them. Client must send
+	// writes as server-side dry-runs, see NewDryRunClient.
+	DryRun bool
+}
+
+func (r *ConsoleReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	source := consoleSource(req.NamespacedName)
+
+	var hr helmapi.HelmRelease
+	if err := r.Get(ctx, req.NamespacedName, &hr); apierrors.IsNotFound(err) {
+		return ctrl.Result{}, r.syncConsole(ctx, source, nil, nil)
+	} else if err != nil {
+		return ctrl.Result{}, err
+	}
+	if !isACE(&hr) || hr.DeletionTimestamp != nil {
+		return ctrl.Result{}, r.syncConsole(ctx, source, &hr, nil)
+	}
+
+	url, err := r.aceURL(ctx, &hr)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if url == "" {
+		log.FromContext(ctx).V(1).Info("waiting for the ingress host of ace")
+		return ctrl.Result{}, r.syncConsole(ctx, source, &hr, nil)
+	}
+
+	name := hr.Namespace + "-" + hr.Name
+	objs := []*unstructured.Unstructured{consoleLink(name, url)}
+	if r.PluginService != "" {
+		objs = append(objs, consolePlugin(name, hr.GetReleaseNamespace(), r.PluginService, r.PluginPort))
+	}
+	return ctrl.Result{}, r.syncConsole(ctx, source, &hr, objs)
+}
+
+// consoleSource returns the KeyConsoleSource annotation of the console objects of a
+// release.
+func consoleSource(key client.ObjectKey) string {
+	return "HelmRelease/" + key.Namespace + "/" + key.Name
+}
+
+// parseConsoleSource returns the HelmRelease of a KeyConsoleSource annotation.
+func parseConsoleSource(source string) (client.ObjectKey, bool) {
+	parts := strings.Split(source, "/")
+	if len(parts) != 3 || parts[0] != "HelmRelease" || parts[1] == "" || parts[2] == "" {
+		return client.ObjectKey{}, false
+	}
+	return client.ObjectKey{Namespace: parts[1], Name: parts[2]}, true
+}
+
+func isACE(hr *helmapi.HelmRelease) bool {
+	return hr.Spec.Chart != nil && hr.Spec.Chart.Spec.Chart == "ace"
+}
+
+// aceURL returns the URL of the ACE UI, from the first host of the Ingresses the
+// release installed, or of its Routes if it has no Ingress. Hosts with TLS are
+// preferred.
+func (r *ConsoleReconciler) aceURL(ctx context.Context, hr *helmapi.HelmRelease) (string, error) {
+	ns := hr.GetReleaseNamespace()
+	installedBy := func(obj client.Object) bool {
+		a := obj.GetAnnotations()
+		return a[tracker.KeyHelmReleaseName] == hr.GetReleaseName() && a[tracker.KeyHelmReleaseNamespace] == ns
+	}
+
+	var ingresses networking.IngressList
+	if err := r.List(ctx, &ingresses, client.InNamespace(ns)); err != nil {
+		return "", err
+	}
+	var routes unstructured.UnstructuredList
+	routes.SetGroupVersionKind(RouteGVK.GroupVersion().WithKind("RouteList"))
+	if err := r.List(ctx, &routes, client.InNamespace(ns)); err != nil {
+		return "", err
+	}
+	ingresses.Items = slices.DeleteFunc(ingresses.Items, func(ing networking.Ingress) bool {
+		return !installedBy(&ing)
+	})
+	routes.Items = slices.DeleteFunc(routes.Items, func(rt unstructured.Unstructured) bool {
+		return !installedBy(&rt)
+	})
+	return ingressURL(ingresses.Items, routes.Items), nil
+}
+
+// ingressURL returns the URL of the first host of the Ingresses, or of the Routes if
+// no Ingress has a host, by name. Hosts with TLS are preferred.
+func ingressURL(ingresses []networking.Ingress, routes []unstructured.Unstructured) string {
+	sort.Slice(ingresses, func(i, j int) bool {
+		return ingresses[i].Name < ingresses[j].Name
+	})
+	var plain string
+	for i := range ingresses {
+		ing := &ingresses[i]
+		for _, t := range ing.Spec.TLS {
+			for _, host := range t.Hosts {
+				if host != "" {
+					return "https://" + host
+				}
+			}
+		}
+		for _, rule := range ing.Spec.Rules {
+			if rule.Host != "" && plain == "" {
+				plain = "http://" + rule.Host
+			}
+		}
+	}
+	if plain != "" {
+		return plain
+	}
+
+	sort.Slice(routes, func(i, j int) bool {
+		return routes[i].GetName() < routes[j].GetName()
+	})
+	for i := range routes {
+		rt := &routes[i]
+		host, _, _ := unstructured.NestedString(rt.Object, "spec", "host")
+		if host == "" {
+			continue
+		}
+		if _, ok, _ := unstructured.NestedMap(rt.Object, "spec", "tls"); ok {
+			return "https://" + host
+		}
+		if plain == "" {
+			plain = "http://" + host
+		}
+	}
+	return plain
+}
+
+func consoleLink(name, url string) *unstructured.Unstructured {
+	var u unstructured.Unstructured
+	u.SetGroupVersionKind(ConsoleLinkGVK)
+	u.SetName(name)
+	u.Object["spec"] = map[string]any{
+		"href":     url,
+		"text":     consoleText,
+		"location": "ApplicationMenu",
+		"applicationMenu": map[string]any{
+			"section": consoleSection,
+		},
+	}
+	return &u
+}
+
+func consolePlugin(name, ns, service string, port int32) *unstructured.Unstructured {
+	var u unstructured.Unstructured
+	u.SetGroupVersionKind(ConsolePluginGVK)
+	u.SetName(name)
+	u.Object["spec"] = map[string]any{
+		"displayName": consoleText,
+		"backend": map[string]any{
+			"type": "Service",
+			"service": map[string]any{
+				"name":      service,
+				"namespace": ns,
+				"port":      int64(port),
+				"basePath":  "/",
+			},
+		},
+	}
+	return &u
+}
+
+// syncConsole creates or updates the desired console objects of a release, deletes
+// the ones generated for it earlier that are no longer desired, and enables its
+// ConsolePlugins in the console operator config.
+func (r *ConsoleReconciler) syncConsole(ctx context.Context, source string, owner client.Object, objs []*unstructured.Unstructured) error {
+	log := log.FromContext(ctx)
+	hash := shortHash(source)
+
+	keep := map[schema.GroupVersionKind]map[string]bool{}
+	var plugins []string
+	for _, desired := range objs {
+		gvk := desired.GroupVersionKind()
+		if keep[gvk] == nil {
+			keep[gvk] = map[string]bool{}
+		}
+		keep[gvk][desired.GetName()] = true
+		if gvk == ConsolePluginGVK {
+			plugins = append(plugins, desired.GetName())
+		}
+
+		var u unstructured.Unstructured
+		u.SetGroupVersionKind(gvk)
+		u.SetName(desired.GetName())
+		result, err := controllerutil.CreateOrPatch(ctx, r.Client, &u, func() error {
+			labels := u.GetLabels()
+			if labels == nil {
+				labels = map[string]string{}
+			}
+			labels[tracker.LabelManagedBy] = tracker.ManagedBy
+			labels[LabelConsoleSource] = hash
+			u.SetLabels(labels)
+			annotations := u.GetAnnotations()
+			if annotations == nil {
+				annotations = map[string]string{}
+			}
+			annotations[KeyConsoleSource] = source
+			u.SetAnnotations(annotations)
+			u.Object["spec"] = desired.Object["spec"]
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		if r.DryRun {
+			reportDryRun(ctx, r.Recorder, owner, "console", gvk.Kind, u.GetName(), result)
+		} else if result != controllerutil.OperationResultNone {
+			log.Info(fmt.Sprintf("%s %s %s", result, gvk.Kind, u.GetName()))
+			if owner != nil {
+				r.Recorder.Eventf(owner, core.EventTypeNormal, EventReasonConsoleSynced, "%s %s %s", result, gvk.Kind, u.GetName())
+			}
+		}
+	}
+
+	var stale []*unstructured.Unstructured
+	var disabled []string
+	for _, gvk := range consoleGVKs {
+		var list unstructured.UnstructuredList
+		list.SetGroupVersionKind(gvk.GroupVersion().WithKind(gvk.Kind + "List"))
+		if err := r.List(ctx, &list, client.MatchingLabels{LabelConsoleSource: hash}); err != nil {
+			return err
+		}
+		for i := range list.Items {
+			u := &list.Items[i]
+			if keep[gvk][u.GetName()] || u.GetAnnotations()[KeyConsoleSource] != source {
+				continue
+			}
+			if gvk == ConsolePluginGVK {
+				disabled = append(disabled, u.GetName())
+			}
+			u.SetGroupVersionKind(gvk)
+			stale = append(stale, u)
+		}
+	}
+	// disable the plugins first, so that a failed cleanup is retried while their
+	// ConsolePlugins still exist
+	if err := r.enablePlugins(ctx, owner, plugins, disabled); err != nil {
+		return err
+	}
+	for _, u := range stale {
+		if err := r.Delete(ctx, u); client.IgnoreNotFound(err) != nil {
+			return err
+		}
+		if r.DryRun {
+			reportDryRun(ctx, r.Recorder, owner, "console", u.GetKind(), u.GetName(), "deleted")
+		} else {
+			log.Info(fmt.Sprintf("deleted %s %s", u.GetKind(), u.GetName()))
+		}
+	}
+	return nil
+}
+
+// enablePlugins adds the enabled plugins to the console operator config and removes
+// the disabled ones. Plugins enabled by the cluster admin are left alone.
+func (r *ConsoleReconciler) enablePlugins(ctx context.Context, owner client.Object, enabled, disabled []string) error {
+	if len(enabled) == 0 && len(disabled) == 0 {
+		return nil
+	}
+	var console unstructured.Unstructured
+	console.SetGroupVersionKind(ConsoleGVK)
+	if err := r.Get(ctx, client.ObjectKey{Name: ConsoleName}, &console); apierrors.IsNotFound(err) {
+		log.FromContext(ctx).Info("console operator config not found, plugins are not enabled")
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	plugins, _, _ := unstructured.NestedStringSlice(console.Object, "spec", "plugins")
+	desired := desiredPlugins(plugins, enabled, disabled)
+	if slices.Equal(plugins, desired) {
+		return nil
+	}
+
+	patch := client.MergeFromWithOptions(console.DeepCopy(), client.MergeFromWithOptimisticLock{})
+	if err := unstructured.SetNestedStringSlice(console.Object, desired, "spec", "plugins"); err != nil {
+		return err
+	}
+	if err := r.Patch(ctx, &console, patch); err != nil {
+		return err
+	}
+	if r.DryRun {
+		reportDryRun(ctx, r.Recorder, owner, "console", ConsoleGVK.Kind, ConsoleName, controllerutil.OperationResultUpdated)
+	} else {
+		log.FromContext(ctx).Info("updated console plugins", "plugins", desired)
+	}
+	return nil
+}
+
+// desiredPlugins returns the plugins of the console operator config with the disabled
+// plugins removed and the enabled ones appended, keeping the order of the others.
+func desiredPlugins(plugins, enabled, disabled []string) []string {
+	desired := slices.DeleteFunc(slices.Clone(plugins), func(p string) bool {
+		return slices.Contains(disabled, p)
+	})
+	for _, p := range enabled {
+		if !slices.Contains(desired, p) {
+			desired = append(desired, p)
+		}
+	}
+	return desired
+}
+
+// collectGarbage removes the console objects and plugins of the releases that were
+// deleted, or are no longer ace releases, while aceshifter was not running, as their
+// reconcile was missed.
+func (r *ConsoleReconciler) collectGarbage(ctx context.Context) error {
+	log := log.FromContext(ctx).WithName("console-gc")
+
+	sources := map[string]bool{}
+	for _, gvk := range consoleGVKs {
+		var list unstructured.UnstructuredList
+		list.SetGroupVersionKind(gvk.GroupVersion().WithKind(gvk.Kind + "List"))
+		if err := r.List(ctx, &list, client.MatchingLabels{tracker.LabelManagedBy: tracker.ManagedBy}); err != nil {
+			log.Error(err, "unable to list console objects", "kind", gvk.Kind)
+			return nil
+		}
+		for _, u := range list.Items {
+			if source := u.GetAnnotations()[KeyConsoleSource]; source != "" {
+				sources[source] = true
+			}
+		}
+	}
+
+	for source := range sources {
+		key, ok := parseConsoleSource(source)
+		if !ok {
+			continue
+		}
+		var hr helmapi.HelmRelease
+		err := r.Get(ctx, key, &hr)
+		if err == nil && isACE(&hr) {
+			continue
+		} else if client.IgnoreNotFound(err) != nil {
+			log.Error(err, "unable to get helmrelease", "source", source)
+			continue
+		}
+		if err := r.syncConsole(ctx, source, nil, nil); err != nil {
+			log.Error(err, "unable to remove console objects", "source", source)
+		}
+	}
+	return nil
+}
+
+// SetupWithManager sets up the controller with the Manager. It is not set up if the
+// console API is not installed.
+func (r *ConsoleReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	if _, err := mgr.GetRESTMapper().RESTMapping(ConsoleLinkGVK.GroupKind(), ConsoleLinkGVK.Version); err != nil {
+		log.Log.Info("OpenShift console API not found, ACE is not registered with the console")
+		return nil
+	}
+
+	mapToRelease := func(ctx context.Context, obj client.Object) []reconcile.Request {
+		name := obj.GetAnnotations()[tracker.KeyHelmReleaseName]
+		ns := obj.GetAnnotations()[tracker.KeyHelmReleaseNamespace]
+		if name == "" {
+			return nil
+		}
+		var list helmapi.HelmReleaseList
+		if err := r.List(ctx, &list); err != nil {
+			log.FromContext(ctx).Error(err, "unable to list helmreleases")
+			return nil
+		}
+		var reqs []reconcile.Request
+		for i := range list.Items {
+			hr := &list.Items[i]
+			if isACE(hr) && hr.GetReleaseName() == name && hr.GetReleaseNamespace() == ns {
+				reqs = append(reqs, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(hr)})
+			}
+		}
+		return reqs
+	}
+
+	// runs once on the leader, after the caches are synced
+	if err := mgr.Add(manager.RunnableFunc(r.collectGarbage)); err != nil {
+		return err
+	}
+
+	routeObj := &unstructured.Unstructured{}
+	routeObj.SetGroupVersionKind(RouteGVK)
+	return ctrl.NewControllerManagedBy(mgr).
+		Named("console").
+		For(&helmapi.HelmRelease{}, builder.WithPredicates(
+			predicate.GenerationChangedPredicate{},
+			predicate.NewPredicateFuncs(func(obj client.Object) bool {
+				hr, ok := obj.(*helmapi.HelmRelease)
+				return ok && isACE(hr)
+			}))).
+		Watches(&networking.Ingress{}, handler.EnqueueRequestsFromMapFunc(mapToRelease)).
+		Watches(routeObj, handler.EnqueueRequestsFromMapFunc(mapToRelease)).
+		Complete(r)
+}
@@ -0,0 +1,215 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"go.bytebuilders.dev/aceshifter/pkg/tracker"
+
+	helmapi "github.com/fluxcd/helm-controller/api/v2"
+	networking "k8s.io/api/networking/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func TestConsoleSource(t *testing.T) {
+	key := client.ObjectKey{Namespace: "ace", Name: "ace"}
+	if got, ok := parseConsoleSource(consoleSource(key)); !ok || got != key {
+		t.Errorf("expected %v, got %v", key, got)
+	}
+	for _, source := range []string{"", "HelmRelease/ace", "Feature/ace/ace", "HelmRelease//ace"} {
+		if _, ok := parseConsoleSource(source); ok {
+			t.Errorf("expected %q to be invalid", source)
+		}
+	}
+}
+
+func TestIngressURL(t *testing.T) {
+	ingress := func(name string, tlsHost string, hosts ...string) networking.Ingress {
+		ing := networking.Ingress{ObjectMeta: metav1.ObjectMeta{Name: name}}
+		if tlsHost != "" {
+			ing.Spec.TLS = []networking.IngressTLS{{Hosts: []string{tlsHost}}}
+		}
+		for _, h := range hosts {
+			ing.Spec.Rules = append(ing.Spec.Rules, networking.IngressRule{Host: h})
+		}
+		return ing
+	}
+	route := func(name, host string, tls bool) unstructured.Unstructured {
+		u := unstructured.Unstructured{Object: map[string]any{"spec": map[string]any{"host": host}}}
+		if tls {
+			u.Object["spec"].(map[string]any)["tls"] = map[string]any{"termination": "edge"}
+		}
+		u.SetName(name)
+		return u
+	}
+
+	for _, tt := range []struct {
+		name      string
+		ingresses []networking.Ingress
+		routes    []unstructured.Unstructured
+		want      string
+	}{
+		{name: "none"},
+		{
+			name:      "tls host wins",
+			ingresses: []networking.Ingress{ingress("a", "", "plain.example.com"), ingress("b", "ace.example.com")},
+			want:      "https://ace.example.com",
+		},
+		{
+			name:      "first plain host by name",
+			ingresses: []networking.Ingress{ingress("b", "", "b.example.com"), ingress("a", "", "a.example.com")},
+			routes:    []unstructured.Unstructured{route("r", "route.example.com", true)},
+			want:      "http://a.example.com",
+		},
+		{
+			name:   "routes without ingress hosts",
+			routes: []unstructured.Unstructured{route("a", "a.example.com", false), route("b", "b.example.com", true)},
+			want:   "https://b.example.com",
+		},
+	} {
+		if got := ingressURL(tt.ingresses, tt.routes); got != tt.want {
+			t.Errorf("%s: expected %q, got %q", tt.name, tt.want, got)
+		}
+	}
+}
+
+func TestDesiredPlugins(t *testing.T) {
+	got := desiredPlugins([]string{"monitoring", "ace-old", "ace-ace"}, []string{"ace-ace", "ace-new"}, []string{"ace-old"})
+	expected := []string{"monitoring", "ace-ace", "ace-new"}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+}
+
+func TestConsoleCollectGarbage(t *testing.T) {
+	generated := func(gvk schema.GroupVersionKind, name string, key client.ObjectKey) *unstructured.Unstructured {
+		var u unstructured.Unstructured
+		u.SetGroupVersionKind(gvk)
+		u.SetName(name)
+		source := consoleSource(key)
+		u.SetLabels(map[string]string{tracker.LabelManagedBy: tracker.ManagedBy, LabelConsoleSource: shortHash(source)})
+		u.SetAnnotations(map[string]string{KeyConsoleSource: source})
+		return &u
+	}
+	live := client.ObjectKey{Namespace: "ace", Name: "ace"}
+	deleted := client.ObjectKey{Namespace: "old", Name: "ace"}
+	changed := client.ObjectKey{Namespace: "other", Name: "ace"}
+
+	var console unstructured.Unstructured
+	console.SetGroupVersionKind(ConsoleGVK)
+	console.SetName(ConsoleName)
+	console.Object["spec"] = map[string]any{"plugins": []any{"monitoring", "ace-ace", "old-ace", "other-ace"}}
+
+	kc := &fakeConsoleClient{
+		objects: []*unstructured.Unstructured{
+			&console,
+			generated(ConsoleLinkGVK, "ace-ace", live),
+			generated(ConsolePluginGVK, "ace-ace", live),
+			generated(ConsoleLinkGVK, "old-ace", deleted),
+			generated(ConsolePluginGVK, "old-ace", deleted),
+			generated(ConsolePluginGVK, "other-ace", changed),
+		},
+		releases: map[client.ObjectKey]*helmapi.HelmRelease{
+			live:    {Spec: helmapi.HelmReleaseSpec{Chart: &helmapi.HelmChartTemplate{Spec: helmapi.HelmChartTemplateSpec{Chart: "ace"}}}},
+			changed: {Spec: helmapi.HelmReleaseSpec{Chart: &helmapi.HelmChartTemplate{Spec: helmapi.HelmChartTemplateSpec{Chart: "nginx"}}}},
+		},
+	}
+	r := &ConsoleReconciler{Client: kc}
+	if err := r.collectGarbage(context.TODO()); err != nil {
+		t.Fatal(err)
+	}
+
+	var left []string
+	for _, u := range kc.objects {
+		if u.GroupVersionKind() != ConsoleGVK {
+			left = append(left, u.GetKind()+"/"+u.GetName())
+		}
+	}
+	sort.Strings(left)
+	if expected := []string{"ConsoleLink/ace-ace", "ConsolePlugin/ace-ace"}; !reflect.DeepEqual(left, expected) {
+		t.Errorf("expected %v to be left, got %v", expected, left)
+	}
+	plugins, _, _ := unstructured.NestedStringSlice(console.Object, "spec", "plugins")
+	if expected := []string{"monitoring", "ace-ace"}; !reflect.DeepEqual(plugins, expected) {
+		t.Errorf("expected plugins %v, got %v", expected, plugins)
+	}
+}
+
+// fakeConsoleClient serves the console objects and the HelmReleases read by the
+// console garbage collection.
+type fakeConsoleClient struct {
+	client.Client
+	objects  []*unstructured.Unstructured
+	releases map[client.ObjectKey]*helmapi.HelmRelease
+}
+
+func (c *fakeConsoleClient) Get(_ context.Context, key client.ObjectKey, obj client.Object, _ ...client.GetOption) error {
+	switch o := obj.(type) {
+	case *helmapi.HelmRelease:
+		if hr, ok := c.releases[key]; ok {
+			hr.DeepCopyInto(o)
+			return nil
+		}
+	case *unstructured.Unstructured:
+		for _, u := range c.objects {
+			if u.GroupVersionKind() == o.GroupVersionKind() && u.GetName() == key.Name {
+				o.Object = u.Object
+				return nil
+			}
+		}
+	}
+	return apierrors.NewNotFound(schema.GroupResource{}, key.Name)
+}
+
+func (c *fakeConsoleClient) List(_ context.Context, list client.ObjectList, opts ...client.ListOption) error {
+	ul := list.(*unstructured.UnstructuredList)
+	kind := strings.TrimSuffix(ul.GetKind(), "List")
+	var lo client.ListOptions
+	lo.ApplyOptions(opts)
+	for _, u := range c.objects {
+		if u.GetKind() == kind && (lo.LabelSelector == nil || lo.LabelSelector.Matches(labels.Set(u.GetLabels()))) {
+			ul.Items = append(ul.Items, *u.DeepCopy())
+		}
+	}
+	return nil
+}
+
+func (c *fakeConsoleClient) Delete(_ context.Context, obj client.Object, _ ...client.DeleteOption) error {
+	u := obj.(*unstructured.Unstructured)
+	for i, o := range c.objects {
+		if o.GroupVersionKind() == u.GroupVersionKind() && o.GetName() == u.GetName() {
+			c.objects = append(c.objects[:i], c.objects[i+1:]...)
+			return nil
+		}
+	}
+	return apierrors.NewNotFound(schema.GroupResource{}, u.GetName())
+}
+
+func (c *fakeConsoleClient) Patch(context.Context, client.Object, client.Patch, ...client.PatchOption) error {
+	// Get shares the stored object, the patched object is already in place
+	return nil
+}
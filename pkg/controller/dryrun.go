@@ -0,0 +1,75 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+
+	core "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	EventReasonDryRun = "DryRun"
+
+	dryRunPrefix = "[dry-run] "
+)
+
+// NewDryRunClient returns a client that sends every write as a server-side dry-run,
+// so that admission and validation run but nothing is persisted.
+func NewDryRunClient(c client.Client) client.Client {
+	return client.NewDryRunClient(c)
+}
+
+// NewDryRunRecorder returns a recorder that marks the message of every event as a
+// change that was not applied.
+func NewDryRunRecorder(recorder record.EventRecorder) record.EventRecorder {
+	return dryRunRecorder{recorder}
+}
+
+type dryRunRecorder struct {
+	record.EventRecorder
+}
+
+func (r dryRunRecorder) Event(object runtime.Object, eventtype, reason, message string) {
+	r.EventRecorder.Event(object, eventtype, reason, dryRunPrefix+message)
+}
+
+func (r dryRunRecorder) Eventf(object runtime.Object, eventtype, reason, messageFmt string, args ...any) {
+	r.EventRecorder.Eventf(object, eventtype, reason, dryRunPrefix+messageFmt, args...)
+}
+
+func (r dryRunRecorder) AnnotatedEventf(object runtime.Object, annotations map[string]string, eventtype, reason, messageFmt string, args ...any) {
+	r.EventRecorder.AnnotatedEventf(object, annotations, eventtype, reason, dryRunPrefix+messageFmt, args...)
+}
+
+// reportDryRun logs, records and counts a change that was computed but not persisted.
+// The event is skipped if recorder or obj is nil.
+func reportDryRun(ctx context.Context, recorder record.EventRecorder, obj runtime.Object, controller, kind, name string, result controllerutil.OperationResult) {
+	if result == controllerutil.OperationResultNone {
+		return
+	}
+	log.FromContext(ctx).Info("dry-run: change not persisted", "kind", kind, "name", name, "operation", result)
+	dryRunChanges.WithLabelValues(controller, kind, string(result)).Inc()
+	if recorder != nil && obj != nil {
+		recorder.Eventf(obj, core.EventTypeNormal, EventReasonDryRun, "would have %s %s %s", result, kind, name)
+	}
+}
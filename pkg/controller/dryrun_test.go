@@ -0,0 +1,196 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"go.bytebuilders.dev/aceshifter/pkg/tracker"
+
+	dto "github.com/prometheus/client_model/go"
+	core "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+func TestDryRunClient(t *testing.T) {
+	kc := &fakeWriteClient{}
+	dc := NewDryRunClient(kc)
+	cm := &core.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: tracker.OverlayNamespace, Name: tracker.OverlayName}}
+
+	ctx := context.TODO()
+	if err := dc.Create(ctx, cm); err != nil {
+		t.Fatal(err)
+	}
+	if err := dc.Update(ctx, cm); err != nil {
+		t.Fatal(err)
+	}
+	if err := dc.Patch(ctx, cm, client.MergeFrom(cm.DeepCopy())); err != nil {
+		t.Fatal(err)
+	}
+	if err := dc.Delete(ctx, cm); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string][]string{
+		"create": {metav1.DryRunAll},
+		"update": {metav1.DryRunAll},
+		"patch":  {metav1.DryRunAll},
+		"delete": {metav1.DryRunAll},
+	}
+	if !reflect.DeepEqual(kc.dryRun, expected) {
+		t.Errorf("expected dry-run options %v, got %v", expected, kc.dryRun)
+	}
+}
+
+func TestDryRunRecorder(t *testing.T) {
+	recorder := record.NewFakeRecorder(10)
+	dr := NewDryRunRecorder(recorder)
+	obj := &core.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "ace"}}
+
+	dr.Event(obj, core.EventTypeNormal, EventReasonInstallGated, "suspended")
+	checkEvent(t, recorder, core.EventTypeNormal+" "+EventReasonInstallGated+" "+dryRunPrefix+"suspended")
+	dr.Eventf(obj, core.EventTypeWarning, EventReasonRangeConflict, "range %s", "1000000/10000")
+	checkEvent(t, recorder, core.EventTypeWarning+" "+EventReasonRangeConflict+" "+dryRunPrefix+"range 1000000/10000")
+}
+
+func TestReportDryRun(t *testing.T) {
+	obj := &core.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "ace"}}
+	tests := []struct {
+		name     string
+		result   controllerutil.OperationResult
+		obj      *core.Namespace
+		observed float64
+		event    string
+	}{
+		{
+			name:   "unchanged",
+			result: controllerutil.OperationResultNone,
+			obj:    obj,
+		},
+		{
+			name:     "created",
+			result:   controllerutil.OperationResultCreated,
+			obj:      obj,
+			observed: 1,
+			event:    core.EventTypeNormal + " " + EventReasonDryRun + " would have created ConfigMap demo",
+		},
+		{
+			name:     "without object",
+			result:   controllerutil.OperationResultUpdated,
+			observed: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := record.NewFakeRecorder(10)
+			before := dryRunObservations(t, "test", "ConfigMap", tt.result)
+
+			var obj client.Object
+			if tt.obj != nil {
+				obj = tt.obj
+			}
+			reportDryRun(context.TODO(), recorder, obj, "test", "ConfigMap", "demo", tt.result)
+			if observed := dryRunObservations(t, "test", "ConfigMap", tt.result) - before; observed != tt.observed {
+				t.Errorf("expected %v dry-run changes, got %v", tt.observed, observed)
+			}
+			checkEvent(t, recorder, tt.event)
+		})
+	}
+}
+
+func TestReconcileDryRun(t *testing.T) {
+	kc := &fakeReleaseClient{hr: aceRelease()}
+	recorder := record.NewFakeRecorder(10)
+	r := &HelmReleaseReconciler{
+		Client:            NewDryRunClient(kc),
+		Recorder:          NewDryRunRecorder(recorder),
+		NamespaceTemplate: tracker.DefaultNamespaceTemplate(),
+		DryRun:            true,
+	}
+	before := dryRunObservations(t, "helmrelease", "Namespace", controllerutil.OperationResultCreated)
+
+	if _, err := r.Reconcile(context.TODO(), ctrl.Request{NamespacedName: client.ObjectKeyFromObject(kc.hr)}); err != nil {
+		t.Fatal(err)
+	}
+	if len(kc.creates) != 1 || !reflect.DeepEqual(kc.creates[0].DryRun, []string{metav1.DryRunAll}) {
+		t.Fatalf("expected a dry-run create, got %+v", kc.creates)
+	}
+	if len(kc.namespaces) != 0 {
+		t.Errorf("expected the namespace not to be persisted, got %+v", kc.namespaces[0].ObjectMeta)
+	}
+	if observed := dryRunObservations(t, "helmrelease", "Namespace", controllerutil.OperationResultCreated) - before; observed != 1 {
+		t.Errorf("expected 1 dry-run change, got %v", observed)
+	}
+	checkEvent(t, recorder, core.EventTypeNormal+" "+EventReasonDryRun+" "+dryRunPrefix+"would have created Namespace ace")
+}
+
+// dryRunObservations returns the number of dry-run changes counted so far.
+func dryRunObservations(t *testing.T, controller, kind string, result controllerutil.OperationResult) float64 {
+	t.Helper()
+	var m dto.Metric
+	if err := dryRunChanges.WithLabelValues(controller, kind, string(result)).Write(&m); err != nil {
+		t.Fatal(err)
+	}
+	return m.GetCounter().GetValue()
+}
+
+// fakeWriteClient records the dry-run option of the writes it receives.
+type fakeWriteClient struct {
+	client.Client
+	dryRun map[string][]string
+}
+
+func (c *fakeWriteClient) record(verb string, dryRun []string) {
+	if c.dryRun == nil {
+		c.dryRun = map[string][]string{}
+	}
+	c.dryRun[verb] = dryRun
+}
+
+func (c *fakeWriteClient) Create(_ context.Context, _ client.Object, opts ...client.CreateOption) error {
+	var o client.CreateOptions
+	o.ApplyOptions(opts)
+	c.record("create", o.DryRun)
+	return nil
+}
+
+func (c *fakeWriteClient) Update(_ context.Context, _ client.Object, opts ...client.UpdateOption) error {
+	var o client.UpdateOptions
+	o.ApplyOptions(opts)
+	c.record("update", o.DryRun)
+	return nil
+}
+
+func (c *fakeWriteClient) Patch(_ context.Context, _ client.Object, _ client.Patch, opts ...client.PatchOption) error {
+	var o client.PatchOptions
+	o.ApplyOptions(opts)
+	c.record("patch", o.DryRun)
+	return nil
+}
+
+func (c *fakeWriteClient) Delete(_ context.Context, _ client.Object, opts ...client.DeleteOption) error {
+	var o client.DeleteOptions
+	o.ApplyOptions(opts)
+	c.record("delete", o.DryRun)
+	return nil
+}
@@ -0,0 +1,58 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"crypto/fips140"
+	"runtime/debug"
+	"strconv"
+
+	"go.bytebuilders.dev/aceshifter/pkg/featuresets"
+	"go.bytebuilders.dev/aceshifter/pkg/tracker"
+)
+
+const EventReasonFIPSNonCompliant = "FIPSNonCompliant"
+
+// fips returns true if the FIPS overlays are rendered, resolving FIPSModeAuto from
+// the cluster.
+func (r *HelmReleaseReconciler) fips(ctx context.Context) (bool, error) {
+	switch r.FIPSMode {
+	case featuresets.FIPSModeOn:
+		return true, nil
+	case featuresets.FIPSModeAuto:
+		return tracker.FIPSEnabled(ctx, r.Client)
+	}
+	return false, nil
+}
+
+// FIPSModule returns the Go FIPS 140-3 module aceshifter was built with, selected
+// by GOFIPS140 at build time, or "off".
+func FIPSModule() string {
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, s := range info.Settings {
+			if s.Key == "GOFIPS140" && s.Value != "" {
+				return s.Value
+			}
+		}
+	}
+	return "off"
+}
+
+func init() {
+	fipsBuildInfo.WithLabelValues(FIPSModule(), strconv.FormatBool(fips140.Enabled())).Set(1)
+}
@@ -0,0 +1,107 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"time"
+
+	"go.bytebuilders.dev/aceshifter/pkg/featuresets"
+	"go.bytebuilders.dev/aceshifter/pkg/tracker"
+
+	helmapi "github.com/fluxcd/helm-controller/api/v2"
+	core "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	// KeyGatedAt marks a HelmRelease suspended by aceshifter until its overlay is ready.
+	KeyGatedAt = "aceshifter.appscode.com/gated-at"
+
+	EventReasonInstallGated   = "InstallGated"
+	EventReasonInstallResumed = "InstallResumed"
+)
+
+// gate suspends a HelmRelease that was never installed, so that Flux does not
+// install it before its SCC overlay is written.
+func (r *HelmReleaseReconciler) gate(ctx context.Context, hr *helmapi.HelmRelease) error {
+	if !r.GateInstall || hr.Spec.Suspend || len(hr.Status.History) > 0 {
+		return nil
+	}
+
+	patch := client.MergeFrom(hr.DeepCopy())
+	hr.Spec.Suspend = true
+	metav1.SetMetaDataAnnotation(&hr.ObjectMeta, KeyGatedAt, time.Now().UTC().Format(time.RFC3339))
+	if err := r.Patch(ctx, hr, patch); err != nil {
+		return err
+	}
+	if r.DryRun {
+		reportDryRun(ctx, nil, nil, "helmrelease", "HelmRelease", hr.Namespace+"/"+hr.Name, controllerutil.OperationResultUpdated)
+		return nil
+	}
+	log.FromContext(ctx).Info("suspended helmrelease until its overlay is ready")
+	r.Recorder.Event(hr, core.EventTypeNormal, EventReasonInstallGated, "suspended until the SCC overlay is ready")
+	return nil
+}
+
+// gateUnwritten gates a HelmRelease that was never installed as long as its overlay
+// is not written, whatever holds up the rendering of the overlay.
+func (r *HelmReleaseReconciler) gateUnwritten(ctx context.Context, hr *helmapi.HelmRelease) error {
+	if !r.GateInstall || hr.Spec.Suspend || len(hr.Status.History) > 0 {
+		return nil
+	}
+	var cm core.ConfigMap
+	err := r.Get(ctx, client.ObjectKey{Namespace: tracker.OverlayNamespace, Name: tracker.OverlayName}, &cm)
+	if client.IgnoreNotFound(err) != nil {
+		return err
+	}
+	if _, ok := cm.Data[featuresets.OverlayKey(hr)]; ok {
+		return nil
+	}
+	return r.gate(ctx, hr)
+}
+
+// ungate resumes a HelmRelease suspended by gate and records how long it was held.
+func (r *HelmReleaseReconciler) ungate(ctx context.Context, hr *helmapi.HelmRelease) error {
+	gatedAt, ok := hr.Annotations[KeyGatedAt]
+	if !ok {
+		return nil
+	}
+
+	patch := client.MergeFrom(hr.DeepCopy())
+	hr.Spec.Suspend = false
+	delete(hr.Annotations, KeyGatedAt)
+	if err := r.Patch(ctx, hr, patch); err != nil {
+		return err
+	}
+	if r.DryRun {
+		reportDryRun(ctx, nil, nil, "helmrelease", "HelmRelease", hr.Namespace+"/"+hr.Name, controllerutil.OperationResultUpdated)
+		return nil
+	}
+
+	var held time.Duration
+	if t, err := time.Parse(time.RFC3339, gatedAt); err == nil {
+		held = time.Since(t).Round(time.Second)
+		gateDuration.Observe(held.Seconds())
+	}
+	log.FromContext(ctx).Info("resumed helmrelease", "held", held.String())
+	r.Recorder.Eventf(hr, core.EventTypeNormal, EventReasonInstallResumed, "resumed after the SCC overlay was ready, held for %s", held)
+	return nil
+}
@@ -0,0 +1,222 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"go.bytebuilders.dev/aceshifter/pkg/tracker"
+
+	helmapi "github.com/fluxcd/helm-controller/api/v2"
+	dto "github.com/prometheus/client_model/go"
+	core "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func TestGateUnwritten(t *testing.T) {
+	release := func(suspend bool, history helmapi.Snapshots) *helmapi.HelmRelease {
+		return &helmapi.HelmRelease{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "kubeops", Name: "demo"},
+			Spec:       helmapi.HelmReleaseSpec{Suspend: suspend},
+			Status:     helmapi.HelmReleaseStatus{History: history},
+		}
+	}
+	overlay := &core.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Namespace: tracker.OverlayNamespace, Name: tracker.OverlayName},
+		Data:       map[string]string{"demo.yaml": "{}\n"},
+	}
+
+	tests := []struct {
+		name    string
+		gate    bool
+		hr      *helmapi.HelmRelease
+		overlay *core.ConfigMap
+		gated   bool
+		event   string
+	}{
+		{
+			name: "gating disabled",
+			hr:   release(false, nil),
+		},
+		{
+			name:  "new release without overlay",
+			gate:  true,
+			hr:    release(false, nil),
+			gated: true,
+			event: core.EventTypeNormal + " " + EventReasonInstallGated,
+		},
+		{
+			name: "new release with an overlay ConfigMap but no key",
+			gate: true,
+			hr:   release(false, nil),
+			overlay: &core.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Namespace: tracker.OverlayNamespace, Name: tracker.OverlayName},
+				Data:       map[string]string{"other.yaml": "{}\n"},
+			},
+			gated: true,
+			event: core.EventTypeNormal + " " + EventReasonInstallGated,
+		},
+		{
+			name:    "new release with its overlay written",
+			gate:    true,
+			hr:      release(false, nil),
+			overlay: overlay,
+		},
+		{
+			name: "installed release",
+			gate: true,
+			hr:   release(false, helmapi.Snapshots{{Version: 1}}),
+		},
+		{
+			name: "release suspended by the user",
+			gate: true,
+			hr:   release(true, nil),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kc := &fakeGateClient{overlay: tt.overlay}
+			recorder := record.NewFakeRecorder(10)
+			r := &HelmReleaseReconciler{Client: kc, Recorder: recorder, GateInstall: tt.gate}
+
+			hr := tt.hr.DeepCopy()
+			if err := r.gateUnwritten(context.TODO(), hr); err != nil {
+				t.Fatal(err)
+			}
+			_, gated := hr.Annotations[KeyGatedAt]
+			if gated != tt.gated {
+				t.Errorf("expected gated %v, got %v", tt.gated, gated)
+			}
+			if gated && !hr.Spec.Suspend {
+				t.Error("expected a gated release to be suspended")
+			}
+			if (kc.patches > 0) != tt.gated {
+				t.Errorf("expected patched %v, got %d patches", tt.gated, kc.patches)
+			}
+			checkEvent(t, recorder, tt.event)
+		})
+	}
+}
+
+func TestUngate(t *testing.T) {
+	gatedAt := time.Now().Add(-time.Minute).UTC().Format(time.RFC3339)
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		suspend     bool
+		resumed     bool
+		observed    uint64
+		event       string
+	}{
+		{
+			name:    "suspended by the user",
+			suspend: true,
+		},
+		{
+			name:        "gated release",
+			annotations: map[string]string{KeyGatedAt: gatedAt},
+			suspend:     true,
+			resumed:     true,
+			observed:    1,
+			event:       core.EventTypeNormal + " " + EventReasonInstallResumed,
+		},
+		{
+			name:        "gated at an unparsable time",
+			annotations: map[string]string{KeyGatedAt: "yesterday"},
+			suspend:     true,
+			resumed:     true,
+			event:       core.EventTypeNormal + " " + EventReasonInstallResumed,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kc := &fakeGateClient{}
+			recorder := record.NewFakeRecorder(10)
+			r := &HelmReleaseReconciler{Client: kc, Recorder: recorder, GateInstall: true}
+			hr := &helmapi.HelmRelease{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "kubeops", Name: "demo", Annotations: tt.annotations},
+				Spec:       helmapi.HelmReleaseSpec{Suspend: tt.suspend},
+			}
+			before := gateObservations(t)
+
+			if err := r.ungate(context.TODO(), hr); err != nil {
+				t.Fatal(err)
+			}
+			if resumed := !hr.Spec.Suspend; resumed != tt.resumed {
+				t.Errorf("expected resumed %v, got %v", tt.resumed, resumed)
+			}
+			if _, ok := hr.Annotations[KeyGatedAt]; ok {
+				t.Errorf("expected %s to be removed", KeyGatedAt)
+			}
+			if observed := gateObservations(t) - before; observed != tt.observed {
+				t.Errorf("expected %d gate duration observations, got %d", tt.observed, observed)
+			}
+			checkEvent(t, recorder, tt.event)
+		})
+	}
+}
+
+// gateObservations returns the number of gate durations observed so far.
+func gateObservations(t *testing.T) uint64 {
+	t.Helper()
+	var m dto.Metric
+	if err := gateDuration.Write(&m); err != nil {
+		t.Fatal(err)
+	}
+	return m.GetHistogram().GetSampleCount()
+}
+
+// checkEvent checks that the recorder got an event starting with expected, or no
+// event if expected is empty.
+func checkEvent(t *testing.T, recorder *record.FakeRecorder, expected string) {
+	t.Helper()
+	var event string
+	select {
+	case event = <-recorder.Events:
+	default:
+	}
+	if !strings.HasPrefix(event, expected) || (expected == "") != (event == "") {
+		t.Errorf("expected event %q, got %q", expected, event)
+	}
+}
+
+// fakeGateClient serves the overlay ConfigMap and counts the HelmRelease patches.
+type fakeGateClient struct {
+	client.Client
+	overlay *core.ConfigMap
+	patches int
+}
+
+func (c *fakeGateClient) Get(_ context.Context, key client.ObjectKey, obj client.Object, _ ...client.GetOption) error {
+	if cm, ok := obj.(*core.ConfigMap); ok && c.overlay != nil && key.Name == tracker.OverlayName {
+		c.overlay.DeepCopyInto(cm)
+		return nil
+	}
+	return apierrors.NewNotFound(schema.GroupResource{}, key.Name)
+}
+
+func (c *fakeGateClient) Patch(_ context.Context, _ client.Object, _ client.Patch, _ ...client.PatchOption) error {
+	c.patches++
+	return nil
+}
@@ -18,17 +18,27 @@ package controller
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
 
 	"go.bytebuilders.dev/aceshifter/pkg/featuresets"
+	"go.bytebuilders.dev/aceshifter/pkg/mirror"
 	"go.bytebuilders.dev/aceshifter/pkg/tracker"
 
 	helmapi "github.com/fluxcd/helm-controller/api/v2"
 	core "k8s.io/api/core/v1"
+	storage "k8s.io/api/storage/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
-	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/tools/record"
 	uiapi "kmodules.xyz/resource-metadata/apis/ui/v1alpha1"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/builder"
@@ -38,12 +48,82 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/predicate"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	EventReasonOverlayRejected   = "OverlayRejected"
+	EventReasonInvalidAnnotation = "InvalidAnnotation"
 )
 
 // HelmReleaseReconciler reconciles a Feature object
 type HelmReleaseReconciler struct {
 	client.Client
-	Scheme *runtime.Scheme
+	Scheme   *runtime.Scheme
+	Recorder record.EventRecorder
+	// UidStrategy is the default uid strategy used when neither the Feature,
+	// the HelmRelease nor the template set one.
+	UidStrategy featuresets.Strategy
+	// UidOffset is the default offset used by the offset uid strategy.
+	UidOffset int64
+	// IngressMode is the default networking overlay, unless the Feature or
+	// HelmRelease sets the featuresets.KeyIngressMode annotation.
+	IngressMode featuresets.IngressMode
+	// ServiceCA renders the service-ca overlays by default, unless the Feature or
+	// HelmRelease sets the featuresets.KeyServiceCA annotation.
+	ServiceCA bool
+	// MonitoringMode is the default monitoring overlay, unless the Feature or
+	// HelmRelease sets the featuresets.KeyMonitoringMode annotation.
+	MonitoringMode featuresets.MonitoringMode
+	// PropagateProxy renders the OpenShift cluster-wide proxy and trusted CA bundle
+	// into the overlays of features that talk to external services.
+	PropagateProxy bool
+	// ImageMirrors rewrite the images of every HelmRelease to their mirrors.
+	ImageMirrors mirror.Rules
+	// ClusterImageMirrors adds the mirrors of the OpenShift ImageDigestMirrorSets,
+	// ImageTagMirrorSets and ImageContentSourcePolicies to ImageMirrors.
+	ClusterImageMirrors bool
+
+	// InfraFeaturesets are the featuresets whose pods are placed on OpenShift infra
+	// nodes, if the cluster has any.
+	InfraFeaturesets []string
+	// ApplyTLSProfile renders the TLS security profile of the cluster API server into
+	// the overlays of components that serve TLS.
+	ApplyTLSProfile bool
+	// FIPSMode renders the FIPS overlays and refuses features that are not FIPS
+	// compliant. FIPSModeAuto detects FIPS clusters and also refuses the features
+	// whose images are not known to support the FIPS mode.
+	FIPSMode featuresets.FIPSMode
+	// StorageOverlays renders the default StorageClass and the volume permission
+	// settings of its CSI driver into the overlays of features with volumes.
+	StorageOverlays bool
+	// SELinuxChangePolicy is set if the API server supports the seLinuxChangePolicy
+	// field of pod security contexts.
+	SELinuxChangePolicy bool
+
+	charts chartCache
+	// NamespaceTemplate is used to create missing target namespaces.
+	// Namespaces are left to the installer if it is nil.
+	NamespaceTemplate *tracker.NamespaceTemplate
+	// PinRanges records the uid range of each target namespace and re-applies it
+	// when the namespace is recreated or restored. The ranges of deleted namespaces
+	// are forgotten once no HelmRelease targets them.
+	PinRanges bool
+	// VolumeRemediation fixes the ownership of PVC data before a uid range change
+	// is rendered into the overlay. Remediation is disabled if it is nil.
+	VolumeRemediation *VolumeRemediation
+	// RestartOnRangeChange restarts the workloads of a HelmRelease when its namespace
+	// uid range changes but its overlay does not.
+	RestartOnRangeChange bool
+	// RestartInterval is how often a HelmRelease whose workloads are restarted for a
+	// uid range change is reconciled to check the last restart and start the next one.
+	// Restarts of different HelmReleases are not limited.
+	RestartInterval time.Duration
+	// GateInstall suspends HelmReleases that were never installed until their overlay is ready.
+	GateInstall bool
+	// DryRun reports the changes instead of persisting them. Client must send writes
+	// as server-side dry-runs, see NewDryRunClient.
+	DryRun bool
 }
 
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
@@ -59,68 +139,478 @@ func (r *HelmReleaseReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 	log := log.FromContext(ctx)
 
 	var hr helmapi.HelmRelease
-	if err := r.Get(ctx, req.NamespacedName, &hr); err != nil {
-		return ctrl.Result{}, client.IgnoreNotFound(err)
+	if err := r.Get(ctx, req.NamespacedName, &hr); apierrors.IsNotFound(err) {
+		// the ranges of the namespaces that only the deleted release targeted can go
+		return ctrl.Result{}, r.pruneRanges(ctx)
+	} else if err != nil {
+		return ctrl.Result{}, err
 	}
 
 	var feature uiapi.Feature
-	var filename string
-	if err := r.Get(ctx, client.ObjectKey{Name: hr.Name}, &feature); err != nil {
-		if apierrors.IsNotFound(err) && hr.Spec.Chart != nil && hr.Spec.Chart.Spec.Chart == "ace" {
-			filename = hr.Name + ".yaml"
-		} else {
-			return ctrl.Result{}, client.IgnoreNotFound(err)
-		}
-	} else {
-		filename = fmt.Sprintf("%s/%s.yaml", feature.Spec.FeatureSet, feature.Name)
+	filename, err := featuresets.TemplateFile(ctx, r.Client, &hr, &feature)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if filename == "" {
+		// the release is no longer managed, resume it if it was gated
+		return ctrl.Result{}, r.ungate(ctx, &hr)
+	}
+	if err := r.gateUnwritten(ctx, &hr); err != nil {
+		return ctrl.Result{}, err
 	}
 
 	ns := core.Namespace{
 		ObjectMeta: metav1.ObjectMeta{
-			Name: hr.Spec.TargetNamespace,
+			Name: hr.GetReleaseNamespace(),
 		},
 	}
 	if err := r.Get(ctx, client.ObjectKeyFromObject(&ns), &ns); apierrors.IsNotFound(err) {
-		if err := r.Create(ctx, &ns); err != nil {
-			return ctrl.Result{}, client.IgnoreAlreadyExists(err)
+		if r.NamespaceTemplate == nil {
+			log.V(1).Info("target namespace not found", "namespace", ns.Name)
+			return ctrl.Result{}, nil
+		}
+		r.NamespaceTemplate.Apply(&ns)
+		if err := r.Create(ctx, &ns); client.IgnoreAlreadyExists(err) != nil {
+			return ctrl.Result{}, err
+		}
+		if r.DryRun {
+			reportDryRun(ctx, r.Recorder, &hr, "helmrelease", "Namespace", ns.Name, controllerutil.OperationResultCreated)
+			return ctrl.Result{}, nil
 		}
+		log.Info("created namespace", "namespace", ns.Name)
+	} else if err != nil {
+		return ctrl.Result{}, err
+	}
+	if err := r.pinRange(ctx, &ns); err != nil {
+		return ctrl.Result{}, err
 	}
 
-	uidStart, _, err := tracker.GetUid(r.Client, ns.Name)
-	if err != nil || uidStart == tracker.UidNone {
+	// the namespace as patched by pinRange, the cache may not have caught up yet
+	uidStart, uidRange, err := tracker.NamespaceUid(&ns)
+	if err != nil {
+		// retried without gating, a transient error must not hold a new release
+		return ctrl.Result{}, err
+	}
+	if uidStart == tracker.UidNone {
+		return ctrl.Result{}, r.gate(ctx, &hr)
+	}
+	opts, err := r.RenderOptions(ctx, &hr, &feature, uidStart, uidRange)
+	var invalid *InvalidAnnotationError
+	if errors.As(err, &invalid) {
+		// retrying won't help, the HelmRelease is reconciled again when its annotations change
+		log.Error(err, "invalid annotation")
+		r.Recorder.Eventf(&hr, core.EventTypeWarning, EventReasonInvalidAnnotation, "%v", invalid.Err)
+		return ctrl.Result{}, r.gate(ctx, &hr)
+	} else if err != nil {
+		return ctrl.Result{}, err
+	}
+	if opts.MonitoringMode == featuresets.MonitoringModeUserWorkload {
+		if err := r.labelForMonitoring(ctx, &ns); err != nil {
+			return ctrl.Result{}, err
+		}
+		if featuresets.QueriesThanos(filename) {
+			if err := r.bindMonitoringView(ctx, ns.Name); err != nil {
+				return ctrl.Result{}, err
+			}
+		}
+	}
+	if opts.Proxy != nil && opts.Proxy.TrustedCA != "" {
+		if err := r.ensureTrustedCABundle(ctx, ns.Name); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
+	if opts.FIPS {
+		reason, refused, err := featuresets.FIPSNonCompliant(filename, r.FIPSMode)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		if refused {
+			log.Info("refused feature on a FIPS cluster", "file", filename, "reason", reason)
+			r.Recorder.Eventf(&hr, core.EventTypeWarning, EventReasonFIPSNonCompliant,
+				"%s can't run on a FIPS cluster: %s", strings.TrimSuffix(filename, ".yaml"), reason)
+			return ctrl.Result{}, r.gate(ctx, &hr)
+		}
+	}
+
+	pending, err := r.chartPending(ctx, &hr, opts)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if pending {
+		log.Info("waiting for the chart defaults to render the overlay")
+		return ctrl.Result{RequeueAfter: chartPollInterval}, r.gate(ctx, &hr)
+	}
+
+	overlay, partial, err := r.renderOverlay(ctx, &hr, &feature, filename, ns.Name, opts)
+	var rejected *RejectedError
+	if errors.As(err, &rejected) {
+		log.Error(err, "rejected overlay", "file", filename)
+		r.Recorder.Eventf(&hr, core.EventTypeWarning, EventReasonOverlayRejected,
+			"overlay %s merged with the Feature values sets ids outside the uid ranges of namespace %s: %v", filename, ns.Name, rejected.Err)
+		return ctrl.Result{}, r.gate(ctx, &hr)
+	} else if err != nil {
 		return ctrl.Result{}, err
 	}
 
 	cm := core.ConfigMap{
 		ObjectMeta: metav1.ObjectMeta{
-			Name:      "ace-openshift-scc",
-			Namespace: "kubeops",
+			Name:      tracker.OverlayName,
+			Namespace: tracker.OverlayNamespace,
 		},
 	}
-	configKey := hr.Name + ".yaml"
-	if hr.Name == "ace" && hr.Namespace == "ace-gw" {
-		configKey = "ace-gw.yaml"
+	if err := r.Get(ctx, client.ObjectKeyFromObject(&cm), &cm); client.IgnoreNotFound(err) != nil {
+		return ctrl.Result{}, err
 	}
-	result, err := controllerutil.CreateOrPatch(ctx, r.Client, &cm, func() error {
-		if cm.Data == nil {
-			cm.Data = map[string]string{}
+	configKey := featuresets.OverlayKey(&hr)
+	renderedUidKey := tracker.KeyRenderedUidPrefix + strings.TrimSuffix(configKey, ".yaml")
+
+	if r.VolumeRemediation != nil {
+		done, err := r.remediateVolumes(ctx, &hr, configKey, cm.Annotations[renderedUidKey], tracker.Range{Start: uidStart, Size: uidRange})
+		if err != nil {
+			return ctrl.Result{}, err
 		}
+		if !done && !r.DryRun {
+			return ctrl.Result{RequeueAfter: remediationPollInterval}, nil
+		}
+	}
 
-		vals, err := featuresets.Render(filename, uidStart)
+	if lastUid := cm.Annotations[renderedUidKey]; r.RestartOnRangeChange &&
+		lastUid != "" && lastUid != strconv.FormatInt(uidStart, 10) && cm.Data[configKey] == overlay {
+		// the overlay does not change with the range, so Flux will not roll the pods
+		done, err := r.restartWorkloads(ctx, &hr, uidStart)
 		if err != nil {
-			cm.Data[configKey] = "{}"
-		} else {
-			cm.Data[configKey] = string(vals)
+			return ctrl.Result{}, err
+		}
+		if !done && !r.DryRun {
+			return ctrl.Result{RequeueAfter: r.RestartInterval}, nil
+		}
+	}
+
+	result, err := controllerutil.CreateOrPatch(ctx, r.Client, &cm, func() error {
+		if cm.Data == nil {
+			cm.Data = map[string]string{}
 		}
+		cm.Data[configKey] = overlay
+		metav1.SetMetaDataAnnotation(&cm.ObjectMeta, renderedUidKey, strconv.FormatInt(uidStart, 10))
 		return nil
 	})
 	if err != nil {
 		return ctrl.Result{}, err
 	}
-	if result != controllerutil.OperationResultNone {
+	if r.DryRun {
+		reportDryRun(ctx, r.Recorder, &hr, "helmrelease", "ConfigMap", tracker.OverlayNamespace+"/"+tracker.OverlayName+" key "+configKey, result)
+		log.V(1).Info("dry-run overlay", "key", configKey, "overlay", overlay)
+	} else if result != controllerutil.OperationResultNone {
 		log.Info(fmt.Sprintf("%s configmap key %s", result, configKey))
 	}
-	return ctrl.Result{}, nil
+	if partial {
+		// render the settings that need the chart defaults once they can be fetched
+		return ctrl.Result{RequeueAfter: chartPollInterval}, r.ungate(ctx, &hr)
+	}
+	return ctrl.Result{}, r.ungate(ctx, &hr)
+}
+
+// RejectedError is returned when a rendered overlay, merged with the values of its
+// Feature, sets ids outside the uid ranges of its namespace.
+type RejectedError struct {
+	Err error
+}
+
+func (e *RejectedError) Error() string {
+	return "rejected overlay: " + e.Err.Error()
+}
+
+func (e *RejectedError) Unwrap() error {
+	return e.Err
+}
+
+// InvalidAnnotationError is returned when an annotation of a HelmRelease or its
+// Feature can't be parsed.
+type InvalidAnnotationError struct {
+	Err error
+}
+
+func (e *InvalidAnnotationError) Error() string {
+	return "invalid annotation: " + e.Err.Error()
+}
+
+func (e *InvalidAnnotationError) Unwrap() error {
+	return e.Err
+}
+
+// renderOverlay renders the featureset template of a HelmRelease and the rewrites of its
+// images to their mirrors, and checks the ids of the result merged over the values of
+// its Feature. An overlay that can't be rendered is replaced by an empty one. It
+// returns true if the overlay was rendered without the chart defaults it needs, see
+// chartDefaults.
+func (r *HelmReleaseReconciler) renderOverlay(ctx context.Context, hr *helmapi.HelmRelease, feature *uiapi.Feature, filename, ns string, opts featuresets.Options) (string, bool, error) {
+	values, err := r.featureValues(ctx, hr, feature)
+	if err != nil {
+		return "", false, err
+	}
+	opts.Values = values
+	rules, err := r.mirrorRules(ctx)
+	if err != nil {
+		return "", false, err
+	}
+	var defaults map[string]any
+	var partial bool
+	if needsChartDefaults(opts, rules) {
+		if defaults, partial, err = r.chartDefaults(ctx, hr); err != nil {
+			return "", false, err
+		}
+	}
+
+	vals, err := featuresets.Render(filename, opts)
+	if errors.Is(err, featuresets.ErrNoTemplate) {
+		log.FromContext(ctx).V(1).Info("feature has no template, rendering an empty overlay", "file", filename)
+		vals = nil
+	} else if err != nil {
+		log.FromContext(ctx).Error(err, "failed to render overlay", "file", filename)
+		vals = nil
+	}
+	if vals == nil {
+		vals = []byte("{}")
+	}
+	var m map[string]any
+	if err := yaml.Unmarshal(vals, &m); err != nil {
+		return "", false, fmt.Errorf("failed to parse overlay %s: %w", filename, err)
+	}
+	// helm replaces the lists of the chart defaults the overlay sets
+	changed := featuresets.MergeDefaultLists(m, defaults)
+	if len(hr.Status.History) > 0 {
+		previous, err := r.previousOverlay(ctx, hr)
+		if err != nil {
+			return "", false, err
+		}
+		if featuresets.KeepStorageClassNames(m, previous) {
+			changed = true
+		}
+	}
+	if opts.TLS != nil {
+		// only charts that declare the tls values are known to read them
+		if dropped := featuresets.DropUndeclaredTLS(m, defaults); len(dropped) > 0 {
+			log.FromContext(ctx).V(1).Info("chart does not declare the tls values", "file", filename, "paths", dropped)
+			changed = true
+		}
+	}
+	if opts.FIPS {
+		images, err := featuresets.FIPSImages(filename, featuresets.MergeValues(defaults, values))
+		if err != nil {
+			return "", false, err
+		}
+		if len(images) > 0 {
+			m = featuresets.MergeValues(m, images)
+			changed = true
+		}
+	}
+	if len(rules) > 0 {
+		if mirrors := mirror.Overlay(featuresets.MergeValues(defaults, values), rules); len(mirrors) > 0 {
+			m = featuresets.MergeValues(m, mirrors)
+			changed = true
+		}
+	}
+	if changed {
+		if vals, err = yaml.Marshal(m); err != nil {
+			return "", false, err
+		}
+	}
+
+	skipPaths := append(featuresets.SkipPaths(feature.Annotations[featuresets.KeySkipPaths]),
+		featuresets.SkipPaths(hr.Annotations[featuresets.KeySkipPaths])...)
+	overlay, merged, err := featuresets.MergeOverlay(vals, values, skipPaths)
+	if err != nil {
+		return "", false, err
+	}
+	ranges, err := tracker.GetRanges(r.Client, ns)
+	if err != nil {
+		return "", false, err
+	}
+	if ranges != nil {
+		if err := featuresets.ValidateValues(merged, *ranges); err != nil {
+			return "", false, &RejectedError{Err: err}
+		}
+	}
+	return string(overlay), partial, nil
+}
+
+// DesiredOverlay returns the key and the overlay the reconciler would write for a
+// HelmRelease, without changing the cluster. It returns an empty key if the HelmRelease
+// is not managed by aceshifter or its namespace has no uid range yet.
+func (r *HelmReleaseReconciler) DesiredOverlay(ctx context.Context, hr *helmapi.HelmRelease) (string, string, error) {
+	var feature uiapi.Feature
+	filename, err := featuresets.TemplateFile(ctx, r.Client, hr, &feature)
+	if err != nil || filename == "" {
+		return "", "", err
+	}
+
+	ns := hr.GetReleaseNamespace()
+	uidStart, uidRange, err := tracker.GetUid(r.Client, ns)
+	if err != nil || uidStart == tracker.UidNone {
+		return "", "", err
+	}
+	opts, err := r.RenderOptions(ctx, hr, &feature, uidStart, uidRange)
+	if err != nil {
+		return "", "", err
+	}
+	if opts.FIPS {
+		reason, refused, err := featuresets.FIPSNonCompliant(filename, r.FIPSMode)
+		if err != nil {
+			return "", "", err
+		}
+		if refused {
+			return "", "", fmt.Errorf("refused on a FIPS cluster: %s", reason)
+		}
+	}
+	overlay, _, err := r.renderOverlay(ctx, hr, &feature, filename, ns, opts)
+	if err != nil {
+		return "", "", err
+	}
+	return featuresets.OverlayKey(hr), overlay, nil
+}
+
+// featureValues returns the values a Feature provides for its chart, merged in the
+// same order as helm-controller: valuesFrom first, then values. Secrets are not read,
+// so that their data is never copied into the overlay ConfigMap.
+func (r *HelmReleaseReconciler) featureValues(ctx context.Context, hr *helmapi.HelmRelease, feature *uiapi.Feature) (map[string]any, error) {
+	log := log.FromContext(ctx)
+
+	values := map[string]any{}
+	for _, ref := range feature.Spec.ValuesFrom {
+		if ref.Kind != "ConfigMap" {
+			log.V(1).Info("skipping values reference", "kind", ref.Kind, "name", ref.Name)
+			continue
+		}
+
+		var src core.ConfigMap
+		if err := r.Get(ctx, client.ObjectKey{Namespace: hr.Namespace, Name: ref.Name}, &src); err != nil {
+			if apierrors.IsNotFound(err) && ref.Optional {
+				continue
+			}
+			return nil, err
+		}
+		key := ref.ValuesKey
+		if key == "" {
+			key = "values.yaml"
+		}
+		data, ok := src.Data[key]
+		if !ok {
+			if ref.Optional {
+				continue
+			}
+			return nil, fmt.Errorf("key %s not found in ConfigMap %s/%s", key, hr.Namespace, ref.Name)
+		}
+
+		if ref.TargetPath != "" {
+			featuresets.SetPath(values, ref.TargetPath, data)
+			continue
+		}
+		var vals map[string]any
+		if err := yaml.Unmarshal([]byte(data), &vals); err != nil {
+			return nil, fmt.Errorf("failed to parse values from ConfigMap %s/%s: %w", hr.Namespace, ref.Name, err)
+		}
+		values = featuresets.MergeValues(values, vals)
+	}
+
+	if feature.Spec.Values != nil && len(feature.Spec.Values.Raw) > 0 {
+		var vals map[string]any
+		if err := json.Unmarshal(feature.Spec.Values.Raw, &vals); err != nil {
+			return nil, fmt.Errorf("failed to parse values of Feature %s: %w", feature.Name, err)
+		}
+		values = featuresets.MergeValues(values, vals)
+	}
+	return values, nil
+}
+
+// RenderOptions resolves the options the overlay of a HelmRelease is rendered with
+// from the flags, the cluster and the annotations. Annotations on the HelmRelease
+// take precedence over the ones on its Feature. An annotation that
+// can't be parsed is returned as an InvalidAnnotationError.
+func (r *HelmReleaseReconciler) RenderOptions(ctx context.Context, hr *helmapi.HelmRelease, feature *uiapi.Feature, uidStart, uidRange int64) (featuresets.Options, error) {
+	opts := featuresets.Options{
+		UidStart:        uidStart,
+		UidRange:        uidRange,
+		DefaultStrategy: r.UidStrategy,
+		UidOffset:       r.UidOffset,
+		IngressMode:     r.IngressMode,
+		ServiceCA:       r.ServiceCA,
+		Release:         hr.GetReleaseName(),
+		MonitoringMode:  r.MonitoringMode,
+	}
+	infra := slices.Contains(r.InfraFeaturesets, feature.Spec.FeatureSet)
+	for _, annotations := range []map[string]string{feature.Annotations, hr.Annotations} {
+		if v, ok := annotations[featuresets.KeyUidStrategy]; ok {
+			strategy, err := featuresets.ParseStrategy(v)
+			if err != nil {
+				return opts, &InvalidAnnotationError{Err: err}
+			}
+			opts.Strategy = strategy
+		}
+		if v, ok := annotations[featuresets.KeyUidOffset]; ok {
+			offset, err := featuresets.ParseOffset(v)
+			if err != nil {
+				return opts, &InvalidAnnotationError{Err: err}
+			}
+			opts.UidOffset = offset
+		}
+		if v, ok := annotations[featuresets.KeyIngressMode]; ok {
+			mode, err := featuresets.ParseIngressMode(v)
+			if err != nil {
+				return opts, &InvalidAnnotationError{Err: err}
+			}
+			opts.IngressMode = mode
+		}
+		if v, ok := annotations[featuresets.KeyServiceCA]; ok {
+			serviceCA, err := featuresets.ParseServiceCA(v)
+			if err != nil {
+				return opts, &InvalidAnnotationError{Err: err}
+			}
+			opts.ServiceCA = serviceCA
+		}
+		if v, ok := annotations[featuresets.KeyMonitoringMode]; ok {
+			mode, err := featuresets.ParseMonitoringMode(v)
+			if err != nil {
+				return opts, &InvalidAnnotationError{Err: err}
+			}
+			opts.MonitoringMode = mode
+		}
+		if v, ok := annotations[featuresets.KeyInfraPlacement]; ok {
+			placement, err := featuresets.ParseInfraPlacement(v)
+			if err != nil {
+				return opts, &InvalidAnnotationError{Err: err}
+			}
+			infra = placement
+		}
+	}
+
+	mode, err := r.monitoringMode(ctx, opts.MonitoringMode)
+	if err != nil {
+		return opts, err
+	}
+	opts.MonitoringMode = mode
+
+	if opts.Proxy, err = r.proxy(ctx); err != nil {
+		return opts, err
+	}
+	if opts.TLS, err = r.tlsProfile(ctx); err != nil {
+		return opts, err
+	}
+	if opts.IngressTLS, err = r.ingressTLSProfile(ctx); err != nil {
+		return opts, err
+	}
+	if opts.FIPS, err = r.fips(ctx); err != nil {
+		return opts, err
+	}
+	if opts.Storage, err = r.storage(ctx); err != nil {
+		return opts, err
+	}
+	if infra {
+		if opts.Infra, err = r.infraPlacement(ctx); err != nil {
+			return opts, err
+		}
+	}
+	return opts, nil
 }
 
 // SetupWithManager sets up the controller with the Manager.
@@ -137,17 +627,72 @@ func (r *HelmReleaseReconciler) SetupWithManager(mgr ctrl.Manager) error {
 
 		reqs := make([]reconcile.Request, 0, len(list.Items))
 		for _, hr := range list.Items {
-			if hr.Spec.TargetNamespace != obj.GetName() {
+			if hr.GetReleaseNamespace() != obj.GetName() {
 				continue
 			}
 			reqs = append(reqs, reconcile.Request{
-				NamespacedName: types.NamespacedName{Name: hr.Name},
+				NamespacedName: client.ObjectKeyFromObject(&hr),
 			})
 		}
 		return reqs
 	}
 
-	return ctrl.NewControllerManagedBy(mgr).
+	mapFeatureToHelmRelease := func(ctx context.Context, obj client.Object) []reconcile.Request {
+		log := log.FromContext(ctx)
+
+		var list helmapi.HelmReleaseList
+		err := r.List(context.TODO(), &list)
+		if err != nil {
+			log.Error(err, "unable to list helmreleases")
+			return nil
+		}
+
+		var reqs []reconcile.Request
+		for _, hr := range list.Items {
+			if hr.Name == obj.GetName() {
+				reqs = append(reqs, reconcile.Request{
+					NamespacedName: client.ObjectKeyFromObject(&hr),
+				})
+			}
+		}
+		return reqs
+	}
+
+	mapToAllHelmReleases := func(ctx context.Context, obj client.Object) []reconcile.Request {
+		var list helmapi.HelmReleaseList
+		if err := r.List(ctx, &list); err != nil {
+			log.FromContext(ctx).Error(err, "unable to list helmreleases")
+			return nil
+		}
+		reqs := make([]reconcile.Request, 0, len(list.Items))
+		for _, hr := range list.Items {
+			reqs = append(reqs, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&hr)})
+		}
+		return reqs
+	}
+
+	mapToProxyClients := func(ctx context.Context, obj client.Object) []reconcile.Request {
+		var list helmapi.HelmReleaseList
+		if err := r.List(ctx, &list); err != nil {
+			log.FromContext(ctx).Error(err, "unable to list helmreleases")
+			return nil
+		}
+		var reqs []reconcile.Request
+		for _, hr := range list.Items {
+			var feature uiapi.Feature
+			filename, err := featuresets.TemplateFile(ctx, r.Client, &hr, &feature)
+			if err != nil {
+				log.FromContext(ctx).Error(err, "unable to get feature", "helmrelease", client.ObjectKeyFromObject(&hr))
+				continue
+			}
+			if featuresets.UsesProxy(filename) {
+				reqs = append(reqs, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&hr)})
+			}
+		}
+		return reqs
+	}
+
+	b := ctrl.NewControllerManagedBy(mgr).
 		For(&helmapi.HelmRelease{}).
 		Watches(
 			&core.Namespace{},
@@ -156,5 +701,53 @@ func (r *HelmReleaseReconciler) SetupWithManager(mgr ctrl.Manager) error {
 				_, ok := obj.GetAnnotations()[tracker.KeyUid]
 				return ok
 			}))).
-		Complete(r)
+		Watches(
+			&uiapi.Feature{},
+			handler.EnqueueRequestsFromMapFunc(mapFeatureToHelmRelease),
+			builder.WithPredicates(predicate.Or(predicate.GenerationChangedPredicate{}, predicate.AnnotationChangedPredicate{})))
+	if r.PropagateProxy {
+		proxy := &unstructured.Unstructured{}
+		proxy.SetGroupVersionKind(tracker.ProxyGVK)
+		b = b.Watches(proxy, handler.EnqueueRequestsFromMapFunc(mapToProxyClients),
+			builder.WithPredicates(predicate.GenerationChangedPredicate{}))
+	}
+	if r.ApplyTLSProfile {
+		apiserver := &unstructured.Unstructured{}
+		apiserver.SetGroupVersionKind(tracker.APIServerGVK)
+		b = b.Watches(apiserver, handler.EnqueueRequestsFromMapFunc(mapToAllHelmReleases),
+			builder.WithPredicates(predicate.GenerationChangedPredicate{}))
+		gvk := tracker.IngressControllerGVK
+		if _, err := mgr.GetRESTMapper().RESTMapping(gvk.GroupKind(), gvk.Version); err == nil {
+			ingress := &unstructured.Unstructured{}
+			ingress.SetGroupVersionKind(gvk)
+			b = b.Watches(ingress, handler.EnqueueRequestsFromMapFunc(mapToAllHelmReleases),
+				builder.WithPredicates(predicate.GenerationChangedPredicate{}))
+		}
+	}
+	if r.StorageOverlays {
+		b = b.Watches(&storage.StorageClass{}, handler.EnqueueRequestsFromMapFunc(mapToAllHelmReleases),
+			builder.WithPredicates(predicate.AnnotationChangedPredicate{})).
+			Watches(&storage.CSIDriver{}, handler.EnqueueRequestsFromMapFunc(mapToAllHelmReleases),
+				builder.WithPredicates(predicate.GenerationChangedPredicate{}))
+	}
+	if r.ClusterImageMirrors {
+		for _, gvk := range []schema.GroupVersionKind{mirror.ImageDigestMirrorSetGVK, mirror.ImageTagMirrorSetGVK, mirror.ImageContentSourcePolicyGVK} {
+			if _, err := mgr.GetRESTMapper().RESTMapping(gvk.GroupKind(), gvk.Version); err != nil {
+				continue
+			}
+			obj := &unstructured.Unstructured{}
+			obj.SetGroupVersionKind(gvk)
+			b = b.Watches(obj, handler.EnqueueRequestsFromMapFunc(mapToAllHelmReleases),
+				builder.WithPredicates(predicate.GenerationChangedPredicate{}))
+		}
+	}
+	b = b.Watches(&core.ConfigMap{}, handler.EnqueueRequestsFromMapFunc(mapToAllHelmReleases),
+		builder.WithPredicates(predicate.NewPredicateFuncs(func(obj client.Object) bool {
+			// resolves the auto monitoring mode
+			return obj.GetNamespace() == tracker.ClusterMonitoringConfigNamespace && obj.GetName() == tracker.ClusterMonitoringConfigName
+		})))
+	if len(r.InfraFeaturesets) > 0 {
+		b = b.Watches(&core.Node{}, handler.EnqueueRequestsFromMapFunc(mapToAllHelmReleases), builder.WithPredicates(infraNodeChanged))
+	}
+	return b.Complete(r)
 }
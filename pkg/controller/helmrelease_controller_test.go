@@ -17,7 +17,22 @@ limitations under the License.
 package controller
 
 import (
+	"context"
+	"reflect"
+	"testing"
+
+	"go.bytebuilders.dev/aceshifter/pkg/tracker"
+
+	helmapi "github.com/fluxcd/helm-controller/api/v2"
 	. "github.com/onsi/ginkgo/v2"
+	core "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
 var _ = Describe("Feature Controller", func() {
@@ -28,3 +43,139 @@ var _ = Describe("Feature Controller", func() {
 		})
 	})
 })
+
+func TestReconcileCreatesNamespace(t *testing.T) {
+	tmpl := &tracker.NamespaceTemplate{
+		Labels:      map[string]string{tracker.LabelManagedBy: tracker.ManagedBy, "pod-security.kubernetes.io/enforce": "restricted"},
+		Annotations: map[string]string{"openshift.io/node-selector": ""},
+	}
+	existing := &core.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "ace", Labels: map[string]string{"team": "ace"}}}
+
+	tests := []struct {
+		name      string
+		tmpl      *tracker.NamespaceTemplate
+		namespace *core.Namespace
+		createErr error
+		want      *core.Namespace
+		wantErr   bool
+	}{
+		{
+			name: "namespace creation disabled",
+		},
+		{
+			name: "missing namespace",
+			tmpl: tmpl,
+			want: &core.Namespace{ObjectMeta: metav1.ObjectMeta{
+				Name:        "ace",
+				Labels:      tmpl.Labels,
+				Annotations: tmpl.Annotations,
+			}},
+		},
+		{
+			name:      "existing namespace",
+			tmpl:      tmpl,
+			namespace: existing,
+			want:      existing,
+		},
+		{
+			name:      "namespace created concurrently",
+			tmpl:      tmpl,
+			createErr: apierrors.NewAlreadyExists(schema.GroupResource{Resource: "namespaces"}, "ace"),
+		},
+		{
+			name:      "creation refused",
+			tmpl:      tmpl,
+			createErr: apierrors.NewForbidden(schema.GroupResource{Resource: "namespaces"}, "ace", nil),
+			wantErr:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kc := &fakeReleaseClient{hr: aceRelease(), createErr: tt.createErr}
+			if tt.namespace != nil {
+				kc.namespaces = []*core.Namespace{tt.namespace.DeepCopy()}
+			}
+			r := &HelmReleaseReconciler{Client: kc, Recorder: record.NewFakeRecorder(10), NamespaceTemplate: tt.tmpl}
+
+			_, err := r.Reconcile(context.TODO(), ctrl.Request{NamespacedName: client.ObjectKeyFromObject(kc.hr)})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("expected error %v, got %v", tt.wantErr, err)
+			}
+			if create := tt.tmpl != nil && tt.namespace == nil; create != (len(kc.creates) > 0) {
+				t.Errorf("expected create %v, got %d creates", create, len(kc.creates))
+			}
+			var got *core.Namespace
+			if len(kc.namespaces) > 0 {
+				got = kc.namespaces[0]
+			}
+			if tt.want == nil {
+				if got != nil {
+					t.Errorf("expected no namespace, got %+v", got.ObjectMeta)
+				}
+				return
+			}
+			if got == nil {
+				t.Fatal("expected the namespace to exist")
+			}
+			if got.Name != tt.want.Name || !reflect.DeepEqual(got.Labels, tt.want.Labels) || !reflect.DeepEqual(got.Annotations, tt.want.Annotations) {
+				t.Errorf("expected %+v, got %+v", tt.want.ObjectMeta, got.ObjectMeta)
+			}
+		})
+	}
+}
+
+// aceRelease returns the HelmRelease of the ace chart, which is managed without a Feature.
+func aceRelease() *helmapi.HelmRelease {
+	return &helmapi.HelmRelease{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "kubeops", Name: "ace"},
+		Spec: helmapi.HelmReleaseSpec{
+			ReleaseName:     "ace",
+			TargetNamespace: "ace",
+			Chart:           &helmapi.HelmChartTemplate{Spec: helmapi.HelmChartTemplateSpec{Chart: "ace"}},
+		},
+	}
+}
+
+// fakeReleaseClient serves a HelmRelease and the namespaces read by Reconcile and
+// records the objects it creates. Like the API server, it does not persist the
+// objects created with a server-side dry-run.
+type fakeReleaseClient struct {
+	client.Client
+	hr         *helmapi.HelmRelease
+	namespaces []*core.Namespace
+	createErr  error
+	creates    []*client.CreateOptions
+}
+
+func (c *fakeReleaseClient) Get(_ context.Context, key client.ObjectKey, obj client.Object, _ ...client.GetOption) error {
+	switch o := obj.(type) {
+	case *helmapi.HelmRelease:
+		if c.hr != nil && client.ObjectKeyFromObject(c.hr) == key {
+			c.hr.DeepCopyInto(o)
+			return nil
+		}
+	case *core.Namespace:
+		for _, ns := range c.namespaces {
+			if ns.Name == key.Name {
+				ns.DeepCopyInto(o)
+				return nil
+			}
+		}
+	}
+	return apierrors.NewNotFound(schema.GroupResource{}, key.Name)
+}
+
+func (c *fakeReleaseClient) Create(_ context.Context, obj client.Object, opts ...client.CreateOption) error {
+	var o client.CreateOptions
+	o.ApplyOptions(opts)
+	c.creates = append(c.creates, &o)
+	if c.createErr != nil {
+		return c.createErr
+	}
+	ns := obj.(*core.Namespace)
+	if len(o.DryRun) == 0 {
+		ns.UID = types.UID(ns.Name + "-uid")
+		c.namespaces = append(c.namespaces, ns.DeepCopy())
+	}
+	return nil
+}
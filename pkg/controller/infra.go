@@ -0,0 +1,60 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+
+	"go.bytebuilders.dev/aceshifter/pkg/featuresets"
+	"go.bytebuilders.dev/aceshifter/pkg/tracker"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+)
+
+// infraPlacement returns the placement on infra nodes, or nil if the cluster has no
+// infra nodes.
+func (r *HelmReleaseReconciler) infraPlacement(ctx context.Context) (*featuresets.Placement, error) {
+	ok, err := tracker.InfraNodesExist(ctx, r.Client)
+	if err != nil || !ok {
+		return nil, err
+	}
+	return featuresets.InfraPlacement(), nil
+}
+
+// infraNodeChanged passes node events that add or remove an infra node, and ignores
+// the status updates of nodes.
+var infraNodeChanged = predicate.Funcs{
+	CreateFunc: func(e event.CreateEvent) bool {
+		return isInfraNode(e.Object)
+	},
+	DeleteFunc: func(e event.DeleteEvent) bool {
+		return isInfraNode(e.Object)
+	},
+	UpdateFunc: func(e event.UpdateEvent) bool {
+		return isInfraNode(e.ObjectOld) != isInfraNode(e.ObjectNew)
+	},
+	GenericFunc: func(e event.GenericEvent) bool {
+		return false
+	},
+}
+
+func isInfraNode(obj client.Object) bool {
+	_, ok := obj.GetLabels()[tracker.LabelInfraNode]
+	return ok
+}
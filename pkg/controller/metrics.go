@@ -0,0 +1,47 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+var gateDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+	Name:    "aceshifter_helmrelease_gate_duration_seconds",
+	Help:    "Time a HelmRelease was held suspended until its SCC overlay was ready.",
+	Buckets: prometheus.ExponentialBuckets(1, 2, 12),
+})
+
+var auditViolations = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "aceshifter_audit_violations",
+	Help: "Number of running pods of a feature that violate the uid range of their namespace or use a privileged SCC.",
+}, []string{"namespace", "feature", "reason"})
+
+var dryRunChanges = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "aceshifter_dry_run_changes_total",
+	Help: "Number of changes computed in dry-run mode that were not persisted.",
+}, []string{"controller", "kind", "operation"})
+
+var fipsBuildInfo = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "aceshifter_fips_build_info",
+	Help: "Always 1. Reports the Go FIPS 140-3 module aceshifter was built with and whether FIPS mode is enabled.",
+}, []string{"module", "enabled"})
+
+func init() {
+	metrics.Registry.MustRegister(gateDuration, auditViolations, dryRunChanges, fipsBuildInfo)
+}
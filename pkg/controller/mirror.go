@@ -0,0 +1,320 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"go.bytebuilders.dev/aceshifter/pkg/featuresets"
+	"go.bytebuilders.dev/aceshifter/pkg/mirror"
+	"go.bytebuilders.dev/aceshifter/pkg/scaffold"
+	"go.bytebuilders.dev/aceshifter/pkg/tracker"
+
+	helmapi "github.com/fluxcd/helm-controller/api/v2"
+	core "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/utils/lru"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	// maxCachedCharts bounds the number of chart default values kept in memory.
+	maxCachedCharts = 64
+	// maxChartArchiveSize bounds the size of a downloaded chart artifact.
+	maxChartArchiveSize = 16 << 20
+	// chartPollInterval is how often a HelmRelease gated on its chart defaults, or
+	// whose overlay was rendered without them, is reconciled until the chart is fetched.
+	chartPollInterval = 30 * time.Second
+
+	EventReasonChartDefaultsUnavailable = "ChartDefaultsUnavailable"
+)
+
+var HelmChartGVK = schema.GroupVersionKind{Group: "source.toolkit.fluxcd.io", Version: "v1", Kind: "HelmChart"}
+
+var artifactClient = &http.Client{Timeout: 30 * time.Second}
+
+// chartCache holds the default values of the recently used charts keyed by artifact digest.
+type chartCache struct {
+	once   sync.Once
+	values *lru.Cache
+}
+
+func (c *chartCache) cache() *lru.Cache {
+	c.once.Do(func() {
+		c.values = lru.New(maxCachedCharts)
+	})
+	return c.values
+}
+
+func (c *chartCache) get(digest string) (map[string]any, bool) {
+	v, ok := c.cache().Get(digest)
+	if !ok {
+		return nil, false
+	}
+	return v.(map[string]any), true
+}
+
+func (c *chartCache) put(digest string, values map[string]any) {
+	c.cache().Add(digest, values)
+}
+
+// mirrorRules returns the image mirror rules from the flags, followed by the rules
+// read from the cluster for sources not set by the flags.
+func (r *HelmReleaseReconciler) mirrorRules(ctx context.Context) (mirror.Rules, error) {
+	if !r.ClusterImageMirrors {
+		return r.ImageMirrors, nil
+	}
+	rules, err := mirror.LoadClusterRules(ctx, r.Client)
+	if err != nil {
+		return nil, err
+	}
+	return r.ImageMirrors.Merge(rules), nil
+}
+
+// chartValues returns the default values of the chart of a HelmRelease, read from
+// the artifact of its Flux HelmChart, or of the HelmChart prefetchChart created for
+// it. It returns nil until the chart is fetched, and a ChartFetchError if the
+// artifact can't be downloaded.
+func (r *HelmReleaseReconciler) chartValues(ctx context.Context, hr *helmapi.HelmRelease) (map[string]any, error) {
+	ns, name := hr.Status.GetHelmChart()
+	if name == "" {
+		if ns, name = prefetchChartKey(hr); name == "" {
+			return nil, nil
+		}
+	}
+	var chart unstructured.Unstructured
+	chart.SetGroupVersionKind(HelmChartGVK)
+	if err := r.Get(ctx, client.ObjectKey{Namespace: ns, Name: name}, &chart); err != nil {
+		return nil, client.IgnoreNotFound(err)
+	}
+	url, _, _ := unstructured.NestedString(chart.Object, "status", "artifact", "url")
+	digest, _, _ := unstructured.NestedString(chart.Object, "status", "artifact", "digest")
+	if url == "" || digest == "" {
+		return nil, nil
+	}
+	values, err := r.charts.fetch(ctx, url, digest)
+	if err != nil {
+		return nil, &ChartFetchError{Err: err}
+	}
+	return values, nil
+}
+
+// chartDefaults returns the default values of the chart of a HelmRelease like
+// chartValues. If the chart artifact can't be downloaded, for example by diff
+// outside the cluster, it records a Warning event and returns nil and true, so the
+// overlay is rendered without the settings that need the chart defaults instead of
+// not at all.
+func (r *HelmReleaseReconciler) chartDefaults(ctx context.Context, hr *helmapi.HelmRelease) (map[string]any, bool, error) {
+	values, err := r.chartValues(ctx, hr)
+	var fetchErr *ChartFetchError
+	if !errors.As(err, &fetchErr) {
+		return values, false, err
+	}
+	log.FromContext(ctx).Error(err, "rendering the overlay without the chart defaults")
+	if r.Recorder != nil {
+		r.Recorder.Eventf(hr, core.EventTypeWarning, EventReasonChartDefaultsUnavailable,
+			"rendered the overlay without the chart defaults: %v", fetchErr.Err)
+	}
+	return nil, true, nil
+}
+
+// ChartFetchError is returned when the chart artifact of a HelmRelease can't be
+// downloaded or loaded.
+type ChartFetchError struct {
+	Err error
+}
+
+func (e *ChartFetchError) Error() string {
+	return "failed to fetch chart defaults: " + e.Err.Error()
+}
+
+func (e *ChartFetchError) Unwrap() error {
+	return e.Err
+}
+
+// fetch returns the default values of the chart artifact at url, downloading it
+// unless it is cached under its digest.
+func (c *chartCache) fetch(ctx context.Context, url, digest string) (map[string]any, error) {
+	if values, ok := c.get(digest); ok {
+		return featuresets.MergeValues(nil, values), nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := artifactClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close() // nolint:errcheck
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to download chart artifact %s: %s", url, resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxChartArchiveSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxChartArchiveSize {
+		return nil, fmt.Errorf("chart artifact %s is larger than %d bytes", url, maxChartArchiveSize)
+	}
+	chart, err := scaffold.LoadChartArchive(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load chart artifact %s: %w", url, err)
+	}
+	values := mirror.ChartValues(chart)
+	c.put(digest, values)
+	return featuresets.MergeValues(nil, values), nil
+}
+
+// needsChartDefaults returns true if the overlay of a HelmRelease depends on the
+// defaults of its chart: to mirror their images, to check which TLS settings the
+// chart reads, or to keep the entries of the env and volume lists of the chart
+// defaults that the FIPS and proxy overlays set.
+func needsChartDefaults(opts featuresets.Options, rules mirror.Rules) bool {
+	return len(rules) > 0 || opts.TLS != nil || opts.FIPS || opts.Proxy != nil
+}
+
+// chartPending returns true if the first install of a gated HelmRelease needs the
+// defaults of its chart and they are not fetched yet, see needsChartDefaults.
+// helm-controller does not create the HelmChart of a suspended HelmRelease, so
+// prefetchChart creates one to fetch them.
+func (r *HelmReleaseReconciler) chartPending(ctx context.Context, hr *helmapi.HelmRelease, opts featuresets.Options) (bool, error) {
+	if len(hr.Status.History) > 0 {
+		return false, r.deletePrefetchChart(ctx, hr)
+	}
+	if !r.GateInstall || !hr.HasChartTemplate() {
+		return false, nil
+	}
+	rules, err := r.mirrorRules(ctx)
+	if err != nil || !needsChartDefaults(opts, rules) {
+		return false, err
+	}
+	values, err := r.chartValues(ctx, hr)
+	var fetchErr *ChartFetchError
+	if errors.As(err, &fetchErr) {
+		// renderOverlay falls back to rendering without the chart defaults
+		return false, nil
+	}
+	if err != nil || values != nil {
+		return false, err
+	}
+	return true, r.prefetchChart(ctx, hr)
+}
+
+// prefetchChartKey returns the key of the HelmChart prefetchChart creates for a
+// HelmRelease, in the namespace of its chart source like the one of helm-controller.
+func prefetchChartKey(hr *helmapi.HelmRelease) (string, string) {
+	if !hr.HasChartTemplate() {
+		return "", ""
+	}
+	ns := hr.Spec.Chart.Spec.SourceRef.Namespace
+	if ns == "" {
+		ns = hr.Namespace
+	}
+	return ns, strings.ReplaceAll(fmt.Sprintf("aceshifter-%s-%s", hr.Namespace, hr.Name), ".", "-")
+}
+
+// prefetchChart creates a HelmChart from the chart template of a HelmRelease.
+func (r *HelmReleaseReconciler) prefetchChart(ctx context.Context, hr *helmapi.HelmRelease) error {
+	ns, name := prefetchChartKey(hr)
+	tpl := hr.Spec.Chart.Spec
+
+	var chart unstructured.Unstructured
+	chart.SetGroupVersionKind(HelmChartGVK)
+	chart.SetNamespace(ns)
+	chart.SetName(name)
+	result, err := controllerutil.CreateOrPatch(ctx, r.Client, &chart, func() error {
+		labels := chart.GetLabels()
+		if labels == nil {
+			labels = map[string]string{}
+		}
+		labels[tracker.LabelManagedBy] = tracker.ManagedBy
+		chart.SetLabels(labels)
+		if ns == hr.Namespace {
+			if err := controllerutil.SetOwnerReference(hr, &chart, r.Scheme); err != nil {
+				return err
+			}
+		}
+		spec := map[string]any{
+			"chart": tpl.Chart,
+			"sourceRef": map[string]any{
+				"kind": tpl.SourceRef.Kind,
+				"name": tpl.SourceRef.Name,
+			},
+			"interval": hr.Spec.Chart.GetInterval(hr.Spec.Interval).Duration.String(),
+		}
+		if tpl.Version != "" {
+			spec["version"] = tpl.Version
+		}
+		if tpl.ReconcileStrategy != "" {
+			spec["reconcileStrategy"] = tpl.ReconcileStrategy
+		}
+		if len(tpl.ValuesFiles) > 0 {
+			files := make([]any, 0, len(tpl.ValuesFiles))
+			for _, f := range tpl.ValuesFiles {
+				files = append(files, f)
+			}
+			spec["valuesFiles"] = files
+			spec["ignoreMissingValuesFiles"] = tpl.IgnoreMissingValuesFiles
+		}
+		return unstructured.SetNestedField(chart.Object, spec, "spec")
+	})
+	if err != nil {
+		return err
+	}
+	if r.DryRun {
+		reportDryRun(ctx, nil, nil, "helmrelease", "HelmChart", ns+"/"+name, result)
+	} else if result != controllerutil.OperationResultNone {
+		log.FromContext(ctx).Info(fmt.Sprintf("%s helmchart %s/%s to fetch the chart defaults", result, ns, name))
+	}
+	return nil
+}
+
+// deletePrefetchChart deletes the HelmChart prefetchChart created for a HelmRelease
+// once helm-controller has installed it.
+func (r *HelmReleaseReconciler) deletePrefetchChart(ctx context.Context, hr *helmapi.HelmRelease) error {
+	ns, name := prefetchChartKey(hr)
+	if name == "" {
+		return nil
+	}
+	var chart unstructured.Unstructured
+	chart.SetGroupVersionKind(HelmChartGVK)
+	if err := r.Get(ctx, client.ObjectKey{Namespace: ns, Name: name}, &chart); err != nil {
+		return client.IgnoreNotFound(err)
+	}
+	if chart.GetLabels()[tracker.LabelManagedBy] != tracker.ManagedBy {
+		return nil
+	}
+	if err := r.Delete(ctx, &chart); client.IgnoreNotFound(err) != nil {
+		return err
+	}
+	if r.DryRun {
+		reportDryRun(ctx, nil, nil, "helmrelease", "HelmChart", ns+"/"+name, "deleted")
+	}
+	return nil
+}
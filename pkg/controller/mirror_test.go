@@ -0,0 +1,226 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"go.bytebuilders.dev/aceshifter/pkg/featuresets"
+	"go.bytebuilders.dev/aceshifter/pkg/mirror"
+
+	helmapi "github.com/fluxcd/helm-controller/api/v2"
+	core "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/tools/record"
+	uiapi "kmodules.xyz/resource-metadata/apis/ui/v1alpha1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/yaml"
+)
+
+func chartArchive(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for name, data := range files {
+		if err := tw.WriteHeader(&tar.Header{Name: "demo/" + name, Mode: 0o644, Size: int64(len(data)), Typeflag: tar.TypeReg}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(data)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestChartCacheFetch(t *testing.T) {
+	archive := chartArchive(t, map[string]string{
+		"Chart.yaml":  "apiVersion: v2\nname: demo\nversion: 0.1.0\n",
+		"values.yaml": "image:\n  registry: ghcr.io\n  repository: appscode/demo\n",
+	})
+	var hits atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		hits.Add(1)
+		if req.URL.Path != "/demo.tgz" {
+			http.NotFound(w, req)
+			return
+		}
+		_, _ = w.Write(archive)
+	}))
+	defer srv.Close()
+
+	var c chartCache
+	expected := map[string]any{
+		"image": map[string]any{"registry": "ghcr.io", "repository": "appscode/demo"},
+	}
+	for i := 0; i < 2; i++ {
+		values, err := c.fetch(context.Background(), srv.URL+"/demo.tgz", "sha256:demo")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(values, expected) {
+			t.Errorf("expected %v, got %v", expected, values)
+		}
+		// callers may change the returned values
+		values["image"].(map[string]any)["registry"] = "changed"
+	}
+	if n := hits.Load(); n != 1 {
+		t.Errorf("expected the chart to be downloaded once, got %d downloads", n)
+	}
+
+	if _, err := c.fetch(context.Background(), srv.URL+"/missing.tgz", "sha256:missing"); err == nil {
+		t.Error("expected an error for a missing artifact")
+	}
+	if _, ok := c.get("sha256:missing"); ok {
+		t.Error("a failed download must not be cached")
+	}
+}
+
+func TestChartCacheFetchLimit(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		_, _ = w.Write(make([]byte, maxChartArchiveSize+1))
+	}))
+	defer srv.Close()
+
+	var c chartCache
+	if _, err := c.fetch(context.Background(), srv.URL+"/large.tgz", "sha256:large"); err == nil {
+		t.Error("expected an error for an artifact larger than the limit")
+	}
+}
+
+func TestChartCacheBound(t *testing.T) {
+	var c chartCache
+	for i := 0; i < maxCachedCharts; i++ {
+		c.put(fmt.Sprintf("sha256:%d", i), map[string]any{})
+	}
+	if _, ok := c.get("sha256:0"); !ok {
+		t.Fatal("expected sha256:0 to be cached")
+	}
+	c.put("sha256:next", map[string]any{})
+	if n := c.cache().Len(); n != maxCachedCharts {
+		t.Errorf("expected %d cached charts, got %d", maxCachedCharts, n)
+	}
+	// the least recently used chart is evicted
+	for digest, expected := range map[string]bool{"sha256:0": true, "sha256:1": false, "sha256:next": true} {
+		if _, ok := c.get(digest); ok != expected {
+			t.Errorf("expected %s cached to be %v, got %v", digest, expected, ok)
+		}
+	}
+}
+
+func TestRenderOverlayWithoutChartDefaults(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	hr := &helmapi.HelmRelease{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "kubeops", Name: "kubedb"},
+		Status:     helmapi.HelmReleaseStatus{HelmChart: "kubeops/kubeops-kubedb"},
+	}
+	const filename = "opscenter-datastore/kubedb.yaml"
+	opts := featuresets.Options{UidStart: 1000000, UidRange: 10000}
+	base := &HelmReleaseReconciler{Client: &fakeChartClient{url: srv.URL + "/kubedb.tgz"}}
+	expected, partial, err := base.renderOverlay(context.TODO(), hr, &uiapi.Feature{}, filename, "kubedb", opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if partial {
+		t.Fatal("expected the base overlay to not need the chart defaults")
+	}
+
+	tests := []struct {
+		name    string
+		mirrors mirror.Rules
+		tls     *featuresets.TLS
+	}{
+		{name: "image mirrors", mirrors: mirror.Rules{{Source: "ghcr.io/appscode", Mirror: "registry.local/appscode"}}},
+		// the tls values are only kept for charts known to declare them
+		{name: "tls profile", tls: &featuresets.TLS{MinVersion: "VersionTLS12", CipherSuites: []string{"TLS_AES_128_GCM_SHA256"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := record.NewFakeRecorder(10)
+			r := &HelmReleaseReconciler{
+				Client:       base.Client,
+				Recorder:     recorder,
+				ImageMirrors: tt.mirrors,
+			}
+			opts := opts
+			opts.TLS = tt.tls
+			overlay, partial, err := r.renderOverlay(context.TODO(), hr, &uiapi.Feature{}, filename, "kubedb", opts)
+			if err != nil {
+				t.Fatalf("expected the overlay to be rendered without the chart defaults, got %v", err)
+			}
+			if !partial {
+				t.Error("expected the overlay to be reported as rendered without the chart defaults")
+			}
+			var want, got map[string]any
+			if err := yaml.Unmarshal([]byte(expected), &want); err != nil {
+				t.Fatal(err)
+			}
+			if err := yaml.Unmarshal([]byte(overlay), &got); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("expected the base overlay %v, got %v", want, got)
+			}
+			select {
+			case event := <-recorder.Events:
+				if !strings.HasPrefix(event, core.EventTypeWarning+" "+EventReasonChartDefaultsUnavailable) {
+					t.Errorf("expected a %s warning, got %q", EventReasonChartDefaultsUnavailable, event)
+				}
+			default:
+				t.Error("expected a warning event for the fallback")
+			}
+		})
+	}
+}
+
+// fakeChartClient serves a HelmChart whose artifact is at url and finds no other object.
+type fakeChartClient struct {
+	client.Client
+	url string
+}
+
+func (c *fakeChartClient) Get(_ context.Context, key client.ObjectKey, obj client.Object, _ ...client.GetOption) error {
+	if u, ok := obj.(*unstructured.Unstructured); ok && u.GroupVersionKind() == HelmChartGVK {
+		u.SetNamespace(key.Namespace)
+		u.SetName(key.Name)
+		return unstructured.SetNestedMap(u.Object, map[string]any{"url": c.url, "digest": "sha256:" + key.Name}, "status", "artifact")
+	}
+	return apierrors.NewNotFound(schema.GroupResource{}, key.Name)
+}
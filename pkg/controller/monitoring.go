@@ -0,0 +1,97 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	"go.bytebuilders.dev/aceshifter/pkg/featuresets"
+	"go.bytebuilders.dev/aceshifter/pkg/tracker"
+
+	core "k8s.io/api/core/v1"
+	rbac "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apiserver/pkg/authentication/serviceaccount"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// monitoringMode resolves the auto monitoring mode by checking whether OpenShift
+// user-workload monitoring is enabled.
+func (r *HelmReleaseReconciler) monitoringMode(ctx context.Context, mode featuresets.MonitoringMode) (featuresets.MonitoringMode, error) {
+	if mode != "" && mode != featuresets.MonitoringModeAuto {
+		return mode, nil
+	}
+	enabled, err := tracker.UserWorkloadMonitoringEnabled(ctx, r.Client)
+	if err != nil || !enabled {
+		return featuresets.MonitoringModePrometheus, err
+	}
+	return featuresets.MonitoringModeUserWorkload, nil
+}
+
+// labelForMonitoring opts the target namespace of a HelmRelease in to user-workload
+// scraping, so that its ServiceMonitors and PodMonitors are picked up by the
+// OpenShift user-workload Prometheus.
+func (r *HelmReleaseReconciler) labelForMonitoring(ctx context.Context, ns *core.Namespace) error {
+	if ns.Labels[tracker.LabelUserMonitoring] == "true" {
+		return nil
+	}
+
+	patch := client.MergeFrom(ns.DeepCopy())
+	if ns.Labels == nil {
+		ns.Labels = map[string]string{}
+	}
+	ns.Labels[tracker.LabelUserMonitoring] = "true"
+	if err := r.Patch(ctx, ns, patch); err != nil {
+		return err
+	}
+	log.FromContext(ctx).Info("labeled namespace for user-workload monitoring", "namespace", ns.Name)
+	return nil
+}
+
+// bindMonitoringView binds the cluster-monitoring-view ClusterRole to the service
+// accounts of a namespace, so that the features in it can query the Thanos Querier.
+// Chart service account names depend on the release values, so the binding covers
+// every service account of the namespace.
+func (r *HelmReleaseReconciler) bindMonitoringView(ctx context.Context, ns string) error {
+	binding := rbac.ClusterRoleBinding{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: fmt.Sprintf("aceshifter:%s:%s", tracker.ClusterMonitoringViewRole, ns),
+		},
+	}
+	result, err := controllerutil.CreateOrPatch(ctx, r.Client, &binding, func() error {
+		metav1.SetMetaDataLabel(&binding.ObjectMeta, tracker.LabelManagedBy, tracker.ManagedBy)
+		binding.RoleRef = rbac.RoleRef{APIGroup: rbac.GroupName, Kind: "ClusterRole", Name: tracker.ClusterMonitoringViewRole}
+		binding.Subjects = []rbac.Subject{{
+			APIGroup: rbac.GroupName,
+			Kind:     rbac.GroupKind,
+			Name:     serviceaccount.MakeNamespaceGroupName(ns),
+		}}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if r.DryRun {
+		reportDryRun(ctx, nil, nil, "helmrelease", "ClusterRoleBinding", binding.Name, result)
+	} else if result != controllerutil.OperationResultNone {
+		log.FromContext(ctx).Info(fmt.Sprintf("%s clusterrolebinding %s", result, binding.Name))
+	}
+	return nil
+}
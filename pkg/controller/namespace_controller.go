@@ -25,6 +25,7 @@ import (
 	core "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
 	uiapi "kmodules.xyz/resource-metadata/apis/ui/v1alpha1"
 	clusterv1alpha1 "open-cluster-management.io/api/cluster/v1alpha1"
 	ctrl "sigs.k8s.io/controller-runtime"
@@ -39,7 +40,11 @@ import (
 // NamespaceReconciler reconciles a Namespace object
 type NamespaceReconciler struct {
 	client.Client
-	Scheme *runtime.Scheme
+	Scheme   *runtime.Scheme
+	Recorder record.EventRecorder
+	// DryRun reports the ClusterClaim changes instead of persisting them. Client
+	// must send writes as server-side dry-runs, see NewDryRunClient.
+	DryRun bool
 }
 
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
@@ -101,7 +106,9 @@ func (r *NamespaceReconciler) Reconcile(ctx context.Context, req ctrl.Request) (
 	if err != nil {
 		return ctrl.Result{}, err
 	}
-	if result != controllerutil.OperationResultNone {
+	if r.DryRun {
+		reportDryRun(ctx, r.Recorder, &ns, "namespace", "ClusterClaim", cc.Name, result)
+	} else if result != controllerutil.OperationResultNone {
 		log.Info(fmt.Sprintf("ClusterClaim %s %s", cc.Name, result))
 	}
 	return ctrl.Result{}, nil
@@ -110,23 +117,29 @@ func (r *NamespaceReconciler) Reconcile(ctx context.Context, req ctrl.Request) (
 // SetupWithManager sets up the controller with the Manager.
 func (r *NamespaceReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	return ctrl.NewControllerManagedBy(mgr).
-		For(&core.Namespace{}, builder.WithPredicates(predicate.NewPredicateFuncs(func(obj client.Object) bool {
-			_, ok := obj.GetAnnotations()[tracker.KeyUid]
-			if !ok {
-				return false
-			}
+		For(&core.Namespace{}, builder.WithPredicates(featureNamespace(r.Client))).
+		Complete(r)
+}
 
-			var list uiapi.FeatureList
-			err := r.List(context.TODO(), &list)
-			if err != nil {
-				return false
-			}
-			for _, feature := range list.Items {
-				if feature.Spec.Chart.Namespace == obj.GetName() {
-					return true
-				}
-			}
+// featureNamespace selects the namespaces with a uid range that are the chart
+// namespace of a Feature.
+func featureNamespace(kc client.Reader) predicate.Predicate {
+	return predicate.NewPredicateFuncs(func(obj client.Object) bool {
+		_, ok := obj.GetAnnotations()[tracker.KeyUid]
+		if !ok {
 			return false
-		}))).
-		Complete(r)
+		}
+
+		var list uiapi.FeatureList
+		err := kc.List(context.TODO(), &list)
+		if err != nil {
+			return false
+		}
+		for _, feature := range list.Items {
+			if feature.Spec.Chart.Namespace == obj.GetName() {
+				return true
+			}
+		}
+		return false
+	})
 }
@@ -0,0 +1,78 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	"go.bytebuilders.dev/aceshifter/pkg/featuresets"
+	"go.bytebuilders.dev/aceshifter/pkg/tracker"
+
+	core "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// proxy returns the cluster-wide proxy config to render into the overlays, or nil
+// if proxy propagation is disabled or no proxy or trusted CA is configured.
+func (r *HelmReleaseReconciler) proxy(ctx context.Context) (*featuresets.Proxy, error) {
+	if !r.PropagateProxy {
+		return nil, nil
+	}
+	p, err := tracker.GetClusterProxy(ctx, r.Client)
+	if err != nil || p == nil || p.IsZero() {
+		return nil, err
+	}
+
+	out := &featuresets.Proxy{
+		HTTPProxy:  p.HTTPProxy,
+		HTTPSProxy: p.HTTPSProxy,
+		NoProxy:    p.NoProxy,
+	}
+	if p.TrustedCA != "" {
+		out.TrustedCA = tracker.TrustedCABundleName
+	}
+	return out, nil
+}
+
+// ensureTrustedCABundle creates the ConfigMap that the cluster network operator
+// injects the trusted CA bundle into. Its data is owned by the operator.
+func (r *HelmReleaseReconciler) ensureTrustedCABundle(ctx context.Context, ns string) error {
+	cm := core.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      tracker.TrustedCABundleName,
+			Namespace: ns,
+		},
+	}
+	result, err := controllerutil.CreateOrPatch(ctx, r.Client, &cm, func() error {
+		if cm.Labels == nil {
+			cm.Labels = map[string]string{}
+		}
+		cm.Labels[tracker.LabelInjectTrustedCABundle] = "true"
+		cm.Labels[tracker.LabelManagedBy] = tracker.ManagedBy
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if result != controllerutil.OperationResultNone {
+		log.FromContext(ctx).Info(fmt.Sprintf("%s trusted CA bundle configmap %s/%s", result, ns, cm.Name))
+	}
+	return nil
+}
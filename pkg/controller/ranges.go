@@ -0,0 +1,194 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+
+	"go.bytebuilders.dev/aceshifter/pkg/tracker"
+
+	helmapi "github.com/fluxcd/helm-controller/api/v2"
+	core "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	EventReasonRangeRestored = "UidRangeRestored"
+	EventReasonRangeConflict = "UidRangeConflict"
+)
+
+// pinRange keeps the uid range of a namespace stable across recreation and restore.
+// The range of a namespace is recorded and the namespace is marked as pinned with its
+// metadata uid, so that later changes of its range are recorded too. A namespace that
+// is not marked, because it was just created or restored, and whose range differs from
+// the recorded one gets the recorded range re-applied, so that PVC data written under
+// the old range stays readable. The range is not restored once pods run in the namespace
+// or while another namespace holds it. ns is updated with the patched namespace.
+func (r *HelmReleaseReconciler) pinRange(ctx context.Context, ns *core.Namespace) error {
+	if !r.PinRanges {
+		return nil
+	}
+	registry := tracker.Registry{Client: r.Client}
+
+	recorded, found, err := registry.Get(ctx, ns.Name)
+	if err != nil {
+		return err
+	}
+	cur, hasRange := ns.Annotations[tracker.KeyUid]
+	pinned := ns.Annotations[tracker.KeyPinnedFor] == string(ns.UID)
+	switch {
+	case !hasRange && (!found || pinned):
+		return nil
+	case !found || pinned:
+		if cur != recorded {
+			if err := registry.Record(ctx, ns.Name, cur); err != nil {
+				return err
+			}
+		}
+		return r.markPinned(ctx, ns)
+	case cur == recorded && ns.Annotations[tracker.KeyFsGroup] == recorded:
+		return r.markPinned(ctx, ns)
+	}
+
+	var pods core.PodList
+	if err := r.List(ctx, &pods, client.InNamespace(ns.Name), client.Limit(1)); err != nil {
+		return err
+	}
+	if len(pods.Items) > 0 {
+		r.Recorder.Eventf(ns, core.EventTypeWarning, EventReasonRangeConflict,
+			"not restoring uid range %s recorded in %s/%s, pods already run under %q", recorded, tracker.RegistryNamespace, tracker.RegistryName, cur)
+		return nil
+	}
+	holder, err := r.rangeHolder(ctx, ns.Name, recorded)
+	if err != nil {
+		return err
+	}
+	if holder != "" {
+		r.Recorder.Eventf(ns, core.EventTypeWarning, EventReasonRangeConflict,
+			"not restoring uid range %s recorded in %s/%s, namespace %s holds it", recorded, tracker.RegistryNamespace, tracker.RegistryName, holder)
+		return nil
+	}
+
+	patch := client.MergeFrom(ns.DeepCopy())
+	metav1.SetMetaDataAnnotation(&ns.ObjectMeta, tracker.KeyUid, recorded)
+	metav1.SetMetaDataAnnotation(&ns.ObjectMeta, tracker.KeyFsGroup, recorded)
+	metav1.SetMetaDataAnnotation(&ns.ObjectMeta, tracker.KeyPinnedFor, string(ns.UID))
+	if err := r.Patch(ctx, ns, patch); err != nil {
+		return err
+	}
+	if r.DryRun {
+		reportDryRun(ctx, nil, nil, "helmrelease", "Namespace", ns.Name, controllerutil.OperationResultUpdated)
+		return nil
+	}
+	log.FromContext(ctx).Info("restored recorded uid range", "namespace", ns.Name, "from", cur, "to", recorded)
+	r.Recorder.Eventf(ns, core.EventTypeNormal, EventReasonRangeRestored, "restored uid range %s recorded in %s/%s, was %q",
+		recorded, tracker.RegistryNamespace, tracker.RegistryName, cur)
+	return nil
+}
+
+// markPinned marks the uid range of a namespace as recorded for its metadata uid.
+func (r *HelmReleaseReconciler) markPinned(ctx context.Context, ns *core.Namespace) error {
+	if ns.Annotations[tracker.KeyPinnedFor] == string(ns.UID) {
+		return nil
+	}
+	patch := client.MergeFrom(ns.DeepCopy())
+	metav1.SetMetaDataAnnotation(&ns.ObjectMeta, tracker.KeyPinnedFor, string(ns.UID))
+	return r.Patch(ctx, ns, patch)
+}
+
+// pruneRanges forgets the recorded uid ranges of namespaces that no longer exist and
+// that no HelmRelease targets. The ranges of deleted namespaces that a HelmRelease
+// still targets are kept, so that they are restored when the namespace is recreated.
+func (r *HelmReleaseReconciler) pruneRanges(ctx context.Context) error {
+	if !r.PinRanges {
+		return nil
+	}
+	registry := tracker.Registry{Client: r.Client}
+
+	recorded, err := registry.List(ctx)
+	if err != nil || len(recorded) == 0 {
+		return err
+	}
+	var list helmapi.HelmReleaseList
+	if err := r.List(ctx, &list); err != nil {
+		return err
+	}
+	targeted := sets.New[string]()
+	for _, hr := range list.Items {
+		targeted.Insert(hr.GetReleaseNamespace())
+	}
+
+	var gone []string
+	for name := range recorded {
+		if targeted.Has(name) {
+			continue
+		}
+		var ns core.Namespace
+		if err := r.Get(ctx, client.ObjectKey{Name: name}, &ns); apierrors.IsNotFound(err) {
+			gone = append(gone, name)
+		} else if err != nil {
+			return err
+		}
+	}
+	if len(gone) == 0 {
+		return nil
+	}
+	if err := registry.Forget(ctx, gone...); err != nil {
+		return err
+	}
+	if r.DryRun {
+		reportDryRun(ctx, nil, nil, "helmrelease", "ConfigMap", tracker.RegistryName, controllerutil.OperationResultUpdated)
+		return nil
+	}
+	log.FromContext(ctx).Info("forgot uid ranges of deleted namespaces", "namespaces", gone)
+	return nil
+}
+
+// rangeHolder returns another namespace whose uid range overlaps with uidRange.
+func (r *HelmReleaseReconciler) rangeHolder(ctx context.Context, ns, uidRange string) (string, error) {
+	want, err := tracker.ParseRanges(uidRange)
+	if err != nil {
+		return "", err
+	}
+	var list core.NamespaceList
+	if err := r.List(ctx, &list); err != nil {
+		return "", err
+	}
+	for _, other := range list.Items {
+		v, ok := other.Annotations[tracker.KeyUid]
+		if other.Name == ns || !ok {
+			continue
+		}
+		have, err := tracker.ParseRanges(v)
+		if err != nil {
+			continue
+		}
+		for _, a := range want {
+			for _, b := range have {
+				if a.Overlaps(b) {
+					return other.Name, nil
+				}
+			}
+		}
+	}
+	return "", nil
+}
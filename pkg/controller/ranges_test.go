@@ -0,0 +1,270 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"go.bytebuilders.dev/aceshifter/pkg/tracker"
+
+	helmapi "github.com/fluxcd/helm-controller/api/v2"
+	core "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func TestPinRange(t *testing.T) {
+	const (
+		recorded = "1000000/10000"
+		other    = "2000000/10000"
+	)
+	namespace := func(name, uidRange, pinnedFor string) *core.Namespace {
+		ns := &core.Namespace{ObjectMeta: metav1.ObjectMeta{Name: name, UID: types.UID(name + "-uid"), Annotations: map[string]string{}}}
+		if uidRange != "" {
+			ns.Annotations[tracker.KeyUid] = uidRange
+			ns.Annotations[tracker.KeyFsGroup] = uidRange
+		}
+		if pinnedFor != "" {
+			ns.Annotations[tracker.KeyPinnedFor] = pinnedFor
+		}
+		return ns
+	}
+
+	tests := []struct {
+		name       string
+		namespace  *core.Namespace
+		others     []*core.Namespace
+		registry   map[string]string
+		pods       []core.Pod
+		wantRange  string
+		wantPinned bool
+		wantRecord map[string]string
+		event      string
+	}{
+		{
+			name:       "record the range of a namespace",
+			namespace:  namespace("demo", other, ""),
+			wantRange:  other,
+			wantPinned: true,
+			wantRecord: map[string]string{"demo": other},
+		},
+		{
+			name:       "namespace without range",
+			namespace:  namespace("demo", "", ""),
+			wantRecord: map[string]string{},
+		},
+		{
+			name:       "mark a namespace with the recorded range",
+			namespace:  namespace("demo", recorded, ""),
+			registry:   map[string]string{"demo": recorded},
+			wantRange:  recorded,
+			wantPinned: true,
+			wantRecord: map[string]string{"demo": recorded},
+		},
+		{
+			name:       "record the changed range of a pinned namespace",
+			namespace:  namespace("demo", other, "demo-uid"),
+			registry:   map[string]string{"demo": recorded},
+			wantRange:  other,
+			wantPinned: true,
+			wantRecord: map[string]string{"demo": other},
+		},
+		{
+			name:       "restore the range of a recreated namespace",
+			namespace:  namespace("demo", other, "old-uid"),
+			registry:   map[string]string{"demo": recorded},
+			wantRange:  recorded,
+			wantPinned: true,
+			wantRecord: map[string]string{"demo": recorded},
+			event:      core.EventTypeNormal + " " + EventReasonRangeRestored,
+		},
+		{
+			name:       "restore the range of a namespace without range",
+			namespace:  namespace("demo", "", ""),
+			registry:   map[string]string{"demo": recorded},
+			wantRange:  recorded,
+			wantPinned: true,
+			wantRecord: map[string]string{"demo": recorded},
+			event:      core.EventTypeNormal + " " + EventReasonRangeRestored,
+		},
+		{
+			name:       "pods run in the namespace",
+			namespace:  namespace("demo", other, ""),
+			registry:   map[string]string{"demo": recorded},
+			pods:       []core.Pod{{ObjectMeta: metav1.ObjectMeta{Namespace: "demo", Name: "api"}}},
+			wantRange:  other,
+			wantRecord: map[string]string{"demo": recorded},
+			event:      core.EventTypeWarning + " " + EventReasonRangeConflict,
+		},
+		{
+			name:       "another namespace holds the range",
+			namespace:  namespace("demo", other, ""),
+			others:     []*core.Namespace{namespace("web", recorded, "web-uid")},
+			registry:   map[string]string{"demo": recorded},
+			wantRange:  other,
+			wantRecord: map[string]string{"demo": recorded},
+			event:      core.EventTypeWarning + " " + EventReasonRangeConflict,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kc := &fakeRangeClient{
+				namespaces: append([]*core.Namespace{tt.namespace.DeepCopy()}, tt.others...),
+				pods:       tt.pods,
+			}
+			if tt.registry != nil {
+				kc.registry = &core.ConfigMap{
+					ObjectMeta: metav1.ObjectMeta{Namespace: tracker.RegistryNamespace, Name: tracker.RegistryName},
+					Data:       tt.registry,
+				}
+			}
+			recorder := record.NewFakeRecorder(10)
+			r := &HelmReleaseReconciler{Client: kc, Recorder: recorder, PinRanges: true}
+
+			ns := tt.namespace.DeepCopy()
+			if err := r.pinRange(context.TODO(), ns); err != nil {
+				t.Fatal(err)
+			}
+			if got := ns.Annotations[tracker.KeyUid]; got != tt.wantRange {
+				t.Errorf("expected range %q, got %q", tt.wantRange, got)
+			}
+			if got := kc.namespaces[0].Annotations[tracker.KeyUid]; got != tt.wantRange {
+				t.Errorf("expected stored range %q, got %q", tt.wantRange, got)
+			}
+			if pinned := ns.Annotations[tracker.KeyPinnedFor] == string(ns.UID); pinned != tt.wantPinned {
+				t.Errorf("expected pinned %v, got %v", tt.wantPinned, pinned)
+			}
+			var data map[string]string
+			if kc.registry != nil {
+				data = kc.registry.Data
+			}
+			if len(data) != 0 || len(tt.wantRecord) != 0 {
+				if !reflect.DeepEqual(data, tt.wantRecord) {
+					t.Errorf("expected recorded ranges %v, got %v", tt.wantRecord, data)
+				}
+			}
+			var event string
+			select {
+			case event = <-recorder.Events:
+			default:
+			}
+			if !strings.HasPrefix(event, tt.event) || (tt.event == "") != (event == "") {
+				t.Errorf("expected event %q, got %q", tt.event, event)
+			}
+		})
+	}
+}
+
+func TestPruneRanges(t *testing.T) {
+	kc := &fakeRangeClient{
+		namespaces: []*core.Namespace{{ObjectMeta: metav1.ObjectMeta{Name: "live"}}},
+		registry: &core.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Namespace: tracker.RegistryNamespace, Name: tracker.RegistryName},
+			Data: map[string]string{
+				"live":     "1000000/10000",
+				"targeted": "2000000/10000",
+				"deleted":  "3000000/10000",
+			},
+		},
+		releases: []helmapi.HelmRelease{{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "kubeops", Name: "demo"},
+			Spec:       helmapi.HelmReleaseSpec{TargetNamespace: "targeted"},
+		}},
+	}
+	r := &HelmReleaseReconciler{Client: kc, PinRanges: true}
+	if err := r.pruneRanges(context.TODO()); err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]string{"live": "1000000/10000", "targeted": "2000000/10000"}
+	if !reflect.DeepEqual(kc.registry.Data, expected) {
+		t.Errorf("expected recorded ranges %v, got %v", expected, kc.registry.Data)
+	}
+}
+
+// fakeRangeClient serves the namespaces, pods, HelmReleases and the uid range
+// registry read by pinRange and pruneRanges and stores their patches.
+type fakeRangeClient struct {
+	client.Client
+	namespaces []*core.Namespace
+	registry   *core.ConfigMap
+	pods       []core.Pod
+	releases   []helmapi.HelmRelease
+}
+
+func (c *fakeRangeClient) Get(_ context.Context, key client.ObjectKey, obj client.Object, _ ...client.GetOption) error {
+	switch o := obj.(type) {
+	case *core.Namespace:
+		for _, ns := range c.namespaces {
+			if ns.Name == key.Name {
+				ns.DeepCopyInto(o)
+				return nil
+			}
+		}
+	case *core.ConfigMap:
+		if c.registry != nil && key.Name == tracker.RegistryName {
+			c.registry.DeepCopyInto(o)
+			return nil
+		}
+	}
+	return apierrors.NewNotFound(schema.GroupResource{}, key.Name)
+}
+
+func (c *fakeRangeClient) List(_ context.Context, list client.ObjectList, opts ...client.ListOption) error {
+	var o client.ListOptions
+	o.ApplyOptions(opts)
+	switch l := list.(type) {
+	case *core.NamespaceList:
+		for _, ns := range c.namespaces {
+			l.Items = append(l.Items, *ns.DeepCopy())
+		}
+	case *core.PodList:
+		for _, pod := range c.pods {
+			if o.Namespace == "" || pod.Namespace == o.Namespace {
+				l.Items = append(l.Items, pod)
+			}
+		}
+	case *helmapi.HelmReleaseList:
+		l.Items = append(l.Items, c.releases...)
+	}
+	return nil
+}
+
+func (c *fakeRangeClient) Create(_ context.Context, obj client.Object, _ ...client.CreateOption) error {
+	c.registry = obj.(*core.ConfigMap).DeepCopy()
+	return nil
+}
+
+func (c *fakeRangeClient) Patch(_ context.Context, obj client.Object, _ client.Patch, _ ...client.PatchOption) error {
+	switch o := obj.(type) {
+	case *core.Namespace:
+		for i, ns := range c.namespaces {
+			if ns.Name == o.Name {
+				c.namespaces[i] = o.DeepCopy()
+			}
+		}
+	case *core.ConfigMap:
+		c.registry = o.DeepCopy()
+	}
+	return nil
+}
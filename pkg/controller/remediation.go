@@ -0,0 +1,554 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"slices"
+	"strconv"
+	"time"
+
+	"go.bytebuilders.dev/aceshifter/pkg/tracker"
+
+	helmapi "github.com/fluxcd/helm-controller/api/v2"
+	apps "k8s.io/api/apps/v1"
+	batch "k8s.io/api/batch/v1"
+	core "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// RemediationStatusName is the ConfigMap that reports the volume remediation
+	// progress of each HelmRelease, keyed the same way as the overlay ConfigMap.
+	RemediationStatusName = "ace-openshift-remediation"
+	// KeyRequiredSCC asks OpenShift to admit a pod with the named SCC.
+	KeyRequiredSCC = "openshift.io/required-scc"
+
+	LabelInstance = "app.kubernetes.io/instance"
+
+	// KeyRemediationReplicas is set on the workloads scaled down for a volume
+	// remediation, to the replicas restored once it succeeded.
+	KeyRemediationReplicas = "aceshifter.appscode.com/replicas-before-remediation"
+
+	EventReasonRemediationStarted = "VolumeRemediationStarted"
+	EventReasonRemediationFailed  = "VolumeRemediationFailed"
+	EventReasonRemediationStuck   = "VolumeRemediationStuck"
+
+	remediationPollInterval = 30 * time.Second
+	// remediationStartTimeout is how long a remediation Job may run without a pod
+	// before it is reported, eg, because SCC admission forbids its pods.
+	remediationStartTimeout = 2 * time.Minute
+)
+
+type RemediationPhase string
+
+const (
+	RemediationRunning   RemediationPhase = "Running"
+	RemediationSucceeded RemediationPhase = "Succeeded"
+	RemediationFailed    RemediationPhase = "Failed"
+)
+
+// VolumeRemediation configures the Jobs that move PVC data to a new uid range.
+type VolumeRemediation struct {
+	Image string
+	// ServiceAccount runs the remediation pods. It is created in the target
+	// namespaces if missing.
+	ServiceAccount string
+	// SCC is required for the remediation pods. It must allow running as root
+	// with the CHOWN, FOWNER and DAC_READ_SEARCH capabilities and nothing more.
+	// It is created if missing, and ServiceAccount is added to its users if it
+	// is managed by aceshifter. No SCC is required if empty.
+	SCC string
+	// Timeout is the deadline of a remediation Job.
+	Timeout time.Duration
+	// ResumeOnFailure scales the workloads back up and lets the new overlay be written
+	// when a remediation Job fails. Otherwise they stay scaled down until the failed
+	// Jobs are deleted to retry the remediation.
+	ResumeOnFailure bool
+}
+
+type RemediationStatus struct {
+	Namespace string                      `json:"namespace"`
+	From      int64                       `json:"from"`
+	To        int64                       `json:"to"`
+	Phase     RemediationPhase            `json:"phase"`
+	Volumes   map[string]RemediationPhase `json:"volumes,omitempty"`
+}
+
+// remediateVolumes runs a Job for each PVC of a HelmRelease whose namespace uid range
+// changed since its overlay was last rendered. The Jobs shift the owner and group of
+// files from the old range to the same offset in the new range. The Deployments and
+// StatefulSets of the release are scaled down first, so that no pod writes to the
+// volumes while they are remediated, and scaled back up once all Jobs succeeded, or
+// failed if ResumeOnFailure is set. The SELinux labels of the files are not changed;
+// the kubelet relabels a volume for the MCS level of the new range when a pod mounts
+// it, unless its volume plugin does not support SELinux relabeling.
+// It returns true once the workloads are restored and the new overlay can be written.
+func (r *HelmReleaseReconciler) remediateVolumes(ctx context.Context, hr *helmapi.HelmRelease, configKey, lastUid string, cur tracker.Range) (bool, error) {
+	if lastUid == "" {
+		return true, nil
+	}
+	from, err := strconv.ParseInt(lastUid, 10, 64)
+	if err != nil || from == cur.Start {
+		return true, nil
+	}
+
+	ns := hr.GetReleaseNamespace()
+	var pvcs core.PersistentVolumeClaimList
+	if err := r.List(ctx, &pvcs, client.InNamespace(ns), client.MatchingLabels{LabelInstance: hr.GetReleaseName()}); err != nil {
+		return false, err
+	}
+	if len(pvcs.Items) == 0 {
+		return true, nil
+	}
+
+	status := RemediationStatus{
+		Namespace: ns,
+		From:      from,
+		To:        cur.Start,
+		Phase:     RemediationRunning,
+		Volumes:   map[string]RemediationPhase{},
+	}
+	stopped, err := r.stopWorkloads(ctx, hr, pvcs.Items)
+	if err != nil {
+		return false, err
+	}
+	if !stopped {
+		return false, r.writeRemediationStatus(ctx, configKey, status)
+	}
+	if err := r.ensureRemediationAccess(ctx, hr, ns); err != nil {
+		return false, err
+	}
+	prev, err := r.remediationStatus(ctx, configKey)
+	if err != nil {
+		return false, err
+	}
+	if prev != nil && (prev.From != from || prev.To != cur.Start) {
+		prev = nil
+	}
+
+	status.Phase = RemediationSucceeded
+	for _, pvc := range pvcs.Items {
+		var prevPhase RemediationPhase
+		if prev != nil {
+			prevPhase = prev.Volumes[pvc.Name]
+		}
+		phase, err := r.remediateVolume(ctx, hr, &pvc, tracker.Range{Start: from, Size: cur.Size}, cur, prevPhase)
+		if err != nil {
+			return false, err
+		}
+		status.Volumes[pvc.Name] = phase
+		switch {
+		case phase == RemediationFailed:
+			status.Phase = RemediationFailed
+		case phase == RemediationRunning && status.Phase != RemediationFailed:
+			status.Phase = RemediationRunning
+		}
+	}
+	// the status is polled, only report the change to failed
+	if status.Phase == RemediationFailed && (prev == nil || prev.Phase != RemediationFailed) {
+		if r.VolumeRemediation.ResumeOnFailure {
+			r.Recorder.Eventf(hr, core.EventTypeWarning, EventReasonRemediationFailed,
+				"volume ownership remediation from uid %d to %d failed, resuming the workloads with files left in the old range", from, cur.Start)
+		} else {
+			r.Recorder.Eventf(hr, core.EventTypeWarning, EventReasonRemediationFailed,
+				"volume ownership remediation from uid %d to %d failed, the workloads stay scaled down until the failed Jobs in namespace %s are deleted to retry",
+				from, cur.Start, ns)
+		}
+	}
+	if err := r.writeRemediationStatus(ctx, configKey, status); err != nil {
+		return false, err
+	}
+	if status.Phase == RemediationRunning || (status.Phase == RemediationFailed && !r.VolumeRemediation.ResumeOnFailure) {
+		return false, nil
+	}
+	return true, r.resumeWorkloads(ctx, hr, cur.Start)
+}
+
+// remediateVolume starts the remediation Job of a PVC or returns the phase of the
+// existing one. prev is the phase reported by the previous poll.
+func (r *HelmReleaseReconciler) remediateVolume(ctx context.Context, hr *helmapi.HelmRelease, pvc *core.PersistentVolumeClaim, from, to tracker.Range, prev RemediationPhase) (RemediationPhase, error) {
+	h := fnv.New32a()
+	_, _ = fmt.Fprintf(h, "%s/%d/%d", pvc.Name, from.Start, to.Start)
+	name := pvc.Name
+	if len(name) > 40 {
+		name = name[:40]
+	}
+	name = fmt.Sprintf("aceshifter-chown-%s-%x", name, h.Sum32())
+
+	var job batch.Job
+	err := r.Get(ctx, client.ObjectKey{Namespace: pvc.Namespace, Name: name}, &job)
+	if err == nil {
+		for _, c := range job.Status.Conditions {
+			if c.Status != core.ConditionTrue {
+				continue
+			}
+			switch c.Type {
+			case batch.JobComplete:
+				return RemediationSucceeded, nil
+			case batch.JobFailed:
+				if c.Reason == batch.JobReasonDeadlineExceeded && prev != RemediationFailed {
+					r.Recorder.Eventf(hr, core.EventTypeWarning, EventReasonRemediationFailed,
+						"Job %s/%s did not finish within %s", pvc.Namespace, name, r.VolumeRemediation.Timeout)
+				}
+				return RemediationFailed, nil
+			}
+		}
+		if job.Status.Active == 0 && job.Status.Succeeded == 0 && job.Status.Failed == 0 &&
+			time.Since(job.CreationTimestamp.Time) > remediationStartTimeout {
+			r.Recorder.Eventf(hr, core.EventTypeWarning, EventReasonRemediationStuck,
+				"Job %s/%s has no pod after %s, check that ServiceAccount %s may use SCC %s",
+				pvc.Namespace, name, remediationStartTimeout, r.VolumeRemediation.ServiceAccount, r.VolumeRemediation.SCC)
+		}
+		return RemediationRunning, nil
+	} else if !apierrors.IsNotFound(err) {
+		return "", err
+	}
+
+	job = r.remediationJob(name, pvc, from, to)
+	if err := r.Create(ctx, &job); client.IgnoreAlreadyExists(err) != nil {
+		return "", err
+	}
+	if r.DryRun {
+		// the Job is never created, report it without an event on every reconcile
+		reportDryRun(ctx, nil, nil, "helmrelease", "Job", pvc.Namespace+"/"+name, controllerutil.OperationResultCreated)
+		return RemediationRunning, nil
+	}
+	log.FromContext(ctx).Info("started volume remediation", "pvc", pvc.Name, "job", name)
+	r.Recorder.Eventf(hr, core.EventTypeNormal, EventReasonRemediationStarted,
+		"started Job %s/%s to move PVC %s from uid range %v to %v", pvc.Namespace, name, pvc.Name, from, to)
+	return RemediationRunning, nil
+}
+
+// stopWorkloads scales the Deployments and StatefulSets of a HelmRelease down to zero
+// and records their replicas. It returns true once no pod other than the remediation
+// pods mounts the PVCs.
+func (r *HelmReleaseReconciler) stopWorkloads(ctx context.Context, hr *helmapi.HelmRelease, pvcs []core.PersistentVolumeClaim) (bool, error) {
+	workloads, err := r.releaseWorkloads(ctx, hr)
+	if err != nil {
+		return false, err
+	}
+	for _, w := range workloads {
+		replicas := workloadReplicas(w)
+		if replicas == nil || *replicas == 0 {
+			continue
+		}
+		if _, ok := w.GetAnnotations()[KeyRemediationReplicas]; ok {
+			continue
+		}
+		patch := client.MergeFrom(w.DeepCopyObject().(client.Object))
+		annotations := w.GetAnnotations()
+		if annotations == nil {
+			annotations = map[string]string{}
+		}
+		annotations[KeyRemediationReplicas] = strconv.FormatInt(int64(*replicas), 10)
+		w.SetAnnotations(annotations)
+		*replicas = 0
+		if err := r.Patch(ctx, w, patch); err != nil {
+			return false, err
+		}
+		if r.DryRun {
+			reportDryRun(ctx, nil, nil, "helmrelease", workloadKind(w), w.GetNamespace()+"/"+w.GetName(), controllerutil.OperationResultUpdated)
+			continue
+		}
+		log.FromContext(ctx).Info("scaled down workload for volume remediation", "kind", workloadKind(w), "name", w.GetName())
+	}
+	if r.DryRun {
+		// the workloads are not scaled down, report the Jobs as if they were
+		return true, nil
+	}
+
+	claims := map[string]bool{}
+	for _, pvc := range pvcs {
+		claims[pvc.Name] = true
+	}
+	var pods core.PodList
+	if err := r.List(ctx, &pods, client.InNamespace(hr.GetReleaseNamespace())); err != nil {
+		return false, err
+	}
+	for _, pod := range pods.Items {
+		if pod.Labels[tracker.LabelManagedBy] == tracker.ManagedBy ||
+			pod.Status.Phase == core.PodSucceeded || pod.Status.Phase == core.PodFailed {
+			continue
+		}
+		for _, vol := range pod.Spec.Volumes {
+			if vol.PersistentVolumeClaim != nil && claims[vol.PersistentVolumeClaim.ClaimName] {
+				return false, nil
+			}
+		}
+	}
+	return true, nil
+}
+
+// resumeWorkloads restores the replicas recorded by stopWorkloads. The pod templates
+// are marked as restarted for the new range, so that restartWorkloads does not roll
+// the pods again.
+func (r *HelmReleaseReconciler) resumeWorkloads(ctx context.Context, hr *helmapi.HelmRelease, uidStart int64) error {
+	workloads, err := r.releaseWorkloads(ctx, hr)
+	if err != nil {
+		return err
+	}
+	for _, w := range workloads {
+		v, ok := w.GetAnnotations()[KeyRemediationReplicas]
+		if !ok {
+			continue
+		}
+		n, err := strconv.ParseInt(v, 10, 32)
+		if err != nil {
+			return fmt.Errorf("invalid %s annotation on %s: %w", KeyRemediationReplicas, w.GetName(), err)
+		}
+		patch := client.MergeFrom(w.DeepCopyObject().(client.Object))
+		annotations := w.GetAnnotations()
+		delete(annotations, KeyRemediationReplicas)
+		w.SetAnnotations(annotations)
+		*workloadReplicas(w) = int32(n)
+		metav1.SetMetaDataAnnotation(&podTemplate(w).ObjectMeta, KeyRestartedFor, strconv.FormatInt(uidStart, 10))
+		if err := r.Patch(ctx, w, patch); err != nil {
+			return err
+		}
+		log.FromContext(ctx).Info("restored workload after volume remediation", "kind", workloadKind(w), "name", w.GetName(), "replicas", n)
+	}
+	return nil
+}
+
+func workloadReplicas(obj client.Object) *int32 {
+	switch w := obj.(type) {
+	case *apps.Deployment:
+		if w.Spec.Replicas == nil {
+			w.Spec.Replicas = ptr.To[int32](1)
+		}
+		return w.Spec.Replicas
+	case *apps.StatefulSet:
+		if w.Spec.Replicas == nil {
+			w.Spec.Replicas = ptr.To[int32](1)
+		}
+		return w.Spec.Replicas
+	}
+	return nil
+}
+
+// ensureRemediationAccess creates the ServiceAccount of the remediation pods in a
+// namespace and the SCC they require. The ServiceAccount is added to the users of
+// an SCC managed by aceshifter; an SCC created by the cluster admin is left as is.
+func (r *HelmReleaseReconciler) ensureRemediationAccess(ctx context.Context, hr *helmapi.HelmRelease, ns string) error {
+	sa := core.ServiceAccount{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      r.VolumeRemediation.ServiceAccount,
+			Namespace: ns,
+		},
+	}
+	if err := r.Get(ctx, client.ObjectKeyFromObject(&sa), &sa); apierrors.IsNotFound(err) {
+		sa.Labels = map[string]string{tracker.LabelManagedBy: tracker.ManagedBy}
+		if err := r.Create(ctx, &sa); client.IgnoreAlreadyExists(err) != nil {
+			return err
+		}
+	} else if err != nil {
+		return err
+	}
+
+	if r.VolumeRemediation.SCC == "" {
+		return nil
+	}
+	user := tracker.ServiceAccountUser(ns, sa.Name)
+	scc := &unstructured.Unstructured{}
+	scc.SetGroupVersionKind(tracker.SCCGVK)
+	err := r.Get(ctx, client.ObjectKey{Name: r.VolumeRemediation.SCC}, scc)
+	if apierrors.IsNotFound(err) {
+		scc = remediationSCC(r.VolumeRemediation.SCC, user)
+		if err := r.Create(ctx, scc); client.IgnoreAlreadyExists(err) != nil {
+			return err
+		}
+		log.FromContext(ctx).Info("created volume remediation SCC", "scc", scc.GetName())
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if scc.GetLabels()[tracker.LabelManagedBy] != tracker.ManagedBy {
+		return nil
+	}
+	users, _, _ := unstructured.NestedStringSlice(scc.Object, "users")
+	if slices.Contains(users, user) {
+		return nil
+	}
+	patch := client.MergeFrom(scc.DeepCopy())
+	if err := unstructured.SetNestedStringSlice(scc.Object, append(users, user), "users"); err != nil {
+		return err
+	}
+	return r.Patch(ctx, scc, patch)
+}
+
+// remediationSCC allows running as root with only the capabilities needed to change
+// the owner of files, on PVCs and the projected ServiceAccount token.
+func remediationSCC(name, user string) *unstructured.Unstructured {
+	scc := &unstructured.Unstructured{Object: map[string]any{
+		"allowHostDirVolumePlugin": false,
+		"allowHostIPC":             false,
+		"allowHostNetwork":         false,
+		"allowHostPID":             false,
+		"allowHostPorts":           false,
+		"allowPrivilegeEscalation": false,
+		"allowPrivilegedContainer": false,
+		"allowedCapabilities":      []any{"CHOWN", "FOWNER", "DAC_READ_SEARCH"},
+		"requiredDropCapabilities": []any{"ALL"},
+		"readOnlyRootFilesystem":   false,
+		"runAsUser":                map[string]any{"type": "RunAsAny"},
+		"seLinuxContext":           map[string]any{"type": "MustRunAs"},
+		"fsGroup":                  map[string]any{"type": "RunAsAny"},
+		"supplementalGroups":       map[string]any{"type": "RunAsAny"},
+		"seccompProfiles":          []any{"runtime/default"},
+		"volumes":                  []any{"persistentVolumeClaim", "projected"},
+		"users":                    []any{user},
+		"groups":                   []any{},
+	}}
+	scc.SetGroupVersionKind(tracker.SCCGVK)
+	scc.SetName(name)
+	scc.SetLabels(map[string]string{tracker.LabelManagedBy: tracker.ManagedBy})
+	return scc
+}
+
+// remediationScript shifts the owner and group of each file in the old range. find
+// passes the file names as arguments, so that names with newlines are handled.
+const remediationScript = `set -eu
+find /data -xdev -exec sh -c 'set -eu
+for f; do
+  u=$(stat -c %u "$f")
+  g=$(stat -c %g "$f")
+  nu=$u
+  ng=$g
+  if [ "$u" -ge "$FROM" ] && [ "$u" -lt "$FROM_END" ]; then nu=$((u - FROM + TO)); fi
+  if [ "$g" -ge "$FROM" ] && [ "$g" -lt "$FROM_END" ]; then ng=$((g - FROM + TO)); fi
+  if [ "$nu:$ng" != "$u:$g" ]; then chown -h "$nu:$ng" "$f"; fi
+done' sh {} +
+`
+
+func (r *HelmReleaseReconciler) remediationJob(name string, pvc *core.PersistentVolumeClaim, from, to tracker.Range) batch.Job {
+	job := batch.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: pvc.Namespace,
+			Labels: map[string]string{
+				tracker.LabelManagedBy: tracker.ManagedBy,
+			},
+		},
+		Spec: batch.JobSpec{
+			BackoffLimit:            ptr.To[int32](2),
+			TTLSecondsAfterFinished: ptr.To[int32](3600),
+			Template: core.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: map[string]string{
+						tracker.LabelManagedBy: tracker.ManagedBy,
+					},
+				},
+				Spec: core.PodSpec{
+					RestartPolicy:      core.RestartPolicyOnFailure,
+					ServiceAccountName: r.VolumeRemediation.ServiceAccount,
+					Containers: []core.Container{
+						{
+							Name:    "chown",
+							Image:   r.VolumeRemediation.Image,
+							Command: []string{"/bin/sh", "-c", remediationScript},
+							Env: []core.EnvVar{
+								{Name: "FROM", Value: strconv.FormatInt(from.Start, 10)},
+								{Name: "FROM_END", Value: strconv.FormatInt(from.Start+from.Size, 10)},
+								{Name: "TO", Value: strconv.FormatInt(to.Start, 10)},
+							},
+							SecurityContext: &core.SecurityContext{
+								RunAsUser:                ptr.To[int64](0),
+								RunAsNonRoot:             ptr.To(false),
+								AllowPrivilegeEscalation: ptr.To(false),
+								Capabilities: &core.Capabilities{
+									Drop: []core.Capability{"ALL"},
+									Add:  []core.Capability{"CHOWN", "FOWNER", "DAC_READ_SEARCH"},
+								},
+							},
+							VolumeMounts: []core.VolumeMount{
+								{Name: "data", MountPath: "/data"},
+							},
+						},
+					},
+					Volumes: []core.Volume{
+						{
+							Name: "data",
+							VolumeSource: core.VolumeSource{
+								PersistentVolumeClaim: &core.PersistentVolumeClaimVolumeSource{
+									ClaimName: pvc.Name,
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+	if r.VolumeRemediation.Timeout > 0 {
+		job.Spec.ActiveDeadlineSeconds = ptr.To(int64(r.VolumeRemediation.Timeout.Seconds()))
+	}
+	if r.VolumeRemediation.SCC != "" {
+		job.Spec.Template.Annotations = map[string]string{
+			KeyRequiredSCC: r.VolumeRemediation.SCC,
+		}
+	}
+	return job
+}
+
+// remediationStatus returns the volume remediation status last written for a
+// HelmRelease, or nil if there is none.
+func (r *HelmReleaseReconciler) remediationStatus(ctx context.Context, configKey string) (*RemediationStatus, error) {
+	var cm core.ConfigMap
+	if err := r.Get(ctx, client.ObjectKey{Namespace: tracker.OverlayNamespace, Name: RemediationStatusName}, &cm); err != nil {
+		return nil, client.IgnoreNotFound(err)
+	}
+	data, ok := cm.Data[configKey]
+	if !ok {
+		return nil, nil
+	}
+	var status RemediationStatus
+	if err := yaml.Unmarshal([]byte(data), &status); err != nil {
+		return nil, fmt.Errorf("failed to parse the volume remediation status of %s: %w", configKey, err)
+	}
+	return &status, nil
+}
+
+func (r *HelmReleaseReconciler) writeRemediationStatus(ctx context.Context, configKey string, status RemediationStatus) error {
+	data, err := yaml.Marshal(status)
+	if err != nil {
+		return err
+	}
+	cm := core.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      RemediationStatusName,
+			Namespace: tracker.OverlayNamespace,
+		},
+	}
+	_, err = controllerutil.CreateOrPatch(ctx, r.Client, &cm, func() error {
+		if cm.Data == nil {
+			cm.Data = map[string]string{}
+		}
+		cm.Data[configKey] = string(data)
+		return nil
+	})
+	return err
+}
@@ -0,0 +1,305 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"go.bytebuilders.dev/aceshifter/pkg/tracker"
+
+	helmapi "github.com/fluxcd/helm-controller/api/v2"
+	apps "k8s.io/api/apps/v1"
+	batch "k8s.io/api/batch/v1"
+	core "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func releaseAnnotations() map[string]string {
+	return map[string]string{tracker.KeyHelmReleaseName: "demo", tracker.KeyHelmReleaseNamespace: "demo"}
+}
+
+func TestStopWorkloads(t *testing.T) {
+	pvcs := []core.PersistentVolumeClaim{{ObjectMeta: metav1.ObjectMeta{Namespace: "demo", Name: "data"}}}
+	pod := func(name string, phase core.PodPhase, managed bool) core.Pod {
+		p := core.Pod{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "demo", Name: name},
+			Spec: core.PodSpec{Volumes: []core.Volume{{
+				Name:         "data",
+				VolumeSource: core.VolumeSource{PersistentVolumeClaim: &core.PersistentVolumeClaimVolumeSource{ClaimName: "data"}},
+			}}},
+			Status: core.PodStatus{Phase: phase},
+		}
+		if managed {
+			p.Labels = map[string]string{tracker.LabelManagedBy: tracker.ManagedBy}
+		}
+		return p
+	}
+
+	tests := []struct {
+		name    string
+		pods    []core.Pod
+		stopped bool
+	}{
+		{name: "no pods", stopped: true},
+		{name: "pod still mounts the volume", pods: []core.Pod{pod("db-0", core.PodRunning, false)}},
+		{name: "finished pod", pods: []core.Pod{pod("db-0", core.PodSucceeded, false)}, stopped: true},
+		{name: "remediation pod", pods: []core.Pod{pod("aceshifter-chown", core.PodRunning, true)}, stopped: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kc := &fakeRemediationClient{
+				fakeRestartClient: fakeRestartClient{deployments: []*apps.Deployment{
+					{
+						ObjectMeta: metav1.ObjectMeta{Namespace: "demo", Name: "api", Annotations: releaseAnnotations()},
+						Spec:       apps.DeploymentSpec{Replicas: ptr.To[int32](2)},
+					},
+					{
+						ObjectMeta: metav1.ObjectMeta{Namespace: "demo", Name: "idle", Annotations: releaseAnnotations()},
+						Spec:       apps.DeploymentSpec{Replicas: ptr.To[int32](0)},
+					},
+				}},
+				statefulSets: []*apps.StatefulSet{{
+					ObjectMeta: metav1.ObjectMeta{Namespace: "demo", Name: "db", Annotations: releaseAnnotations()},
+				}},
+				pods: tt.pods,
+			}
+			r := &HelmReleaseReconciler{Client: kc}
+			hr := &helmapi.HelmRelease{ObjectMeta: metav1.ObjectMeta{Namespace: "demo", Name: "demo"}}
+			stopped, err := r.stopWorkloads(context.TODO(), hr, pvcs)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if stopped != tt.stopped {
+				t.Errorf("expected stopped %v, got %v", tt.stopped, stopped)
+			}
+
+			api, db := kc.deployments[0], kc.statefulSets[0]
+			if *api.Spec.Replicas != 0 || api.Annotations[KeyRemediationReplicas] != "2" {
+				t.Errorf("expected api to be scaled down from 2, got %d replicas and %q", *api.Spec.Replicas, api.Annotations[KeyRemediationReplicas])
+			}
+			// the default replicas of a workload are recorded
+			if *db.Spec.Replicas != 0 || db.Annotations[KeyRemediationReplicas] != "1" {
+				t.Errorf("expected db to be scaled down from 1, got %d replicas and %q", *db.Spec.Replicas, db.Annotations[KeyRemediationReplicas])
+			}
+			if _, ok := kc.deployments[1].Annotations[KeyRemediationReplicas]; ok {
+				t.Error("expected idle to be left as is")
+			}
+
+			// stopping again keeps the recorded replicas
+			if _, err := r.stopWorkloads(context.TODO(), hr, pvcs); err != nil {
+				t.Fatal(err)
+			}
+			if v := kc.deployments[0].Annotations[KeyRemediationReplicas]; v != "2" {
+				t.Errorf("expected the recorded replicas to be kept, got %q", v)
+			}
+		})
+	}
+}
+
+func TestResumeWorkloads(t *testing.T) {
+	stopped := func(replicas string) map[string]string {
+		a := releaseAnnotations()
+		a[KeyRemediationReplicas] = replicas
+		return a
+	}
+	kc := &fakeRemediationClient{
+		fakeRestartClient: fakeRestartClient{deployments: []*apps.Deployment{
+			{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "demo", Name: "api", Annotations: stopped("2")},
+				Spec:       apps.DeploymentSpec{Replicas: ptr.To[int32](0)},
+			},
+			{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "demo", Name: "ui", Annotations: releaseAnnotations()},
+				Spec:       apps.DeploymentSpec{Replicas: ptr.To[int32](3)},
+			},
+		}},
+		statefulSets: []*apps.StatefulSet{{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "demo", Name: "db", Annotations: stopped("1")},
+			Spec:       apps.StatefulSetSpec{Replicas: ptr.To[int32](0)},
+		}},
+	}
+	r := &HelmReleaseReconciler{Client: kc}
+	hr := &helmapi.HelmRelease{ObjectMeta: metav1.ObjectMeta{Namespace: "demo", Name: "demo"}}
+	if err := r.resumeWorkloads(context.TODO(), hr, 1000000); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		obj       client.Object
+		replicas  int32
+		restarted string
+	}{
+		{obj: kc.deployments[0], replicas: 2, restarted: "1000000"},
+		{obj: kc.deployments[1], replicas: 3},
+		{obj: kc.statefulSets[0], replicas: 1, restarted: "1000000"},
+	} {
+		if _, ok := tt.obj.GetAnnotations()[KeyRemediationReplicas]; ok {
+			t.Errorf("expected the %s annotation to be removed from %s", KeyRemediationReplicas, tt.obj.GetName())
+		}
+		if got := *workloadReplicas(tt.obj); got != tt.replicas {
+			t.Errorf("expected %s to have %d replicas, got %d", tt.obj.GetName(), tt.replicas, got)
+		}
+		// resumed pods already run with the new range and are not restarted again
+		if got := podTemplate(tt.obj).Annotations[KeyRestartedFor]; got != tt.restarted {
+			t.Errorf("expected %s to be marked restarted for %q, got %q", tt.obj.GetName(), tt.restarted, got)
+		}
+	}
+
+	kc.deployments[0].Annotations[KeyRemediationReplicas] = "two"
+	if err := r.resumeWorkloads(context.TODO(), hr, 1000000); err == nil {
+		t.Error("expected an error for invalid recorded replicas")
+	}
+}
+
+func TestRemediateVolume(t *testing.T) {
+	pvc := &core.PersistentVolumeClaim{ObjectMeta: metav1.ObjectMeta{Namespace: "demo", Name: "data"}}
+	from := tracker.Range{Start: 1000000, Size: 10000}
+	to := tracker.Range{Start: 2000000, Size: 10000}
+	condition := func(typ batch.JobConditionType, reason string) []batch.JobCondition {
+		return []batch.JobCondition{{Type: typ, Status: core.ConditionTrue, Reason: reason}}
+	}
+
+	kc := &fakeRemediationClient{}
+	recorder := record.NewFakeRecorder(10)
+	r := &HelmReleaseReconciler{
+		Client:   kc,
+		Recorder: recorder,
+		VolumeRemediation: &VolumeRemediation{
+			Image:          "busybox",
+			ServiceAccount: "aceshifter-remediation",
+			SCC:            "aceshifter-remediation",
+			Timeout:        time.Hour,
+		},
+	}
+	hr := &helmapi.HelmRelease{ObjectMeta: metav1.ObjectMeta{Namespace: "demo", Name: "demo"}}
+
+	tests := []struct {
+		name       string
+		conditions []batch.JobCondition
+		created    time.Time
+		prev       RemediationPhase
+		phase      RemediationPhase
+		event      string
+	}{
+		{name: "job created", phase: RemediationRunning, event: core.EventTypeNormal + " " + EventReasonRemediationStarted},
+		{name: "job running", created: time.Now(), phase: RemediationRunning},
+		{name: "job without pods", created: time.Now().Add(-2 * remediationStartTimeout), phase: RemediationRunning, event: core.EventTypeWarning + " " + EventReasonRemediationStuck},
+		{
+			name:       "job past its deadline",
+			conditions: condition(batch.JobFailed, batch.JobReasonDeadlineExceeded),
+			prev:       RemediationRunning,
+			phase:      RemediationFailed,
+			event:      core.EventTypeWarning + " " + EventReasonRemediationFailed,
+		},
+		{
+			name:       "job past its deadline already reported",
+			conditions: condition(batch.JobFailed, batch.JobReasonDeadlineExceeded),
+			prev:       RemediationFailed,
+			phase:      RemediationFailed,
+		},
+		{name: "job failed", conditions: condition(batch.JobFailed, batch.JobReasonBackoffLimitExceeded), phase: RemediationFailed},
+		{name: "job complete", conditions: condition(batch.JobComplete, ""), phase: RemediationSucceeded},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, job := range kc.jobs {
+				job.Status.Conditions = tt.conditions
+				job.CreationTimestamp = metav1.NewTime(tt.created)
+			}
+			phase, err := r.remediateVolume(context.TODO(), hr, pvc, from, to, tt.prev)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if phase != tt.phase {
+				t.Errorf("expected phase %s, got %s", tt.phase, phase)
+			}
+			if len(kc.jobs) != 1 {
+				t.Fatalf("expected one Job, got %d", len(kc.jobs))
+			}
+			var event string
+			select {
+			case event = <-recorder.Events:
+			default:
+			}
+			if !strings.HasPrefix(event, tt.event) || (tt.event == "") != (event == "") {
+				t.Errorf("expected event %q, got %q", tt.event, event)
+			}
+		})
+	}
+}
+
+// fakeRemediationClient adds the StatefulSets, Pods and Jobs read by the volume
+// remediation to fakeRestartClient.
+type fakeRemediationClient struct {
+	fakeRestartClient
+	statefulSets []*apps.StatefulSet
+	pods         []core.Pod
+	jobs         []*batch.Job
+}
+
+func (c *fakeRemediationClient) Get(_ context.Context, key client.ObjectKey, obj client.Object, _ ...client.GetOption) error {
+	if job, ok := obj.(*batch.Job); ok {
+		for _, j := range c.jobs {
+			if j.Namespace == key.Namespace && j.Name == key.Name {
+				j.DeepCopyInto(job)
+				return nil
+			}
+		}
+	}
+	return apierrors.NewNotFound(schema.GroupResource{}, key.Name)
+}
+
+func (c *fakeRemediationClient) Create(_ context.Context, obj client.Object, _ ...client.CreateOption) error {
+	if job, ok := obj.(*batch.Job); ok {
+		c.jobs = append(c.jobs, job.DeepCopy())
+	}
+	return nil
+}
+
+func (c *fakeRemediationClient) List(ctx context.Context, list client.ObjectList, opts ...client.ListOption) error {
+	switch l := list.(type) {
+	case *apps.StatefulSetList:
+		for _, s := range c.statefulSets {
+			l.Items = append(l.Items, *s.DeepCopy())
+		}
+	case *core.PodList:
+		l.Items = append(l.Items, c.pods...)
+	default:
+		return c.fakeRestartClient.List(ctx, list, opts...)
+	}
+	return nil
+}
+
+func (c *fakeRemediationClient) Patch(ctx context.Context, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+	if s, ok := obj.(*apps.StatefulSet); ok {
+		for i := range c.statefulSets {
+			if c.statefulSets[i].Name == s.Name {
+				c.statefulSets[i] = s.DeepCopy()
+			}
+		}
+		return nil
+	}
+	return c.fakeRestartClient.Patch(ctx, obj, patch, opts...)
+}
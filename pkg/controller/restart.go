@@ -0,0 +1,213 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"strconv"
+
+	"go.bytebuilders.dev/aceshifter/pkg/tracker"
+
+	helmapi "github.com/fluxcd/helm-controller/api/v2"
+	apps "k8s.io/api/apps/v1"
+	core "k8s.io/api/core/v1"
+	policy "k8s.io/api/policy/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	// KeyRestartedFor is set on the pod template of the workloads restarted for a
+	// namespace uid range change, to the start of the new range.
+	KeyRestartedFor = "aceshifter.appscode.com/restarted-for-uid"
+	// KeyRestartIgnorePDB on a HelmRelease set to "true" restarts its workloads even if
+	// a PodDisruptionBudget selecting their pods is out of disruptions, for example
+	// the minAvailable: 1 budget of a single replica.
+	KeyRestartIgnorePDB = "aceshifter.appscode.com/restart-ignore-pdb"
+
+	EventReasonWorkloadRestarted = "WorkloadRestarted"
+	EventReasonRestartBlocked    = "WorkloadRestartBlocked"
+)
+
+// restartWorkloads restarts the Deployments, StatefulSets and DaemonSets installed by a
+// HelmRelease after its namespace uid range changed, one workload at a time. A workload
+// is only restarted once the previous one has rolled out and no PodDisruptionBudget
+// selecting its pods is out of disruptions, unless the HelmRelease sets
+// KeyRestartIgnorePDB. It returns true once every workload was restarted for the new
+// range and has rolled out.
+func (r *HelmReleaseReconciler) restartWorkloads(ctx context.Context, hr *helmapi.HelmRelease, uidStart int64) (bool, error) {
+	ns := hr.GetReleaseNamespace()
+	want := strconv.FormatInt(uidStart, 10)
+
+	workloads, err := r.releaseWorkloads(ctx, hr)
+	if err != nil {
+		return false, err
+	}
+
+	var pdbs policy.PodDisruptionBudgetList
+	if err := r.List(ctx, &pdbs, client.InNamespace(ns)); err != nil {
+		return false, err
+	}
+
+	for _, w := range workloads {
+		tpl := podTemplate(w)
+		if tpl.Annotations[KeyRestartedFor] == want {
+			if !rolledOut(w) {
+				return false, nil
+			}
+			continue
+		}
+
+		if hr.Annotations[KeyRestartIgnorePDB] != "true" {
+			pdb, err := disruptionBlocked(pdbs.Items, tpl.Labels)
+			if err != nil {
+				return false, err
+			}
+			if pdb != "" {
+				log.FromContext(ctx).Info("workload restart blocked by PodDisruptionBudget", "kind", workloadKind(w), "name", w.GetName(), "pdb", pdb)
+				r.Recorder.Eventf(hr, core.EventTypeWarning, EventReasonRestartBlocked,
+					"restart of %s/%s is blocked by PodDisruptionBudget %s, set the %s annotation to \"true\" to restart it anyway",
+					ns, w.GetName(), pdb, KeyRestartIgnorePDB)
+				return false, nil
+			}
+		}
+
+		patch := client.MergeFrom(w.DeepCopyObject().(client.Object))
+		metav1.SetMetaDataAnnotation(&tpl.ObjectMeta, KeyRestartedFor, want)
+		if err := r.Patch(ctx, w, patch); err != nil {
+			return false, err
+		}
+		if r.DryRun {
+			// the restart is not persisted, report it without an event on every reconcile
+			reportDryRun(ctx, nil, nil, "helmrelease", workloadKind(w), ns+"/"+w.GetName(), controllerutil.OperationResultUpdated)
+			return false, nil
+		}
+		log.FromContext(ctx).Info("restarted workload for uid range change", "kind", workloadKind(w), "name", w.GetName())
+		r.Recorder.Eventf(hr, core.EventTypeNormal, EventReasonWorkloadRestarted,
+			"restarted %s/%s for the new uid range starting at %d", ns, w.GetName(), uidStart)
+		return false, nil
+	}
+	return true, nil
+}
+
+func (r *HelmReleaseReconciler) releaseWorkloads(ctx context.Context, hr *helmapi.HelmRelease) ([]client.Object, error) {
+	ns := hr.GetReleaseNamespace()
+	owned := func(obj client.Object) bool {
+		a := obj.GetAnnotations()
+		return a[tracker.KeyHelmReleaseName] == hr.GetReleaseName() && a[tracker.KeyHelmReleaseNamespace] == ns
+	}
+
+	var out []client.Object
+	var deployments apps.DeploymentList
+	if err := r.List(ctx, &deployments, client.InNamespace(ns)); err != nil {
+		return nil, err
+	}
+	for i := range deployments.Items {
+		if owned(&deployments.Items[i]) {
+			out = append(out, &deployments.Items[i])
+		}
+	}
+	var statefulSets apps.StatefulSetList
+	if err := r.List(ctx, &statefulSets, client.InNamespace(ns)); err != nil {
+		return nil, err
+	}
+	for i := range statefulSets.Items {
+		if owned(&statefulSets.Items[i]) {
+			out = append(out, &statefulSets.Items[i])
+		}
+	}
+	var daemonSets apps.DaemonSetList
+	if err := r.List(ctx, &daemonSets, client.InNamespace(ns)); err != nil {
+		return nil, err
+	}
+	for i := range daemonSets.Items {
+		if owned(&daemonSets.Items[i]) {
+			out = append(out, &daemonSets.Items[i])
+		}
+	}
+	return out, nil
+}
+
+// workloadKind returns the kind of a typed workload, whose TypeMeta is empty when
+// it was read through the client.
+func workloadKind(obj client.Object) string {
+	switch obj.(type) {
+	case *apps.Deployment:
+		return "Deployment"
+	case *apps.StatefulSet:
+		return "StatefulSet"
+	case *apps.DaemonSet:
+		return "DaemonSet"
+	}
+	return obj.GetObjectKind().GroupVersionKind().Kind
+}
+
+func podTemplate(obj client.Object) *core.PodTemplateSpec {
+	switch w := obj.(type) {
+	case *apps.Deployment:
+		return &w.Spec.Template
+	case *apps.StatefulSet:
+		return &w.Spec.Template
+	case *apps.DaemonSet:
+		return &w.Spec.Template
+	}
+	return nil
+}
+
+func rolledOut(obj client.Object) bool {
+	switch w := obj.(type) {
+	case *apps.Deployment:
+		replicas := int32(1)
+		if w.Spec.Replicas != nil {
+			replicas = *w.Spec.Replicas
+		}
+		return w.Status.ObservedGeneration >= w.Generation &&
+			w.Status.UpdatedReplicas == replicas &&
+			w.Status.AvailableReplicas == replicas
+	case *apps.StatefulSet:
+		replicas := int32(1)
+		if w.Spec.Replicas != nil {
+			replicas = *w.Spec.Replicas
+		}
+		return w.Status.ObservedGeneration >= w.Generation &&
+			w.Status.UpdatedReplicas == replicas &&
+			w.Status.ReadyReplicas == replicas
+	case *apps.DaemonSet:
+		return w.Status.ObservedGeneration >= w.Generation &&
+			w.Status.UpdatedNumberScheduled == w.Status.DesiredNumberScheduled &&
+			w.Status.NumberAvailable == w.Status.DesiredNumberScheduled
+	}
+	return true
+}
+
+// disruptionBlocked returns the name of a PodDisruptionBudget that selects pods with
+// the given labels and allows no disruption, or an empty string if there is none.
+func disruptionBlocked(pdbs []policy.PodDisruptionBudget, podLabels map[string]string) (string, error) {
+	for _, pdb := range pdbs {
+		sel, err := metav1.LabelSelectorAsSelector(pdb.Spec.Selector)
+		if err != nil {
+			return "", err
+		}
+		if !sel.Empty() && sel.Matches(labels.Set(podLabels)) && pdb.Status.DisruptionsAllowed < 1 {
+			return pdb.Name, nil
+		}
+	}
+	return "", nil
+}
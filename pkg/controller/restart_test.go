@@ -0,0 +1,305 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+
+	"go.bytebuilders.dev/aceshifter/pkg/tracker"
+
+	helmapi "github.com/fluxcd/helm-controller/api/v2"
+	apps "k8s.io/api/apps/v1"
+	core "k8s.io/api/core/v1"
+	policy "k8s.io/api/policy/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func TestRolledOut(t *testing.T) {
+	tests := []struct {
+		name string
+		obj  client.Object
+		want bool
+	}{
+		{
+			name: "deployment rolled out",
+			obj: &apps.Deployment{
+				ObjectMeta: metav1.ObjectMeta{Generation: 2},
+				Spec:       apps.DeploymentSpec{Replicas: ptr.To[int32](2)},
+				Status:     apps.DeploymentStatus{ObservedGeneration: 2, UpdatedReplicas: 2, AvailableReplicas: 2},
+			},
+			want: true,
+		},
+		{
+			name: "deployment generation not observed",
+			obj: &apps.Deployment{
+				ObjectMeta: metav1.ObjectMeta{Generation: 3},
+				Spec:       apps.DeploymentSpec{Replicas: ptr.To[int32](2)},
+				Status:     apps.DeploymentStatus{ObservedGeneration: 2, UpdatedReplicas: 2, AvailableReplicas: 2},
+			},
+			want: false,
+		},
+		{
+			name: "deployment with the default replicas not available",
+			obj: &apps.Deployment{
+				ObjectMeta: metav1.ObjectMeta{Generation: 1},
+				Status:     apps.DeploymentStatus{ObservedGeneration: 1, UpdatedReplicas: 1},
+			},
+			want: false,
+		},
+		{
+			name: "statefulset rolled out",
+			obj: &apps.StatefulSet{
+				ObjectMeta: metav1.ObjectMeta{Generation: 1},
+				Spec:       apps.StatefulSetSpec{Replicas: ptr.To[int32](3)},
+				Status:     apps.StatefulSetStatus{ObservedGeneration: 1, UpdatedReplicas: 3, ReadyReplicas: 3},
+			},
+			want: true,
+		},
+		{
+			name: "statefulset updating",
+			obj: &apps.StatefulSet{
+				ObjectMeta: metav1.ObjectMeta{Generation: 1},
+				Spec:       apps.StatefulSetSpec{Replicas: ptr.To[int32](3)},
+				Status:     apps.StatefulSetStatus{ObservedGeneration: 1, UpdatedReplicas: 1, ReadyReplicas: 3},
+			},
+			want: false,
+		},
+		{
+			name: "daemonset rolled out",
+			obj: &apps.DaemonSet{
+				ObjectMeta: metav1.ObjectMeta{Generation: 1},
+				Status:     apps.DaemonSetStatus{ObservedGeneration: 1, DesiredNumberScheduled: 2, UpdatedNumberScheduled: 2, NumberAvailable: 2},
+			},
+			want: true,
+		},
+		{
+			name: "daemonset not available",
+			obj: &apps.DaemonSet{
+				ObjectMeta: metav1.ObjectMeta{Generation: 1},
+				Status:     apps.DaemonSetStatus{ObservedGeneration: 1, DesiredNumberScheduled: 2, UpdatedNumberScheduled: 2, NumberAvailable: 1},
+			},
+			want: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := rolledOut(tt.obj); got != tt.want {
+				t.Errorf("expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestDisruptionBlocked(t *testing.T) {
+	pdb := func(name string, selector *metav1.LabelSelector, allowed int32) policy.PodDisruptionBudget {
+		return policy.PodDisruptionBudget{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Spec:       policy.PodDisruptionBudgetSpec{Selector: selector},
+			Status:     policy.PodDisruptionBudgetStatus{DisruptionsAllowed: allowed},
+		}
+	}
+	app := &metav1.LabelSelector{MatchLabels: map[string]string{"app": "demo"}}
+	other := &metav1.LabelSelector{MatchLabels: map[string]string{"app": "other"}}
+
+	tests := []struct {
+		name string
+		pdbs []policy.PodDisruptionBudget
+		want string
+	}{
+		{name: "no budget"},
+		{name: "disruption allowed", pdbs: []policy.PodDisruptionBudget{pdb("demo", app, 1)}},
+		{name: "out of disruptions", pdbs: []policy.PodDisruptionBudget{pdb("demo", app, 0)}, want: "demo"},
+		{name: "other pods", pdbs: []policy.PodDisruptionBudget{pdb("other", other, 0)}},
+		{name: "empty selector", pdbs: []policy.PodDisruptionBudget{pdb("all", &metav1.LabelSelector{}, 0)}},
+		{name: "second budget", pdbs: []policy.PodDisruptionBudget{pdb("other", other, 0), pdb("demo", app, 0)}, want: "demo"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := disruptionBlocked(tt.pdbs, map[string]string{"app": "demo"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestRestartWorkloads(t *testing.T) {
+	const uidStart = 1000000
+	deployment := func(name, release string, restartedFor string, rolled bool) *apps.Deployment {
+		d := &apps.Deployment{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace:   "demo",
+				Name:        name,
+				Generation:  1,
+				Annotations: map[string]string{tracker.KeyHelmReleaseName: release, tracker.KeyHelmReleaseNamespace: "demo"},
+			},
+			Spec: apps.DeploymentSpec{
+				Replicas: ptr.To[int32](1),
+				Template: core.PodTemplateSpec{
+					ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"app": name}},
+				},
+			},
+			Status: apps.DeploymentStatus{ObservedGeneration: 1, UpdatedReplicas: 1, AvailableReplicas: 1},
+		}
+		if restartedFor != "" {
+			d.Spec.Template.Annotations = map[string]string{KeyRestartedFor: restartedFor}
+		}
+		if !rolled {
+			d.Status.AvailableReplicas = 0
+		}
+		return d
+	}
+	blocking := policy.PodDisruptionBudget{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "demo", Name: "api"},
+		Spec:       policy.PodDisruptionBudgetSpec{Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "api"}}},
+	}
+
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		deployments []*apps.Deployment
+		pdbs        []policy.PodDisruptionBudget
+		done        bool
+		restarted   []string
+		event       string
+	}{
+		{
+			name: "no workloads",
+			done: true,
+		},
+		{
+			name:        "workloads of other releases",
+			deployments: []*apps.Deployment{deployment("api", "other", "", true)},
+			done:        true,
+		},
+		{
+			name:        "restart the first workload",
+			deployments: []*apps.Deployment{deployment("api", "demo", "", true), deployment("ui", "demo", "", true)},
+			restarted:   []string{"api"},
+			event:       core.EventTypeNormal + " " + EventReasonWorkloadRestarted,
+		},
+		{
+			name:        "wait for the restarted workload to roll out",
+			deployments: []*apps.Deployment{deployment("api", "demo", "1000000", false), deployment("ui", "demo", "", true)},
+		},
+		{
+			name:        "restart the next workload once the previous one rolled out",
+			deployments: []*apps.Deployment{deployment("api", "demo", "1000000", true), deployment("ui", "demo", "", true)},
+			restarted:   []string{"ui"},
+			event:       core.EventTypeNormal + " " + EventReasonWorkloadRestarted,
+		},
+		{
+			name:        "restart for an older range",
+			deployments: []*apps.Deployment{deployment("api", "demo", "2000000", true)},
+			restarted:   []string{"api"},
+			event:       core.EventTypeNormal + " " + EventReasonWorkloadRestarted,
+		},
+		{
+			name:        "blocked by a PodDisruptionBudget",
+			deployments: []*apps.Deployment{deployment("api", "demo", "", true)},
+			pdbs:        []policy.PodDisruptionBudget{blocking},
+			event:       core.EventTypeWarning + " " + EventReasonRestartBlocked,
+		},
+		{
+			name:        "PodDisruptionBudget ignored",
+			annotations: map[string]string{KeyRestartIgnorePDB: "true"},
+			deployments: []*apps.Deployment{deployment("api", "demo", "", true)},
+			pdbs:        []policy.PodDisruptionBudget{blocking},
+			restarted:   []string{"api"},
+			event:       core.EventTypeNormal + " " + EventReasonWorkloadRestarted,
+		},
+		{
+			name:        "all workloads restarted",
+			deployments: []*apps.Deployment{deployment("api", "demo", "1000000", true), deployment("ui", "demo", "1000000", true)},
+			done:        true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kc := &fakeRestartClient{deployments: tt.deployments, pdbs: tt.pdbs}
+			recorder := record.NewFakeRecorder(10)
+			r := &HelmReleaseReconciler{Client: kc, Recorder: recorder}
+			hr := &helmapi.HelmRelease{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "demo", Name: "demo", Annotations: tt.annotations},
+			}
+			done, err := r.restartWorkloads(context.TODO(), hr, uidStart)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if done != tt.done {
+				t.Errorf("expected done %v, got %v", tt.done, done)
+			}
+			if !reflect.DeepEqual(kc.patched, tt.restarted) {
+				t.Errorf("expected %v to be restarted, got %v", tt.restarted, kc.patched)
+			}
+			for _, d := range kc.deployments {
+				if slices.Contains(kc.patched, d.Name) && d.Spec.Template.Annotations[KeyRestartedFor] != "1000000" {
+					t.Errorf("expected %s to be restarted for 1000000, got %q", d.Name, d.Spec.Template.Annotations[KeyRestartedFor])
+				}
+			}
+			var event string
+			select {
+			case event = <-recorder.Events:
+			default:
+			}
+			if !strings.HasPrefix(event, tt.event) || (tt.event == "") != (event == "") {
+				t.Errorf("expected event %q, got %q", tt.event, event)
+			}
+		})
+	}
+}
+
+// fakeRestartClient serves the Deployments and PodDisruptionBudgets read by
+// restartWorkloads and records the patched Deployments.
+type fakeRestartClient struct {
+	client.Client
+	deployments []*apps.Deployment
+	pdbs        []policy.PodDisruptionBudget
+	patched     []string
+}
+
+func (c *fakeRestartClient) List(_ context.Context, list client.ObjectList, _ ...client.ListOption) error {
+	switch l := list.(type) {
+	case *apps.DeploymentList:
+		for _, d := range c.deployments {
+			l.Items = append(l.Items, *d.DeepCopy())
+		}
+	case *policy.PodDisruptionBudgetList:
+		l.Items = append(l.Items, c.pdbs...)
+	}
+	return nil
+}
+
+func (c *fakeRestartClient) Patch(_ context.Context, obj client.Object, _ client.Patch, _ ...client.PatchOption) error {
+	for i, d := range c.deployments {
+		if d.Name == obj.GetName() {
+			c.deployments[i] = obj.(*apps.Deployment).DeepCopy()
+			c.patched = append(c.patched, d.Name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,774 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"strings"
+	"time"
+
+	"go.bytebuilders.dev/aceshifter/pkg/featuresets"
+	"go.bytebuilders.dev/aceshifter/pkg/tracker"
+
+	helmapi "github.com/fluxcd/helm-controller/api/v2"
+	core "k8s.io/api/core/v1"
+	networking "k8s.io/api/networking/v1"
+	rbac "k8s.io/api/rbac/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/tools/record"
+	uiapi "kmodules.xyz/resource-metadata/apis/ui/v1alpha1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+const (
+	// KeyRouteTermination selects the TLS termination of the Routes generated for an
+	// Ingress. One of: edge|reencrypt. Defaults to edge.
+	KeyRouteTermination = "aceshifter.appscode.com/route-termination"
+	// KeyRouteDestinationCA names a Secret in the namespace of an Ingress whose ca.crt
+	// is the CA certificate of its reencrypt backends. Backend Services that serve a
+	// service-ca certificate don't need it, the router verifies them with the service
+	// CA bundle.
+	KeyRouteDestinationCA = "aceshifter.appscode.com/route-destination-ca-secret"
+	// KeyRouteSource is set on generated Routes to the <kind>/<namespace>/<name> of
+	// the Ingress or Gateway they expose.
+	KeyRouteSource = "aceshifter.appscode.com/route-source"
+	// LabelRouteSource selects the Routes generated for an Ingress or Gateway. The
+	// value is a hash of their KeyRouteSource annotation.
+	LabelRouteSource = "aceshifter.appscode.com/route-source-hash"
+
+	// IngressControllerRoute is the controller of the IngressClasses whose Ingresses
+	// the OpenShift ingress-to-route controller converts to Routes itself.
+	IngressControllerRoute = "openshift.io/ingress-to-route"
+	// annotationIngressClass is the deprecated annotation form of the class of an
+	// Ingress.
+	annotationIngressClass = "kubernetes.io/ingress.class"
+	// RouterNamespace and RouterServiceAccount identify the OpenShift router. It
+	// needs to read the Secrets that Routes reference as external certificate.
+	RouterNamespace      = "openshift-ingress"
+	RouterServiceAccount = "router"
+
+	LabelOwningGatewayName      = "gateway.envoyproxy.io/owning-gateway-name"
+	LabelOwningGatewayNamespace = "gateway.envoyproxy.io/owning-gateway-namespace"
+
+	TerminationEdge      = "edge"
+	TerminationReencrypt = "reencrypt"
+
+	EventReasonRouteSynced = "RouteSynced"
+	EventReasonRouteFailed = "RouteFailed"
+
+	routePollInterval = 30 * time.Second
+
+	// indexRelease indexes HelmReleases by the <namespace>/<name> of their Helm release.
+	indexRelease = "aceshifter.appscode.com/release"
+)
+
+var (
+	RouteGVK   = schema.GroupVersionKind{Group: "route.openshift.io", Version: "v1", Kind: "Route"}
+	GatewayGVK = schema.GroupVersionKind{Group: "gateway.networking.k8s.io", Version: "v1", Kind: "Gateway"}
+)
+
+// RouteReconciler exposes the Ingresses and Gateways of HelmReleases in the route
+// ingress mode through the OpenShift router, by generating a Route for each of
+// their hosts and keeping it in sync.
+type RouteReconciler struct {
+	client.Client
+	// APIReader reads the TLS Secrets, so that they are not cached cluster-wide.
+	APIReader client.Reader
+	Scheme    *runtime.Scheme
+	Recorder  record.EventRecorder
+	// IngressMode is the default ingress mode of HelmReleases, unless the Ingress,
+	// Gateway, Feature or HelmRelease sets the featuresets.KeyIngressMode annotation.
+	IngressMode featuresets.IngressMode
+	// DryRun reports the Route changes instead of persisting them. Client must send
+	// writes as server-side dry-runs, see NewDryRunClient.
+	DryRun bool
+}
+
+// route is the desired state of a generated Route.
+type route struct {
+	Namespace   string
+	Name        string
+	Host        string
+	Path        string
+	Service     string
+	TargetPort  intstr.IntOrString
+	Termination string
+	// CertificateSecret is the optional TLS Secret in the namespace of the Route that
+	// the router serves, see spec.tls.externalCertificate. The router uses its
+	// default certificate when it is empty. The private key is never copied into
+	// the Route.
+	CertificateSecret string
+	// DestinationCA is the optional PEM CA certificate of a reencrypt backend. The
+	// router uses the service CA bundle when it is empty.
+	DestinationCA string
+}
+
+func (r *RouteReconciler) reconcileIngress(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	source := "Ingress/" + req.Namespace + "/" + req.Name
+
+	var ing networking.Ingress
+	if err := r.Get(ctx, req.NamespacedName, &ing); apierrors.IsNotFound(err) {
+		return ctrl.Result{}, r.syncRoutes(ctx, source, nil, nil)
+	} else if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	enabled, err := r.routeMode(ctx, &ing)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if enabled {
+		// a second Route for the same host is rejected with HostAlreadyClaimed
+		converted, err := r.convertedByRouter(ctx, &ing)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		if converted {
+			log.FromContext(ctx).V(1).Info("skipping ingress converted to routes by the openshift ingress-to-route controller")
+			enabled = false
+		}
+	}
+	var routes []route
+	if enabled && ing.DeletionTimestamp == nil {
+		if routes, err = r.ingressRoutes(ctx, &ing); err != nil {
+			r.Recorder.Eventf(&ing, core.EventTypeWarning, EventReasonRouteFailed, "failed to generate Routes: %v", err)
+			return ctrl.Result{}, err
+		}
+	}
+	return ctrl.Result{}, r.syncRoutes(ctx, source, &ing, routes)
+}
+
+func (r *RouteReconciler) reconcileGateway(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	source := "Gateway/" + req.Namespace + "/" + req.Name
+
+	var gw unstructured.Unstructured
+	gw.SetGroupVersionKind(GatewayGVK)
+	if err := r.Get(ctx, req.NamespacedName, &gw); apierrors.IsNotFound(err) {
+		return ctrl.Result{}, r.syncRoutes(ctx, source, nil, nil)
+	} else if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	enabled, err := r.routeMode(ctx, &gw)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	var routes []route
+	if enabled && gw.GetDeletionTimestamp() == nil {
+		var ready bool
+		routes, ready, err = r.gatewayRoutes(ctx, &gw)
+		if err != nil {
+			r.Recorder.Eventf(&gw, core.EventTypeWarning, EventReasonRouteFailed, "failed to generate Routes: %v", err)
+			return ctrl.Result{}, err
+		}
+		if !ready {
+			log.FromContext(ctx).V(1).Info("waiting for the envoy service of gateway")
+			return ctrl.Result{RequeueAfter: routePollInterval}, nil
+		}
+	}
+	return ctrl.Result{}, r.syncRoutes(ctx, source, &gw, routes)
+}
+
+// routeMode returns true if an Ingress or Gateway is exposed through the OpenShift
+// router. The annotation on the object wins, then the one on the HelmRelease that
+// installed it, then the one on its Feature, then the default ingress mode.
+// Objects not installed by a HelmRelease managed by aceshifter are left alone.
+func (r *RouteReconciler) routeMode(ctx context.Context, obj client.Object) (bool, error) {
+	if v, ok := obj.GetAnnotations()[featuresets.KeyIngressMode]; ok {
+		mode, err := featuresets.ParseIngressMode(v)
+		return mode == featuresets.IngressModeRoute, err
+	}
+
+	name := obj.GetAnnotations()[tracker.KeyHelmReleaseName]
+	ns := obj.GetAnnotations()[tracker.KeyHelmReleaseNamespace]
+	if name == "" {
+		return false, nil
+	}
+	var list helmapi.HelmReleaseList
+	if err := r.List(ctx, &list, client.MatchingFields{indexRelease: ns + "/" + name}); err != nil {
+		return false, err
+	}
+	for i := range list.Items {
+		hr := &list.Items[i]
+		var feature uiapi.Feature
+		filename, err := featuresets.TemplateFile(ctx, r.Client, hr, &feature)
+		if err != nil || filename == "" {
+			return false, err
+		}
+
+		mode := r.IngressMode
+		for _, annotations := range []map[string]string{feature.Annotations, hr.Annotations} {
+			if v, ok := annotations[featuresets.KeyIngressMode]; ok {
+				if mode, err = featuresets.ParseIngressMode(v); err != nil {
+					return false, err
+				}
+			}
+		}
+		return mode == featuresets.IngressModeRoute, nil
+	}
+	return false, nil
+}
+
+// convertedByRouter returns true if the OpenShift ingress-to-route controller
+// generates the Routes of an Ingress itself, that is if the Ingress has no class or
+// its IngressClass belongs to that controller. Charts in the route ingress mode use
+// featuresets.IngressClassRoute, which no IngressClass claims.
+func (r *RouteReconciler) convertedByRouter(ctx context.Context, ing *networking.Ingress) (bool, error) {
+	className := ing.Annotations[annotationIngressClass]
+	if ing.Spec.IngressClassName != nil {
+		className = *ing.Spec.IngressClassName
+	}
+	if className == "" {
+		return true, nil
+	}
+	var class networking.IngressClass
+	if err := r.Get(ctx, client.ObjectKey{Name: className}, &class); apierrors.IsNotFound(err) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	return class.Spec.Controller == IngressControllerRoute, nil
+}
+
+func (r *RouteReconciler) ingressRoutes(ctx context.Context, ing *networking.Ingress) ([]route, error) {
+	termination := ing.Annotations[KeyRouteTermination]
+	switch termination {
+	case "":
+		termination = TerminationEdge
+	case TerminationEdge, TerminationReencrypt:
+	default:
+		return nil, fmt.Errorf("unknown %s %q, must be one of edge|reencrypt", KeyRouteTermination, termination)
+	}
+
+	tlsSecrets := map[string]string{}
+	for _, t := range ing.Spec.TLS {
+		for _, host := range t.Hosts {
+			tlsSecrets[host] = t.SecretName
+		}
+	}
+
+	var routes []route
+	for _, rule := range ing.Spec.Rules {
+		if rule.HTTP == nil {
+			continue
+		}
+		for _, p := range rule.HTTP.Paths {
+			if p.Backend.Service == nil {
+				continue
+			}
+			svc, err := r.backendService(ctx, ing.Namespace, p.Backend.Service.Name)
+			if err != nil {
+				return nil, err
+			}
+			path := p.Path
+			if path == "/" {
+				path = ""
+			}
+			rt := route{
+				Namespace:  ing.Namespace,
+				Name:       ing.Name + "-" + shortHash(rule.Host+path),
+				Host:       rule.Host,
+				Path:       path,
+				Service:    p.Backend.Service.Name,
+				TargetPort: targetPort(svc, p.Backend.Service.Port),
+			}
+			if secretName, ok := tlsSecrets[rule.Host]; ok {
+				rt.Termination = termination
+				if secretName != "" {
+					// the ca.crt of the certificate served to clients is not the CA of the backend
+					_, found, err := r.tlsSecret(ctx, ing.Namespace, secretName)
+					if err != nil {
+						return nil, err
+					}
+					if found {
+						rt.CertificateSecret = secretName
+					}
+				}
+				if termination == TerminationReencrypt {
+					if rt.DestinationCA, err = r.destinationCA(ctx, ing, svc); err != nil {
+						return nil, err
+					}
+				}
+			}
+			routes = append(routes, rt)
+		}
+	}
+	return routes, nil
+}
+
+// gatewayRoutes returns a Route for each hostname of the HTTP and HTTPS listeners of
+// a Gateway, pointing at the envoy Service of the Gateway. HTTPS listeners are
+// exposed with reencrypt termination, HTTP listeners with edge termination. A
+// hostname served by both is exposed through the HTTPS listener. The router serves
+// the listener certificate only if the envoy Service runs in the namespace of the
+// certificate, as voyager-gateway does in the route ingress mode.
+func (r *RouteReconciler) gatewayRoutes(ctx context.Context, gw *unstructured.Unstructured) ([]route, bool, error) {
+	var services core.ServiceList
+	if err := r.List(ctx, &services, client.MatchingLabels{
+		LabelOwningGatewayName:      gw.GetName(),
+		LabelOwningGatewayNamespace: gw.GetNamespace(),
+	}); err != nil {
+		return nil, false, err
+	}
+	if len(services.Items) == 0 {
+		return nil, false, nil
+	}
+	svc := &services.Items[0]
+
+	listeners, _, err := unstructured.NestedSlice(gw.Object, "spec", "listeners")
+	if err != nil {
+		return nil, false, err
+	}
+	byHost := map[string]route{}
+	var hosts []string
+	for _, l := range listeners {
+		listener, ok := l.(map[string]any)
+		if !ok {
+			continue
+		}
+		name, _, _ := unstructured.NestedString(listener, "name")
+		host, _, _ := unstructured.NestedString(listener, "hostname")
+		protocol, _, _ := unstructured.NestedString(listener, "protocol")
+		port, _, _ := unstructured.NestedInt64(listener, "port")
+		if protocol != "HTTP" && protocol != "HTTPS" {
+			continue
+		}
+		if strings.HasPrefix(host, "*") {
+			log.FromContext(ctx).V(1).Info("skipping wildcard listener", "listener", name, "hostname", host)
+			continue
+		}
+		if prev, ok := byHost[host]; ok && prev.Termination == TerminationReencrypt {
+			continue
+		}
+
+		rt := route{
+			Namespace:   svc.Namespace,
+			Name:        fmt.Sprintf("%s-%s-%s", gw.GetNamespace(), gw.GetName(), name),
+			Host:        host,
+			Service:     svc.Name,
+			TargetPort:  servicePort(svc, int32(port)),
+			Termination: TerminationEdge,
+		}
+		if protocol == "HTTPS" {
+			rt.Termination = TerminationReencrypt
+			refs, _, _ := unstructured.NestedSlice(listener, "tls", "certificateRefs")
+			if len(refs) > 0 {
+				ref, _ := refs[0].(map[string]any)
+				refName, _, _ := unstructured.NestedString(ref, "name")
+				refNS, _, _ := unstructured.NestedString(ref, "namespace")
+				if refNS == "" {
+					refNS = gw.GetNamespace()
+				}
+				var found bool
+				if rt.DestinationCA, found, err = r.tlsSecret(ctx, refNS, refName); err != nil {
+					return nil, false, err
+				}
+				if found && refNS == rt.Namespace {
+					rt.CertificateSecret = refName
+				}
+			}
+		}
+		if _, ok := byHost[host]; !ok {
+			hosts = append(hosts, host)
+		}
+		byHost[host] = rt
+	}
+
+	routes := make([]route, 0, len(hosts))
+	for _, host := range hosts {
+		routes = append(routes, byHost[host])
+	}
+	return routes, true, nil
+}
+
+// backendService returns the backend Service of an Ingress, or nil if it does not
+// exist yet.
+func (r *RouteReconciler) backendService(ctx context.Context, ns, name string) (*core.Service, error) {
+	var svc core.Service
+	if err := r.Get(ctx, client.ObjectKey{Namespace: ns, Name: name}, &svc); apierrors.IsNotFound(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return &svc, nil
+}
+
+// targetPort returns the Route target port of an Ingress backend. Routes match the
+// name of the Service port, or the target port of unnamed Service ports.
+func targetPort(svc *core.Service, port networking.ServiceBackendPort) intstr.IntOrString {
+	if port.Name != "" {
+		return intstr.FromString(port.Name)
+	}
+	if svc == nil {
+		return intstr.FromInt32(port.Number)
+	}
+	return servicePort(svc, port.Number)
+}
+
+func servicePort(svc *core.Service, port int32) intstr.IntOrString {
+	for _, p := range svc.Spec.Ports {
+		if p.Port != port {
+			continue
+		}
+		if p.Name != "" {
+			return intstr.FromString(p.Name)
+		}
+		if p.TargetPort.IntValue() != 0 || p.TargetPort.Type == intstr.String {
+			return p.TargetPort
+		}
+		break
+	}
+	return intstr.FromInt32(port)
+}
+
+// destinationCA returns the CA certificate a reencrypt Route of an Ingress verifies
+// its backend Service with, read from the Secret named by KeyRouteDestinationCA. It
+// returns an empty CA, so that the router uses the service CA bundle, if the Ingress
+// does not name one.
+func (r *RouteReconciler) destinationCA(ctx context.Context, ing *networking.Ingress, svc *core.Service) (string, error) {
+	name := ing.Annotations[KeyRouteDestinationCA]
+	if name == "" {
+		if svc != nil && svc.Annotations[featuresets.KeyServingCertSecretName] == "" {
+			log.FromContext(ctx).Info("reencrypt backend does not serve a service-ca certificate, the router may not verify it",
+				"service", svc.Name, "annotation", KeyRouteDestinationCA)
+		}
+		return "", nil
+	}
+	ca, found, err := r.tlsSecret(ctx, ing.Namespace, name)
+	if err != nil {
+		return "", err
+	}
+	if !found || ca == "" {
+		return "", fmt.Errorf("secret %s/%s named by %s has no ca.crt", ing.Namespace, name, KeyRouteDestinationCA)
+	}
+	return ca, nil
+}
+
+// tlsSecret returns the CA certificate of a TLS Secret and whether the Secret exists.
+// A missing Secret is not an error, the router then uses its default certificate.
+func (r *RouteReconciler) tlsSecret(ctx context.Context, ns, name string) (string, bool, error) {
+	var secret core.Secret
+	if err := r.APIReader.Get(ctx, client.ObjectKey{Namespace: ns, Name: name}, &secret); err != nil {
+		return "", false, client.IgnoreNotFound(err)
+	}
+	return string(secret.Data["ca.crt"]), true, nil
+}
+
+// syncRoutes creates or updates the desired Routes of an Ingress or Gateway and
+// deletes the Routes generated for it earlier that are no longer desired. Routes
+// in the namespace of their source are owned by it.
+func (r *RouteReconciler) syncRoutes(ctx context.Context, source string, owner client.Object, routes []route) error {
+	log := log.FromContext(ctx)
+	hash := shortHash(source)
+
+	keep := map[types.NamespacedName]bool{}
+	for _, rt := range routes {
+		keep[types.NamespacedName{Namespace: rt.Namespace, Name: rt.Name}] = true
+
+		var u unstructured.Unstructured
+		u.SetGroupVersionKind(RouteGVK)
+		u.SetNamespace(rt.Namespace)
+		u.SetName(rt.Name)
+		result, err := controllerutil.CreateOrPatch(ctx, r.Client, &u, func() error {
+			labels := u.GetLabels()
+			if labels == nil {
+				labels = map[string]string{}
+			}
+			labels[tracker.LabelManagedBy] = tracker.ManagedBy
+			labels[LabelRouteSource] = hash
+			u.SetLabels(labels)
+			annotations := u.GetAnnotations()
+			if annotations == nil {
+				annotations = map[string]string{}
+			}
+			annotations[KeyRouteSource] = source
+			u.SetAnnotations(annotations)
+			if owner != nil && owner.GetNamespace() == rt.Namespace {
+				if err := controllerutil.SetControllerReference(owner, &u, r.Scheme); err != nil {
+					return err
+				}
+			}
+			return setRouteSpec(&u, rt)
+		})
+		if err != nil {
+			return err
+		}
+		if err := r.grantRouterAccess(ctx, &u, rt); err != nil {
+			return err
+		}
+		if r.DryRun {
+			reportDryRun(ctx, r.Recorder, owner, "route", "Route", rt.Namespace+"/"+rt.Name, result)
+		} else if result != controllerutil.OperationResultNone {
+			log.Info(fmt.Sprintf("%s route %s/%s", result, rt.Namespace, rt.Name))
+			if owner != nil {
+				r.Recorder.Eventf(owner, core.EventTypeNormal, EventReasonRouteSynced, "%s Route %s/%s for host %q", result, rt.Namespace, rt.Name, rt.Host)
+			}
+		}
+	}
+
+	var list unstructured.UnstructuredList
+	list.SetGroupVersionKind(RouteGVK.GroupVersion().WithKind("RouteList"))
+	if err := r.List(ctx, &list, client.MatchingLabels{LabelRouteSource: hash}); err != nil {
+		return err
+	}
+	for i := range list.Items {
+		u := &list.Items[i]
+		if keep[client.ObjectKeyFromObject(u)] || u.GetAnnotations()[KeyRouteSource] != source {
+			continue
+		}
+		if err := r.Delete(ctx, u); client.IgnoreNotFound(err) != nil {
+			return err
+		}
+		if r.DryRun {
+			reportDryRun(ctx, r.Recorder, owner, "route", "Route", u.GetNamespace()+"/"+u.GetName(), "deleted")
+		} else {
+			log.Info(fmt.Sprintf("deleted route %s/%s", u.GetNamespace(), u.GetName()))
+		}
+	}
+	return nil
+}
+
+// grantRouterAccess lets the OpenShift router read the certificate Secret of a
+// Route, through a Role and RoleBinding named after the Route. They are owned by the
+// Route, so they are garbage collected with it.
+func (r *RouteReconciler) grantRouterAccess(ctx context.Context, owner *unstructured.Unstructured, rt route) error {
+	if rt.CertificateSecret == "" {
+		return nil
+	}
+
+	role := rbac.Role{ObjectMeta: metav1.ObjectMeta{Namespace: rt.Namespace, Name: rt.Name}}
+	result, err := controllerutil.CreateOrPatch(ctx, r.Client, &role, func() error {
+		metav1.SetMetaDataLabel(&role.ObjectMeta, tracker.LabelManagedBy, tracker.ManagedBy)
+		role.Rules = []rbac.PolicyRule{{
+			APIGroups:     []string{""},
+			Resources:     []string{"secrets"},
+			ResourceNames: []string{rt.CertificateSecret},
+			Verbs:         []string{"get", "list", "watch"},
+		}}
+		return controllerutil.SetOwnerReference(owner, &role, r.Scheme)
+	})
+	if err != nil {
+		return err
+	}
+	if r.DryRun {
+		reportDryRun(ctx, nil, nil, "route", "Role", rt.Namespace+"/"+rt.Name, result)
+	}
+
+	binding := rbac.RoleBinding{ObjectMeta: metav1.ObjectMeta{Namespace: rt.Namespace, Name: rt.Name}}
+	result, err = controllerutil.CreateOrPatch(ctx, r.Client, &binding, func() error {
+		metav1.SetMetaDataLabel(&binding.ObjectMeta, tracker.LabelManagedBy, tracker.ManagedBy)
+		binding.RoleRef = rbac.RoleRef{APIGroup: rbac.GroupName, Kind: "Role", Name: rt.Name}
+		binding.Subjects = []rbac.Subject{{
+			Kind:      rbac.ServiceAccountKind,
+			Namespace: RouterNamespace,
+			Name:      RouterServiceAccount,
+		}}
+		return controllerutil.SetOwnerReference(owner, &binding, r.Scheme)
+	})
+	if err != nil {
+		return err
+	}
+	if r.DryRun {
+		reportDryRun(ctx, nil, nil, "route", "RoleBinding", rt.Namespace+"/"+rt.Name, result)
+	}
+	return nil
+}
+
+func setRouteSpec(u *unstructured.Unstructured, rt route) error {
+	host, _, _ := unstructured.NestedString(u.Object, "spec", "host")
+	if rt.Host != "" {
+		host = rt.Host
+	}
+
+	spec := map[string]any{
+		"to": map[string]any{
+			"kind":   "Service",
+			"name":   rt.Service,
+			"weight": int64(100),
+		},
+		"port": map[string]any{
+			"targetPort": rt.TargetPort.String(),
+		},
+		"wildcardPolicy": "None",
+	}
+	if rt.TargetPort.Type == intstr.Int {
+		spec["port"] = map[string]any{"targetPort": int64(rt.TargetPort.IntVal)}
+	}
+	if host != "" {
+		spec["host"] = host
+	}
+	if rt.Path != "" {
+		spec["path"] = rt.Path
+	}
+	if rt.Termination != "" {
+		tls := map[string]any{
+			"termination":                   rt.Termination,
+			"insecureEdgeTerminationPolicy": "Redirect",
+		}
+		if rt.CertificateSecret != "" {
+			tls["externalCertificate"] = map[string]any{"name": rt.CertificateSecret}
+		}
+		if rt.Termination == TerminationReencrypt && rt.DestinationCA != "" {
+			tls["destinationCACertificate"] = rt.DestinationCA
+		}
+		spec["tls"] = tls
+	}
+	return unstructured.SetNestedField(u.Object, spec, "spec")
+}
+
+func shortHash(s string) string {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(s))
+	return fmt.Sprintf("%08x", h.Sum32())
+}
+
+// mapSecretToIngresses enqueues the Ingresses that use a TLS or destination CA
+// Secret. Only the metadata of Secrets is watched.
+func (r *RouteReconciler) mapSecretToIngresses(ctx context.Context, obj client.Object) []reconcile.Request {
+	var list networking.IngressList
+	if err := r.List(ctx, &list, client.InNamespace(obj.GetNamespace())); err != nil {
+		log.FromContext(ctx).Error(err, "failed to list ingresses", "namespace", obj.GetNamespace())
+		return nil
+	}
+	var reqs []reconcile.Request
+	for _, ing := range list.Items {
+		if ing.Annotations[KeyRouteDestinationCA] == obj.GetName() {
+			reqs = append(reqs, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&ing)})
+			continue
+		}
+		for _, t := range ing.Spec.TLS {
+			if t.SecretName == obj.GetName() {
+				reqs = append(reqs, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&ing)})
+				break
+			}
+		}
+	}
+	return reqs
+}
+
+// mapSecretToGateways enqueues the Gateways whose listeners use a TLS Secret. Only
+// the metadata of Secrets is watched.
+func (r *RouteReconciler) mapSecretToGateways(ctx context.Context, obj client.Object) []reconcile.Request {
+	var list unstructured.UnstructuredList
+	list.SetGroupVersionKind(GatewayGVK.GroupVersion().WithKind("GatewayList"))
+	if err := r.List(ctx, &list); err != nil {
+		log.FromContext(ctx).Error(err, "failed to list gateways")
+		return nil
+	}
+	var reqs []reconcile.Request
+	for i := range list.Items {
+		if gatewayUsesSecret(&list.Items[i], obj.GetNamespace(), obj.GetName()) {
+			reqs = append(reqs, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&list.Items[i])})
+		}
+	}
+	return reqs
+}
+
+func gatewayUsesSecret(gw *unstructured.Unstructured, ns, name string) bool {
+	listeners, _, _ := unstructured.NestedSlice(gw.Object, "spec", "listeners")
+	for _, l := range listeners {
+		listener, ok := l.(map[string]any)
+		if !ok {
+			continue
+		}
+		refs, _, _ := unstructured.NestedSlice(listener, "tls", "certificateRefs")
+		for _, rf := range refs {
+			ref, ok := rf.(map[string]any)
+			if !ok {
+				continue
+			}
+			refName, _, _ := unstructured.NestedString(ref, "name")
+			refNS, _, _ := unstructured.NestedString(ref, "namespace")
+			if refNS == "" {
+				refNS = gw.GetNamespace()
+			}
+			if refName == name && refNS == ns {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// SetupWithManager sets up the controllers with the Manager. The Gateway controller
+// is only set up if the Gateway API is installed.
+func (r *RouteReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	// routeMode looks up the HelmRelease of an Ingress or Gateway by its Helm release
+	if err := mgr.GetFieldIndexer().IndexField(context.Background(), &helmapi.HelmRelease{}, indexRelease, func(obj client.Object) []string {
+		hr := obj.(*helmapi.HelmRelease)
+		return []string{hr.GetReleaseNamespace() + "/" + hr.GetReleaseName()}
+	}); err != nil {
+		return err
+	}
+
+	routeObj := &unstructured.Unstructured{}
+	routeObj.SetGroupVersionKind(RouteGVK)
+
+	if err := ctrl.NewControllerManagedBy(mgr).
+		Named("ingress-route").
+		For(&networking.Ingress{}).
+		Owns(routeObj).
+		WatchesMetadata(&core.Secret{}, handler.EnqueueRequestsFromMapFunc(r.mapSecretToIngresses)).
+		Complete(reconcile.Func(r.reconcileIngress)); err != nil {
+		return err
+	}
+
+	if _, err := mgr.GetRESTMapper().RESTMapping(GatewayGVK.GroupKind(), GatewayGVK.Version); err != nil {
+		log.Log.Info("Gateway API not found, Routes are not generated for Gateways")
+		return nil
+	}
+
+	gw := &unstructured.Unstructured{}
+	gw.SetGroupVersionKind(GatewayGVK)
+	mapToGateway := func(ctx context.Context, obj client.Object) []reconcile.Request {
+		var key types.NamespacedName
+		if source, ok := obj.GetAnnotations()[KeyRouteSource]; ok {
+			kind, rest, _ := strings.Cut(source, "/")
+			if kind != GatewayGVK.Kind {
+				return nil
+			}
+			key.Namespace, key.Name, _ = strings.Cut(rest, "/")
+		} else {
+			key.Name = obj.GetLabels()[LabelOwningGatewayName]
+			key.Namespace = obj.GetLabels()[LabelOwningGatewayNamespace]
+		}
+		if key.Name == "" {
+			return nil
+		}
+		return []reconcile.Request{{NamespacedName: key}}
+	}
+	return ctrl.NewControllerManagedBy(mgr).
+		Named("gateway-route").
+		For(gw).
+		Watches(routeObj, handler.EnqueueRequestsFromMapFunc(mapToGateway)).
+		Watches(&core.Service{}, handler.EnqueueRequestsFromMapFunc(mapToGateway)).
+		WatchesMetadata(&core.Secret{}, handler.EnqueueRequestsFromMapFunc(r.mapSecretToGateways)).
+		Complete(reconcile.Func(r.reconcileGateway))
+}
@@ -0,0 +1,411 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"go.bytebuilders.dev/aceshifter/pkg/featuresets"
+	"go.bytebuilders.dev/aceshifter/pkg/tracker"
+
+	helmapi "github.com/fluxcd/helm-controller/api/v2"
+	core "k8s.io/api/core/v1"
+	networking "k8s.io/api/networking/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func TestServicePort(t *testing.T) {
+	svc := &core.Service{Spec: core.ServiceSpec{Ports: []core.ServicePort{
+		{Name: "http", Port: 80, TargetPort: intstr.FromInt32(8080)},
+		{Port: 443, TargetPort: intstr.FromInt32(8443)},
+		{Port: 9090, TargetPort: intstr.FromString("metrics")},
+		{Port: 9443},
+	}}}
+	tests := []struct {
+		port int32
+		want intstr.IntOrString
+	}{
+		{port: 80, want: intstr.FromString("http")},
+		{port: 443, want: intstr.FromInt32(8443)},
+		{port: 9090, want: intstr.FromString("metrics")},
+		{port: 9443, want: intstr.FromInt32(9443)},
+		{port: 8000, want: intstr.FromInt32(8000)},
+	}
+	for _, tt := range tests {
+		if got := servicePort(svc, tt.port); got != tt.want {
+			t.Errorf("port %d: expected %v, got %v", tt.port, tt.want.String(), got.String())
+		}
+	}
+}
+
+func TestSetRouteSpec(t *testing.T) {
+	tests := []struct {
+		name string
+		host string
+		rt   route
+		want map[string]any
+	}{
+		{
+			name: "plain http",
+			rt:   route{Host: "demo.example.com", Service: "demo", TargetPort: intstr.FromString("http")},
+			want: map[string]any{
+				"host":           "demo.example.com",
+				"to":             map[string]any{"kind": "Service", "name": "demo", "weight": int64(100)},
+				"port":           map[string]any{"targetPort": "http"},
+				"wildcardPolicy": "None",
+			},
+		},
+		{
+			name: "edge with certificate and path",
+			rt: route{
+				Host: "demo.example.com", Path: "/api", Service: "demo", TargetPort: intstr.FromInt32(8080),
+				Termination: TerminationEdge, CertificateSecret: "demo-tls", DestinationCA: "ignored",
+			},
+			want: map[string]any{
+				"host":           "demo.example.com",
+				"path":           "/api",
+				"to":             map[string]any{"kind": "Service", "name": "demo", "weight": int64(100)},
+				"port":           map[string]any{"targetPort": int64(8080)},
+				"wildcardPolicy": "None",
+				"tls": map[string]any{
+					"termination":                   TerminationEdge,
+					"insecureEdgeTerminationPolicy": "Redirect",
+					"externalCertificate":           map[string]any{"name": "demo-tls"},
+				},
+			},
+		},
+		{
+			name: "reencrypt keeps the generated host",
+			host: "demo-kubeops.apps.example.com",
+			rt: route{
+				Service: "demo", TargetPort: intstr.FromString("https"),
+				Termination: TerminationReencrypt, DestinationCA: "CA",
+			},
+			want: map[string]any{
+				"host":           "demo-kubeops.apps.example.com",
+				"to":             map[string]any{"kind": "Service", "name": "demo", "weight": int64(100)},
+				"port":           map[string]any{"targetPort": "https"},
+				"wildcardPolicy": "None",
+				"tls": map[string]any{
+					"termination":                   TerminationReencrypt,
+					"insecureEdgeTerminationPolicy": "Redirect",
+					"destinationCACertificate":      "CA",
+				},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u := &unstructured.Unstructured{Object: map[string]any{}}
+			if tt.host != "" {
+				u.Object["spec"] = map[string]any{"host": tt.host}
+			}
+			if err := setRouteSpec(u, tt.rt); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(u.Object["spec"], tt.want) {
+				t.Errorf("expected %v, got %v", tt.want, u.Object["spec"])
+			}
+		})
+	}
+}
+
+func TestIngressRoutes(t *testing.T) {
+	backend := func(port networking.ServiceBackendPort) networking.IngressBackend {
+		return networking.IngressBackend{Service: &networking.IngressServiceBackend{Name: "demo", Port: port}}
+	}
+	ingress := func(annotations map[string]string, tls bool) *networking.Ingress {
+		ing := &networking.Ingress{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "kubeops", Name: "demo", Annotations: annotations},
+			Spec: networking.IngressSpec{Rules: []networking.IngressRule{{
+				Host: "demo.example.com",
+				IngressRuleValue: networking.IngressRuleValue{HTTP: &networking.HTTPIngressRuleValue{
+					Paths: []networking.HTTPIngressPath{{Path: "/", Backend: backend(networking.ServiceBackendPort{Number: 443})}},
+				}},
+			}}},
+		}
+		if tls {
+			ing.Spec.TLS = []networking.IngressTLS{{Hosts: []string{"demo.example.com"}, SecretName: "demo-tls"}}
+		}
+		return ing
+	}
+	service := func(annotations map[string]string) *core.Service {
+		return &core.Service{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "kubeops", Name: "demo", Annotations: annotations},
+			Spec:       core.ServiceSpec{Ports: []core.ServicePort{{Name: "https", Port: 443}}},
+		}
+	}
+	secrets := map[string]*core.Secret{
+		"demo-tls":     {Data: map[string][]byte{"tls.crt": []byte("CERT"), "ca.crt": []byte("FRONTEND CA")}},
+		"demo-backend": {Data: map[string][]byte{"ca.crt": []byte("BACKEND CA")}},
+	}
+	name := "demo-" + shortHash("demo.example.com")
+
+	tests := []struct {
+		name    string
+		ing     *networking.Ingress
+		svc     *core.Service
+		want    []route
+		wantErr bool
+	}{
+		{
+			name: "plain http without service",
+			ing:  ingress(nil, false),
+			want: []route{{Namespace: "kubeops", Name: name, Host: "demo.example.com", Service: "demo", TargetPort: intstr.FromInt32(443)}},
+		},
+		{
+			name: "edge",
+			ing:  ingress(nil, true),
+			svc:  service(nil),
+			want: []route{{
+				Namespace: "kubeops", Name: name, Host: "demo.example.com", Service: "demo", TargetPort: intstr.FromString("https"),
+				Termination: TerminationEdge, CertificateSecret: "demo-tls",
+			}},
+		},
+		{
+			name: "reencrypt to a service-ca backend",
+			ing:  ingress(map[string]string{KeyRouteTermination: TerminationReencrypt}, true),
+			svc:  service(map[string]string{featuresets.KeyServingCertSecretName: "demo-cert"}),
+			want: []route{{
+				Namespace: "kubeops", Name: name, Host: "demo.example.com", Service: "demo", TargetPort: intstr.FromString("https"),
+				Termination: TerminationReencrypt, CertificateSecret: "demo-tls",
+			}},
+		},
+		{
+			name: "reencrypt with a destination CA",
+			ing: ingress(map[string]string{
+				KeyRouteTermination:   TerminationReencrypt,
+				KeyRouteDestinationCA: "demo-backend",
+			}, true),
+			svc: service(nil),
+			want: []route{{
+				Namespace: "kubeops", Name: name, Host: "demo.example.com", Service: "demo", TargetPort: intstr.FromString("https"),
+				Termination: TerminationReencrypt, CertificateSecret: "demo-tls", DestinationCA: "BACKEND CA",
+			}},
+		},
+		{
+			name: "missing destination CA",
+			ing: ingress(map[string]string{
+				KeyRouteTermination:   TerminationReencrypt,
+				KeyRouteDestinationCA: "missing",
+			}, true),
+			svc:     service(nil),
+			wantErr: true,
+		},
+		{
+			name:    "unknown termination",
+			ing:     ingress(map[string]string{KeyRouteTermination: "passthrough"}, true),
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kc := &fakeRouteClient{}
+			if tt.svc != nil {
+				kc.services = []core.Service{*tt.svc}
+			}
+			r := &RouteReconciler{Client: kc, APIReader: fakeSecretReader(secrets)}
+			got, err := r.ingressRoutes(context.TODO(), tt.ing)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("expected error %v, got %v", tt.wantErr, err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("expected %+v, got %+v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestGatewayRoutes(t *testing.T) {
+	gateway := &unstructured.Unstructured{Object: map[string]any{
+		"metadata": map[string]any{"namespace": "ace", "name": "ace"},
+		"spec": map[string]any{"listeners": []any{
+			map[string]any{"name": "http", "hostname": "ace.example.com", "protocol": "HTTP", "port": int64(80)},
+			map[string]any{
+				"name": "https", "hostname": "ace.example.com", "protocol": "HTTPS", "port": int64(443),
+				"tls": map[string]any{"certificateRefs": []any{map[string]any{"name": "ace-cert"}}},
+			},
+			map[string]any{"name": "api", "hostname": "api.example.com", "protocol": "HTTP", "port": int64(80)},
+			map[string]any{"name": "wildcard", "hostname": "*.example.com", "protocol": "HTTP", "port": int64(80)},
+			map[string]any{"name": "tcp", "hostname": "db.example.com", "protocol": "TCP", "port": int64(5432)},
+		}},
+	}}
+	envoy := core.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "ace",
+			Name:      "envoy-ace",
+			Labels:    map[string]string{LabelOwningGatewayName: "ace", LabelOwningGatewayNamespace: "ace"},
+		},
+		Spec: core.ServiceSpec{Ports: []core.ServicePort{
+			{Name: "http-80", Port: 80},
+			{Name: "https-443", Port: 443},
+		}},
+	}
+	secrets := map[string]*core.Secret{
+		"ace-cert": {Data: map[string][]byte{"tls.crt": []byte("CERT"), "ca.crt": []byte("CA")}},
+	}
+
+	r := &RouteReconciler{Client: &fakeRouteClient{}, APIReader: fakeSecretReader(secrets)}
+	if _, ready, err := r.gatewayRoutes(context.TODO(), gateway); err != nil || ready {
+		t.Fatalf("expected a gateway without envoy service not to be ready, got %v, %v", ready, err)
+	}
+
+	r.Client = &fakeRouteClient{services: []core.Service{envoy}}
+	got, ready, err := r.gatewayRoutes(context.TODO(), gateway)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ready {
+		t.Fatal("expected the gateway to be ready")
+	}
+	want := []route{
+		{
+			Namespace: "ace", Name: "ace-ace-https", Host: "ace.example.com", Service: "envoy-ace", TargetPort: intstr.FromString("https-443"),
+			Termination: TerminationReencrypt, CertificateSecret: "ace-cert", DestinationCA: "CA",
+		},
+		{
+			Namespace: "ace", Name: "ace-ace-api", Host: "api.example.com", Service: "envoy-ace", TargetPort: intstr.FromString("http-80"),
+			Termination: TerminationEdge,
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %+v, got %+v", want, got)
+	}
+}
+
+func TestRouteMode(t *testing.T) {
+	release := func(name, ns string, annotations map[string]string) helmapi.HelmRelease {
+		return helmapi.HelmRelease{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "kubeops", Name: name, Annotations: annotations},
+			Spec: helmapi.HelmReleaseSpec{
+				ReleaseName:     name,
+				TargetNamespace: ns,
+				Chart:           &helmapi.HelmChartTemplate{Spec: helmapi.HelmChartTemplateSpec{Chart: "ace"}},
+			},
+		}
+	}
+	kc := &fakeRouteClient{releases: []helmapi.HelmRelease{
+		release("ace", "ace", map[string]string{featuresets.KeyIngressMode: string(featuresets.IngressModeRoute)}),
+		release("ace-installer", "kubeops", nil),
+	}}
+	r := &RouteReconciler{Client: kc, IngressMode: featuresets.IngressModeIngress}
+
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		want        bool
+	}{
+		{name: "not installed by a release"},
+		{
+			name:        "annotation on the object",
+			annotations: map[string]string{featuresets.KeyIngressMode: string(featuresets.IngressModeRoute)},
+			want:        true,
+		},
+		{
+			name:        "annotation on the release",
+			annotations: map[string]string{tracker.KeyHelmReleaseName: "ace", tracker.KeyHelmReleaseNamespace: "ace"},
+			want:        true,
+		},
+		{
+			name:        "default ingress mode",
+			annotations: map[string]string{tracker.KeyHelmReleaseName: "ace-installer", tracker.KeyHelmReleaseNamespace: "kubeops"},
+		},
+		{
+			name:        "release of another namespace",
+			annotations: map[string]string{tracker.KeyHelmReleaseName: "ace", tracker.KeyHelmReleaseNamespace: "kubeops"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ing := &networking.Ingress{ObjectMeta: metav1.ObjectMeta{Namespace: "ace", Name: "ace", Annotations: tt.annotations}}
+			got, err := r.routeMode(context.TODO(), ing)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+// fakeRouteClient serves the Services and the HelmReleases, looked up through the
+// release index, read by the RouteReconciler. Features are not found.
+type fakeRouteClient struct {
+	client.Client
+	services []core.Service
+	releases []helmapi.HelmRelease
+}
+
+func (c *fakeRouteClient) Get(_ context.Context, key client.ObjectKey, obj client.Object, _ ...client.GetOption) error {
+	if svc, ok := obj.(*core.Service); ok {
+		for i := range c.services {
+			if c.services[i].Namespace == key.Namespace && c.services[i].Name == key.Name {
+				c.services[i].DeepCopyInto(svc)
+				return nil
+			}
+		}
+	}
+	return apierrors.NewNotFound(schema.GroupResource{}, key.Name)
+}
+
+func (c *fakeRouteClient) List(_ context.Context, list client.ObjectList, opts ...client.ListOption) error {
+	var o client.ListOptions
+	o.ApplyOptions(opts)
+	switch l := list.(type) {
+	case *core.ServiceList:
+		for _, svc := range c.services {
+			if o.LabelSelector == nil || o.LabelSelector.Matches(labels.Set(svc.Labels)) {
+				l.Items = append(l.Items, svc)
+			}
+		}
+	case *helmapi.HelmReleaseList:
+		for _, hr := range c.releases {
+			if o.FieldSelector != nil {
+				if v, ok := o.FieldSelector.RequiresExactMatch(indexRelease); ok && v != hr.GetReleaseNamespace()+"/"+hr.GetReleaseName() {
+					continue
+				}
+			}
+			l.Items = append(l.Items, hr)
+		}
+	}
+	return nil
+}
+
+// fakeSecretReader serves Secrets by name, whatever their namespace.
+type fakeSecretReader map[string]*core.Secret
+
+func (s fakeSecretReader) Get(_ context.Context, key client.ObjectKey, obj client.Object, _ ...client.GetOption) error {
+	secret, ok := s[key.Name]
+	if !ok {
+		return apierrors.NewNotFound(schema.GroupResource{}, key.Name)
+	}
+	secret.DeepCopyInto(obj.(*core.Secret))
+	return nil
+}
+
+func (s fakeSecretReader) List(context.Context, client.ObjectList, ...client.ListOption) error {
+	return nil
+}
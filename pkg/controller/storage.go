@@ -0,0 +1,65 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	"go.bytebuilders.dev/aceshifter/pkg/featuresets"
+	"go.bytebuilders.dev/aceshifter/pkg/tracker"
+
+	helmapi "github.com/fluxcd/helm-controller/api/v2"
+	core "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/yaml"
+)
+
+// storage returns the default storage of the cluster to render into the overlays,
+// or nil if storage overlays are disabled or the cluster has no default StorageClass.
+func (r *HelmReleaseReconciler) storage(ctx context.Context) (*featuresets.Storage, error) {
+	if !r.StorageOverlays {
+		return nil, nil
+	}
+	s, err := tracker.GetDefaultStorage(ctx, r.Client)
+	if err != nil || s == nil {
+		return nil, err
+	}
+	return &featuresets.Storage{
+		ClassName:    s.ClassName,
+		Provisioner:  s.Provisioner,
+		SELinuxMount: s.SELinuxMount() && r.SELinuxChangePolicy,
+	}, nil
+}
+
+// previousOverlay returns the overlay last written for a HelmRelease, or nil if
+// there is none.
+func (r *HelmReleaseReconciler) previousOverlay(ctx context.Context, hr *helmapi.HelmRelease) (map[string]any, error) {
+	var cm core.ConfigMap
+	if err := r.Get(ctx, client.ObjectKey{Namespace: tracker.OverlayNamespace, Name: tracker.OverlayName}, &cm); err != nil {
+		return nil, client.IgnoreNotFound(err)
+	}
+	data, ok := cm.Data[featuresets.OverlayKey(hr)]
+	if !ok {
+		return nil, nil
+	}
+	var m map[string]any
+	if err := yaml.Unmarshal([]byte(data), &m); err != nil {
+		return nil, fmt.Errorf("failed to parse the overlay of %s/%s: %w", hr.Namespace, hr.Name, err)
+	}
+	return m, nil
+}
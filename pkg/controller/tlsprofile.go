@@ -0,0 +1,100 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"reflect"
+
+	"go.bytebuilders.dev/aceshifter/pkg/featuresets"
+	"go.bytebuilders.dev/aceshifter/pkg/tracker"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/utils/ptr"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// tlsProfile returns the TLS security profile of the cluster to render into the
+// overlays, or nil if it is not applied.
+func (r *HelmReleaseReconciler) tlsProfile(ctx context.Context) (*featuresets.TLS, error) {
+	if !r.ApplyTLSProfile {
+		return nil, nil
+	}
+	p, err := tracker.GetTLSProfile(ctx, r.Client)
+	return tlsOverlay(p), err
+}
+
+// ingressTLSProfile returns the TLS security profile of the default OpenShift
+// IngressController to render into the overlays of ingress controllers, so that they
+// serve the same protocols and ciphers as the router. It returns nil if it is not
+// applied.
+func (r *HelmReleaseReconciler) ingressTLSProfile(ctx context.Context) (*featuresets.TLS, error) {
+	if !r.ApplyTLSProfile {
+		return nil, nil
+	}
+	p, err := tracker.GetIngressTLSProfile(ctx, r.Client)
+	return tlsOverlay(p), err
+}
+
+func tlsOverlay(p *tracker.TLSProfile) *featuresets.TLS {
+	if p == nil {
+		return nil
+	}
+	return &featuresets.TLS{
+		MinVersion:   p.MinTLSVersion,
+		CipherSuites: p.IANACipherSuites(),
+		Ciphers:      p.Ciphers,
+	}
+}
+
+// TLSProfileReconciler watches the TLS security profile of the cluster and calls
+// OnChange when it differs from the profile the servers of aceshifter started with.
+// Go TLS servers can't change their config while running, so the caller is expected
+// to restart.
+type TLSProfileReconciler struct {
+	client.Client
+	// Profile is the profile the servers were configured with.
+	Profile  *tracker.TLSProfile
+	OnChange func()
+}
+
+func (r *TLSProfileReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	p, err := tracker.GetTLSProfile(ctx, r.Client)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if !reflect.DeepEqual(p, r.Profile) {
+		log.FromContext(ctx).Info("TLS security profile changed", "profile", p)
+		r.OnChange()
+	}
+	return ctrl.Result{}, nil
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *TLSProfileReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	apiserver := &unstructured.Unstructured{}
+	apiserver.SetGroupVersionKind(tracker.APIServerGVK)
+	return ctrl.NewControllerManagedBy(mgr).
+		Named("tls-profile").
+		For(apiserver).
+		// every replica serves metrics and webhooks, so every replica restarts
+		WithOptions(controller.Options{NeedLeaderElection: ptr.To(false)}).
+		Complete(r)
+}
@@ -0,0 +1,131 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package diff
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+
+	"go.bytebuilders.dev/aceshifter/pkg/controller"
+	"go.bytebuilders.dev/aceshifter/pkg/featuresets"
+	"go.bytebuilders.dev/aceshifter/pkg/tracker"
+
+	helmapi "github.com/fluxcd/helm-controller/api/v2"
+	"github.com/pmezard/go-difflib/difflib"
+	core "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/yaml"
+)
+
+// Change is the difference between the deployed and the desired overlay of a feature.
+type Change struct {
+	Key     string
+	Live    string
+	Desired string
+	// Error is set if the desired overlay could not be rendered.
+	Error error
+}
+
+// Unified returns the change as a unified diff of the normalized YAML.
+func (c Change) Unified() (string, error) {
+	return difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        difflib.SplitLines(c.Live),
+		B:        difflib.SplitLines(c.Desired),
+		FromFile: "live/" + c.Key,
+		ToFile:   "desired/" + c.Key,
+		Context:  3,
+	})
+}
+
+// LiveOverlay reads the overlay ConfigMap from the cluster. A missing ConfigMap
+// is returned as an empty one.
+func LiveOverlay(ctx context.Context, kc client.Reader) (*core.ConfigMap, error) {
+	var cm core.ConfigMap
+	err := kc.Get(ctx, client.ObjectKey{Namespace: tracker.OverlayNamespace, Name: tracker.OverlayName}, &cm)
+	return &cm, client.IgnoreNotFound(err)
+}
+
+// LoadOverlay reads an overlay ConfigMap exported to a YAML or JSON file.
+func LoadOverlay(file string) (*core.ConfigMap, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var cm core.ConfigMap
+	if err := yaml.Unmarshal(data, &cm); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", file, err)
+	}
+	return &cm, nil
+}
+
+// Overlays renders the desired overlay of every HelmRelease managed by the reconciler
+// and compares it key by key with the live overlay ConfigMap. Only changed keys are
+// returned, sorted by key.
+func Overlays(ctx context.Context, r *controller.HelmReleaseReconciler, live *core.ConfigMap) ([]Change, error) {
+	var list helmapi.HelmReleaseList
+	if err := r.List(ctx, &list); err != nil {
+		return nil, err
+	}
+
+	var changes []Change
+	for i := range list.Items {
+		hr := &list.Items[i]
+		key, desired, err := r.DesiredOverlay(ctx, hr)
+		if err != nil {
+			changes = append(changes, Change{Key: featuresets.OverlayKey(hr), Error: err})
+			continue
+		}
+		if key == "" {
+			continue
+		}
+
+		liveData, ok := live.Data[key]
+		if ok {
+			if liveData, err = normalize(liveData); err != nil {
+				return nil, fmt.Errorf("failed to parse live overlay %s: %w", key, err)
+			}
+		}
+		if desired, err = normalize(desired); err != nil {
+			return nil, fmt.Errorf("failed to parse desired overlay %s: %w", key, err)
+		}
+		if ok && liveData == desired {
+			continue
+		}
+		changes = append(changes, Change{Key: key, Live: liveData, Desired: desired})
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Key < changes[j].Key
+	})
+	return changes, nil
+}
+
+// normalize re-encodes YAML with sorted keys, so that only value changes show up
+// in the diff.
+func normalize(s string) (string, error) {
+	var v any
+	if err := yaml.Unmarshal([]byte(s), &v); err != nil {
+		return "", err
+	}
+	if v == nil {
+		v = map[string]any{}
+	}
+	out, err := yaml.Marshal(v)
+	return string(out), err
+}
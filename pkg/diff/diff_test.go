@@ -0,0 +1,56 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package diff
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNormalize(t *testing.T) {
+	a, err := normalize("b: 1\na:\n  runAsUser: 1000\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := normalize(`{"a": {"runAsUser": 1000}, "b": 1}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a != b {
+		t.Errorf("normalize() = %q, want %q", a, b)
+	}
+	if empty, _ := normalize(""); empty != "{}\n" {
+		t.Errorf("normalize(\"\") = %q, want {}", empty)
+	}
+}
+
+func TestUnified(t *testing.T) {
+	c := Change{
+		Key:     "kube-ui-server.yaml",
+		Live:    "securityContext:\n  runAsUser: 1000\n",
+		Desired: "securityContext:\n  runAsUser: 2000\n",
+	}
+	s, err := c.Unified()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"--- live/kube-ui-server.yaml", "+++ desired/kube-ui-server.yaml", "-  runAsUser: 1000", "+  runAsUser: 2000"} {
+		if !strings.Contains(s, want) {
+			t.Errorf("Unified() = %q, missing %q", s, want)
+		}
+	}
+}
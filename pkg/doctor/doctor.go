@@ -0,0 +1,327 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package doctor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"sort"
+	"text/tabwriter"
+
+	"go.bytebuilders.dev/aceshifter/pkg/controller"
+	"go.bytebuilders.dev/aceshifter/pkg/featuresets"
+	"go.bytebuilders.dev/aceshifter/pkg/tracker"
+
+	helmapi "github.com/fluxcd/helm-controller/api/v2"
+	apps "k8s.io/api/apps/v1"
+	authorization "k8s.io/api/authorization/v1"
+	core "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	uiapi "kmodules.xyz/resource-metadata/apis/ui/v1alpha1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+type Severity string
+
+const (
+	SeverityError   Severity = "Error"
+	SeverityWarning Severity = "Warning"
+	SeverityInfo    Severity = "Info"
+)
+
+const (
+	CheckNamespaceRange  = "NamespaceRange"
+	CheckRangeMismatch   = "RangeMismatch"
+	CheckEmptyOverlay    = "EmptyOverlay"
+	CheckSCCBinding      = "SCCBinding"
+	CheckOverlayValueRef = "OverlayValuesFrom"
+)
+
+type Finding struct {
+	Check    string   `json:"check"`
+	Severity Severity `json:"severity"`
+	Object   string   `json:"object"`
+	Message  string   `json:"message"`
+}
+
+type Report struct {
+	Findings []Finding `json:"findings"`
+}
+
+func (r *Report) add(check string, sev Severity, obj, format string, args ...any) {
+	r.Findings = append(r.Findings, Finding{
+		Check:    check,
+		Severity: sev,
+		Object:   obj,
+		Message:  fmt.Sprintf(format, args...),
+	})
+}
+
+// HasErrors returns true if any finding has the Error severity.
+func (r *Report) HasErrors() bool {
+	return slices.ContainsFunc(r.Findings, func(f Finding) bool {
+		return f.Severity == SeverityError
+	})
+}
+
+func (r *Report) PrintTable(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	_, _ = fmt.Fprintln(tw, "SEVERITY\tCHECK\tOBJECT\tMESSAGE")
+	for _, f := range r.Findings {
+		_, _ = fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", f.Severity, f.Check, f.Object, f.Message)
+	}
+	return tw.Flush()
+}
+
+// Run checks the OpenShift readiness of the ACE HelmReleases of a cluster. The
+// overlays are rendered with the options of r, like the controller does.
+func Run(ctx context.Context, r *controller.HelmReleaseReconciler) (*Report, error) {
+	var report Report
+
+	var list helmapi.HelmReleaseList
+	if err := r.List(ctx, &list); err != nil {
+		return nil, err
+	}
+	uids := map[string]tracker.Range{}
+	for i := range list.Items {
+		hr := &list.Items[i]
+		var feature uiapi.Feature
+		filename, err := featuresets.TemplateFile(ctx, r.Client, hr, &feature)
+		if err != nil {
+			return nil, err
+		}
+		if filename == "" {
+			continue
+		}
+		obj := "helmrelease/" + hr.Namespace + "/" + hr.Name
+		ns := hr.GetReleaseNamespace()
+
+		uid, checked := uids[ns]
+		if !checked {
+			if uid, err = checkNamespace(ctx, r.Client, ns, &report); err != nil {
+				return nil, err
+			}
+			uids[ns] = uid
+		}
+
+		opts, err := r.RenderOptions(ctx, hr, &feature, uid.Start, uid.Size)
+		var invalid *controller.InvalidAnnotationError
+		if errors.As(err, &invalid) {
+			report.add(CheckEmptyOverlay, SeverityWarning, obj, "overlay %s can't be rendered: %v", filename, invalid.Err)
+		} else if err != nil {
+			return nil, err
+		} else if uid.Start != tracker.UidNone {
+			// the overlay is rendered for the range of the namespace, a namespace
+			// without one is reported by checkNamespace
+			checkOverlay(filename, opts, obj, &report)
+		}
+
+		key := featuresets.OverlayKey(hr)
+		if !slices.ContainsFunc(hr.Spec.ValuesFrom, func(ref helmapi.ValuesReference) bool {
+			return ref.Kind == "ConfigMap" && ref.Name == tracker.OverlayName && ref.ValuesKey == key
+		}) {
+			report.add(CheckOverlayValueRef, SeverityError, obj, "valuesFrom does not reference key %s of ConfigMap %s", key, tracker.OverlayName)
+		}
+
+		scc, err := featuresets.RequiredSCC(filename, opts)
+		if err != nil {
+			return nil, err
+		}
+		if scc != "" {
+			accounts, err := releaseServiceAccounts(ctx, r.Client, hr)
+			if err != nil {
+				return nil, err
+			}
+			if len(accounts) == 0 {
+				report.add(CheckSCCBinding, SeverityInfo, obj, "release has no workloads yet, required SCC %s is not checked", scc)
+			}
+			for _, sa := range accounts {
+				if err := checkSCC(ctx, r.Client, ns, sa, scc, obj, &report); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+
+	sort.SliceStable(report.Findings, func(i, j int) bool {
+		return report.Findings[i].Object < report.Findings[j].Object
+	})
+	return &report, nil
+}
+
+// checkOverlay reports the overlay of a feature that can't be rendered or is empty.
+// A feature without template gets an empty overlay, like in the controller.
+func checkOverlay(filename string, opts featuresets.Options, obj string, report *Report) {
+	vals, err := featuresets.Render(filename, opts)
+	if errors.Is(err, featuresets.ErrNoTemplate) {
+		vals = []byte("{}")
+	} else if err != nil {
+		report.add(CheckEmptyOverlay, SeverityWarning, obj, "overlay %s can't be rendered: %v", filename, err)
+		return
+	}
+	if string(vals) == "{}" {
+		report.add(CheckEmptyOverlay, SeverityInfo, obj, "overlay %s is empty", filename)
+	}
+}
+
+// checkNamespace reports the range annotations of a namespace and returns its uid
+// range, or tracker.UidNone if it has no valid one.
+func checkNamespace(ctx context.Context, kc client.Client, name string, report *Report) (tracker.Range, error) {
+	none := tracker.Range{Start: tracker.UidNone, Size: tracker.UidNone}
+	var ns core.Namespace
+	if err := kc.Get(ctx, client.ObjectKey{Name: name}, &ns); apierrors.IsNotFound(err) {
+		report.add(CheckNamespaceRange, SeverityWarning, "namespace/"+name, "namespace does not exist")
+		return none, nil
+	} else if err != nil {
+		return none, err
+	}
+	return checkRange(&ns, report), nil
+}
+
+func checkRange(ns *core.Namespace, report *Report) tracker.Range {
+	none := tracker.Range{Start: tracker.UidNone, Size: tracker.UidNone}
+	obj := "namespace/" + ns.Name
+	_, foundUid := ns.Annotations[tracker.KeyUid]
+	_, foundGroups := ns.Annotations[tracker.KeyFsGroup]
+	switch {
+	case !foundUid && !foundGroups:
+		report.add(CheckNamespaceRange, SeverityError, obj, "missing %s and %s annotations", tracker.KeyUid, tracker.KeyFsGroup)
+		return none
+	case !foundUid:
+		report.add(CheckNamespaceRange, SeverityError, obj, "missing %s annotation", tracker.KeyUid)
+		return none
+	case !foundGroups:
+		report.add(CheckNamespaceRange, SeverityError, obj, "missing %s annotation", tracker.KeyFsGroup)
+		return none
+	}
+	start, size, err := tracker.NamespaceUid(ns)
+	if err != nil {
+		report.add(CheckRangeMismatch, SeverityError, obj, "%v", err)
+		return none
+	}
+	return tracker.Range{Start: start, Size: size}
+}
+
+// releaseServiceAccounts returns the ServiceAccounts of the Deployments, StatefulSets
+// and DaemonSets installed by a HelmRelease.
+func releaseServiceAccounts(ctx context.Context, kc client.Client, hr *helmapi.HelmRelease) ([]string, error) {
+	ns := hr.GetReleaseNamespace()
+	var objs []client.Object
+	var deployments apps.DeploymentList
+	if err := kc.List(ctx, &deployments, client.InNamespace(ns)); err != nil {
+		return nil, err
+	}
+	for i := range deployments.Items {
+		objs = append(objs, &deployments.Items[i])
+	}
+	var statefulSets apps.StatefulSetList
+	if err := kc.List(ctx, &statefulSets, client.InNamespace(ns)); err != nil {
+		return nil, err
+	}
+	for i := range statefulSets.Items {
+		objs = append(objs, &statefulSets.Items[i])
+	}
+	var daemonSets apps.DaemonSetList
+	if err := kc.List(ctx, &daemonSets, client.InNamespace(ns)); err != nil {
+		return nil, err
+	}
+	for i := range daemonSets.Items {
+		objs = append(objs, &daemonSets.Items[i])
+	}
+	return serviceAccounts(objs, hr.GetReleaseName(), ns), nil
+}
+
+func serviceAccounts(objs []client.Object, release, ns string) []string {
+	var out []string
+	for _, obj := range objs {
+		a := obj.GetAnnotations()
+		if a[tracker.KeyHelmReleaseName] != release || a[tracker.KeyHelmReleaseNamespace] != ns {
+			continue
+		}
+		var spec core.PodSpec
+		switch w := obj.(type) {
+		case *apps.Deployment:
+			spec = w.Spec.Template.Spec
+		case *apps.StatefulSet:
+			spec = w.Spec.Template.Spec
+		case *apps.DaemonSet:
+			spec = w.Spec.Template.Spec
+		}
+		sa := spec.ServiceAccountName
+		if sa == "" {
+			sa = "default"
+		}
+		if !slices.Contains(out, sa) {
+			out = append(out, sa)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+// checkSCC reports if the ServiceAccount of a feature may not use an SCC, either
+// through RBAC or through the users and groups of the SCC.
+func checkSCC(ctx context.Context, kc client.Client, ns, sa, scc, obj string, report *Report) error {
+	user := tracker.ServiceAccountUser(ns, sa)
+	groups := []string{"system:serviceaccounts", "system:serviceaccounts:" + ns, "system:authenticated"}
+
+	var u unstructured.Unstructured
+	u.SetGroupVersionKind(tracker.SCCGVK)
+	if err := kc.Get(ctx, client.ObjectKey{Name: scc}, &u); err != nil {
+		if apierrors.IsNotFound(err) || meta.IsNoMatchError(err) {
+			report.add(CheckSCCBinding, SeverityError, obj, "required SCC %s not found", scc)
+			return nil
+		}
+		return err
+	}
+	if sccAllows(&u, user, groups) {
+		return nil
+	}
+
+	sar := authorization.SubjectAccessReview{
+		Spec: authorization.SubjectAccessReviewSpec{
+			User:   user,
+			Groups: groups,
+			ResourceAttributes: &authorization.ResourceAttributes{
+				Namespace: ns,
+				Verb:      "use",
+				Group:     tracker.SCCGVK.Group,
+				Resource:  "securitycontextconstraints",
+				Name:      scc,
+			},
+		},
+	}
+	if err := kc.Create(ctx, &sar); err != nil {
+		return err
+	}
+	if !sar.Status.Allowed {
+		report.add(CheckSCCBinding, SeverityError, obj, "ServiceAccount %s/%s can't use required SCC %s", ns, sa, scc)
+	}
+	return nil
+}
+
+// sccAllows returns true if the users or groups of an SCC list the user or one of its groups.
+func sccAllows(scc *unstructured.Unstructured, user string, groups []string) bool {
+	sccUsers, _, _ := unstructured.NestedStringSlice(scc.Object, "users")
+	sccGroups, _, _ := unstructured.NestedStringSlice(scc.Object, "groups")
+	return slices.Contains(sccUsers, user) || slices.ContainsFunc(groups, func(g string) bool { return slices.Contains(sccGroups, g) })
+}
@@ -0,0 +1,139 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package doctor
+
+import (
+	"reflect"
+	"testing"
+
+	"go.bytebuilders.dev/aceshifter/pkg/featuresets"
+	"go.bytebuilders.dev/aceshifter/pkg/tracker"
+
+	apps "k8s.io/api/apps/v1"
+	core "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func TestCheckRange(t *testing.T) {
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		uid         tracker.Range
+		checks      []string
+	}{
+		{
+			name:        "valid",
+			annotations: map[string]string{tracker.KeyUid: "1000680000/10000", tracker.KeyFsGroup: "1000680000/10000"},
+			uid:         tracker.Range{Start: 1000680000, Size: 10000},
+		},
+		{
+			name:   "missing",
+			uid:    tracker.Range{Start: tracker.UidNone, Size: tracker.UidNone},
+			checks: []string{CheckNamespaceRange},
+		},
+		{
+			name:        "missing groups",
+			annotations: map[string]string{tracker.KeyUid: "1000680000/10000"},
+			uid:         tracker.Range{Start: tracker.UidNone, Size: tracker.UidNone},
+			checks:      []string{CheckNamespaceRange},
+		},
+		{
+			name:        "mismatch",
+			annotations: map[string]string{tracker.KeyUid: "1000680000/10000", tracker.KeyFsGroup: "1000690000/10000"},
+			uid:         tracker.Range{Start: tracker.UidNone, Size: tracker.UidNone},
+			checks:      []string{CheckRangeMismatch},
+		},
+	}
+	for _, tt := range tests {
+		var report Report
+		uid := checkRange(&core.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "kubeops", Annotations: tt.annotations}}, &report)
+		if uid != tt.uid {
+			t.Errorf("%s: expected uid range %v, got %v", tt.name, tt.uid, uid)
+		}
+		var checks []string
+		for _, f := range report.Findings {
+			checks = append(checks, f.Check)
+		}
+		if !reflect.DeepEqual(checks, tt.checks) {
+			t.Errorf("%s: expected findings %v, got %v", tt.name, tt.checks, report.Findings)
+		}
+	}
+}
+
+func TestServiceAccounts(t *testing.T) {
+	release := map[string]string{tracker.KeyHelmReleaseName: "longhorn", tracker.KeyHelmReleaseNamespace: "longhorn-system"}
+	other := map[string]string{tracker.KeyHelmReleaseName: "falco", tracker.KeyHelmReleaseNamespace: "longhorn-system"}
+
+	manager := &apps.DaemonSet{ObjectMeta: metav1.ObjectMeta{Annotations: release}}
+	manager.Spec.Template.Spec.ServiceAccountName = "longhorn-service-account"
+	ui := &apps.Deployment{ObjectMeta: metav1.ObjectMeta{Annotations: release}}
+	driver := &apps.Deployment{ObjectMeta: metav1.ObjectMeta{Annotations: release}}
+	driver.Spec.Template.Spec.ServiceAccountName = "longhorn-service-account"
+	falco := &apps.DaemonSet{ObjectMeta: metav1.ObjectMeta{Annotations: other}}
+	falco.Spec.Template.Spec.ServiceAccountName = "falco"
+
+	got := serviceAccounts([]client.Object{manager, ui, driver, falco}, "longhorn", "longhorn-system")
+	expected := []string{"default", "longhorn-service-account"}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+}
+
+func TestSCCAllows(t *testing.T) {
+	scc := &unstructured.Unstructured{Object: map[string]any{
+		"users":  []any{"system:serviceaccount:falco:falco"},
+		"groups": []any{"system:cluster-admins"},
+	}}
+	groups := []string{"system:serviceaccounts", "system:serviceaccounts:falco", "system:authenticated"}
+	if !sccAllows(scc, "system:serviceaccount:falco:falco", groups) {
+		t.Error("expected the SCC user to be allowed")
+	}
+	if sccAllows(scc, "system:serviceaccount:falco:default", groups) {
+		t.Error("expected another ServiceAccount to be denied")
+	}
+	scc.Object["groups"] = []any{"system:serviceaccounts:falco"}
+	if !sccAllows(scc, "system:serviceaccount:falco:default", groups) {
+		t.Error("expected a ServiceAccount of an SCC group to be allowed")
+	}
+}
+
+func TestCheckOverlay(t *testing.T) {
+	tests := []struct {
+		filename string
+		findings []Finding
+	}{
+		{filename: "opscenter-core/aceshifter.yaml"},
+		{
+			filename: "opscenter-core/missing.yaml",
+			findings: []Finding{{
+				Check:    CheckEmptyOverlay,
+				Severity: SeverityInfo,
+				Object:   "helmrelease/kubeops/demo",
+				Message:  "overlay opscenter-core/missing.yaml is empty",
+			}},
+		},
+	}
+	for _, tt := range tests {
+		var report Report
+		checkOverlay(tt.filename, featuresets.Options{UidStart: 1000680000, UidRange: 10000}, "helmrelease/kubeops/demo", &report)
+		if !reflect.DeepEqual(report.Findings, tt.findings) {
+			t.Errorf("%s: expected findings %v, got %v", tt.filename, tt.findings, report.Findings)
+		}
+	}
+}
@@ -0,0 +1,70 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package featuresets
+
+import (
+	"fmt"
+	"hash/fnv"
+)
+
+// Allocator hands out a distinct uid inside [start, start+range) to each component key.
+// The uid of a key is derived from its hash, so assignments are stable as long as
+// the same keys are allocated in the same order. Colliding keys probe the next free uid.
+type Allocator struct {
+	start    int64
+	size     int64
+	assigned map[string]int64
+	used     map[int64]string
+}
+
+func NewAllocator(start, size int64, reserved ...int64) *Allocator {
+	a := &Allocator{
+		start:    start,
+		size:     size,
+		assigned: map[string]int64{},
+		used:     map[int64]string{},
+	}
+	for _, uid := range reserved {
+		a.used[uid] = ""
+	}
+	return a
+}
+
+func (a *Allocator) UidFor(key string) (int64, error) {
+	if uid, ok := a.assigned[key]; ok {
+		return uid, nil
+	}
+	if a.size <= 0 {
+		return 0, fmt.Errorf("can't allocate uid for %s from an empty uid range", key)
+	}
+	if int64(len(a.used)) >= a.size {
+		return 0, fmt.Errorf("uid range %d/%d is exhausted", a.start, a.size)
+	}
+
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(key))
+	offset := int64(h.Sum64() % uint64(a.size))
+	for {
+		uid := a.start + offset
+		if _, ok := a.used[uid]; !ok {
+			a.assigned[key] = uid
+			a.used[uid] = key
+			return uid, nil
+		}
+		offset = (offset + 1) % a.size
+	}
+}
@@ -0,0 +1,159 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package featuresets
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+)
+
+const CatalogFile = "catalog.yaml"
+
+// Field identifies which security context field the generator sets at a values path.
+type Field string
+
+const (
+	// FieldPod sets the pod level fields (fsGroup) of a PodSecurityContext.
+	FieldPod Field = "pod"
+	// FieldContainer sets the container level fields (runAsUser) of a SecurityContext.
+	FieldContainer  Field = "container"
+	FieldRunAsUser  Field = "runAsUser"
+	FieldRunAsGroup Field = "runAsGroup"
+	FieldFsGroup    Field = "fsGroup"
+	// FieldSeccomp sets seccompProfile.type to RuntimeDefault.
+	FieldSeccomp Field = "seccomp"
+)
+
+// Entry maps a dotted values path (eg, nats.securityContext) to the fields set there.
+type Entry map[string][]Field
+
+// Catalog maps a feature key (<featureset>/<feature>, or the ace release name) to its Entry.
+type Catalog map[string]Entry
+
+func LoadCatalog() (Catalog, error) {
+	data, err := fs.ReadFile(CatalogFile)
+	if err != nil {
+		return nil, err
+	}
+	return ParseCatalog(data)
+}
+
+func ParseCatalog(data []byte) (Catalog, error) {
+	var c Catalog
+	if err := yaml.UnmarshalStrict(data, &c); err != nil {
+		return nil, fmt.Errorf("failed to parse catalog: %w", err)
+	}
+	for feature, entry := range c {
+		for path, fields := range entry {
+			if path == "" {
+				return nil, fmt.Errorf("feature %s has an empty values path", feature)
+			}
+			for _, f := range fields {
+				if err := f.set(map[string]any{}, 0); err != nil {
+					return nil, fmt.Errorf("feature %s path %s: %w", feature, path, err)
+				}
+			}
+		}
+	}
+	return c, nil
+}
+
+// Values generates the overlay values of an Entry for the given uid.
+func (e Entry) Values(uid int64) (map[string]any, error) {
+	return e.values(uid)
+}
+
+func (e Entry) values(uid any) (map[string]any, error) {
+	paths := make([]string, 0, len(e))
+	for path := range e {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	vals := map[string]any{}
+	for _, path := range paths {
+		m := vals
+		for _, key := range strings.Split(path, ".") {
+			next, ok := m[key].(map[string]any)
+			if !ok {
+				next = map[string]any{}
+				m[key] = next
+			}
+			m = next
+		}
+		for _, f := range e[path] {
+			if err := f.set(m, uid); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return vals, nil
+}
+
+// Render generates the overlay of an Entry in the same format as the rendered templates.
+func (e Entry) Render(uid int64) ([]byte, error) {
+	return e.render(uid)
+}
+
+// Template generates an overlay template of an Entry, equivalent to a hand-written
+// featureset template file.
+func (e Entry) Template() ([]byte, error) {
+	data, err := e.render(uidPlaceholder)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.ReplaceAll(data, []byte("'"+uidPlaceholder+"'"), []byte(uidPlaceholder)), nil
+}
+
+const uidPlaceholder = "{{ .uid }}"
+
+func (e Entry) render(uid any) ([]byte, error) {
+	vals, err := e.values(uid)
+	if err != nil {
+		return nil, err
+	}
+	if len(vals) == 0 {
+		return []byte("{}"), nil
+	}
+	data, err := yaml.Marshal(vals)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.TrimSpace(data), nil
+}
+
+func (f Field) set(m map[string]any, uid any) error {
+	switch f {
+	case FieldPod, FieldFsGroup:
+		m["fsGroup"] = uid
+	case FieldContainer, FieldRunAsUser:
+		m["runAsUser"] = uid
+	case FieldRunAsGroup:
+		m["runAsGroup"] = uid
+	case FieldSeccomp:
+		m["seccompProfile"] = map[string]any{
+			"type": "RuntimeDefault",
+		}
+	default:
+		return fmt.Errorf("unknown field %q", f)
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package featuresets
+
+import (
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/yaml"
+)
+
+func TestLoadCatalog(t *testing.T) {
+	c, err := LoadCatalog()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(c) == 0 {
+		t.Error("expected catalog entries")
+	}
+}
+
+func TestRenderCatalogWithTemplate(t *testing.T) {
+	out, err := Render("opscenter-core/kube-ui-server.yaml", Options{
+		UidStart: 1000,
+		UidRange: 10000,
+		TLS:      &TLS{MinVersion: "VersionTLS12"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	vals := map[string]any{}
+	if err := yaml.Unmarshal(out, &vals); err != nil {
+		t.Fatal(err)
+	}
+	if v, _, _ := unstructured.NestedFieldNoCopy(vals, "image", "securityContext", "runAsUser"); v != float64(1000) {
+		t.Errorf("expected runAsUser from the catalog entry, got %v", v)
+	}
+	if v, _, _ := unstructured.NestedString(vals, "apiserver", "tls", "minVersion"); v != "VersionTLS12" {
+		t.Errorf("expected apiserver.tls.minVersion from the template, got %q", v)
+	}
+}
+
+func TestEntryRender(t *testing.T) {
+	entry := Entry{
+		"image.securityContext": {FieldContainer, FieldSeccomp},
+		"podSecurityContext":    {FieldPod},
+		"nats.securityContext":  {FieldRunAsUser, FieldRunAsGroup, FieldFsGroup},
+	}
+	out, err := entry.Render(1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `image:
+  securityContext:
+    runAsUser: 1000
+    seccompProfile:
+      type: RuntimeDefault
+nats:
+  securityContext:
+    fsGroup: 1000
+    runAsGroup: 1000
+    runAsUser: 1000
+podSecurityContext:
+  fsGroup: 1000`
+	if string(out) != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, out)
+	}
+
+	if _, err := ParseCatalog([]byte("a/b:\n  securityContext: [unknown]\n")); err == nil {
+		t.Error("expected error for unknown field")
+	}
+}
@@ -0,0 +1,150 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package featuresets
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"sync"
+
+	"sigs.k8s.io/yaml"
+)
+
+const FIPSFile = "fips.yaml"
+
+type FIPSMode string
+
+const (
+	// FIPSModeAuto picks FIPSModeOn when the cluster runs in FIPS mode. It is
+	// resolved before rendering. Unlike FIPSModeOn, it refuses the features whose
+	// images are not known to support the FIPS mode instead of enabling it.
+	FIPSModeAuto FIPSMode = "auto"
+	// FIPSModeOn renders the FIPS overlays and refuses non-compliant features.
+	// Templates read it as {{ .fips }}.
+	FIPSModeOn  FIPSMode = "on"
+	FIPSModeOff FIPSMode = "off"
+)
+
+func ParseFIPSMode(s string) (FIPSMode, error) {
+	switch FIPSMode(s) {
+	case "", FIPSModeAuto, FIPSModeOn, FIPSModeOff:
+		return FIPSMode(s), nil
+	}
+	return "", fmt.Errorf("unknown FIPS mode %q, must be one of auto|on|off", s)
+}
+
+// fipsCatalog lists the features known to support the FIPS 140-3 mode and the
+// features refused on FIPS clusters, see FIPSFile.
+type fipsCatalog struct {
+	Capable map[string]fipsImages `json:"capable"`
+	Refused map[string]string     `json:"refused"`
+}
+
+// fipsImages selects the FIPS variants of the images of a chart.
+type fipsImages struct {
+	// TagSuffix is appended to the tags of the images of the chart defaults.
+	TagSuffix string `json:"tagSuffix,omitempty"`
+}
+
+var loadFIPSCatalog = sync.OnceValues(func() (*fipsCatalog, error) {
+	data, err := fs.ReadFile(FIPSFile)
+	if err != nil {
+		return nil, err
+	}
+	var c fipsCatalog
+	if err := yaml.UnmarshalStrict(data, &c); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", FIPSFile, err)
+	}
+	return &c, nil
+})
+
+// FIPSNonCompliant returns the reason a feature can't run on a FIPS cluster, if it
+// is known not to be compliant. Unless mode is FIPSModeOn, a feature whose template
+// enables the FIPS mode of Go is refused too if its images are not known to support it.
+func FIPSNonCompliant(filename string, mode FIPSMode) (string, bool, error) {
+	c, err := loadFIPSCatalog()
+	if err != nil {
+		return "", false, err
+	}
+	feature := strings.TrimSuffix(filename, ".yaml")
+	if reason, ok := c.Refused[feature]; ok {
+		return reason, true, nil
+	}
+	if _, ok := c.Capable[feature]; ok || mode == FIPSModeOn {
+		return "", false, nil
+	}
+	data, err := fs.ReadFile(filename)
+	if err != nil {
+		// features without template render an empty overlay
+		return "", false, nil
+	}
+	if bytes.Contains(data, []byte("fipsEnv")) {
+		return "its images are not known to support the Go FIPS 140-3 mode, use --fips-mode=on to enable it anyway", true, nil
+	}
+	return "", false, nil
+}
+
+// FIPSImages returns the values that select the FIPS variants of the images of a
+// feature, given the values of its chart. The tags of image maps and of image
+// references under keys named image or ending in Image get the tag suffix of the
+// feature. Images without a tag or pinned by digest are left alone.
+func FIPSImages(filename string, values map[string]any) (map[string]any, error) {
+	c, err := loadFIPSCatalog()
+	if err != nil {
+		return nil, err
+	}
+	images := c.Capable[strings.TrimSuffix(filename, ".yaml")]
+	if images.TagSuffix == "" {
+		return map[string]any{}, nil
+	}
+	return fipsTags(values, images.TagSuffix), nil
+}
+
+func fipsTags(values map[string]any, suffix string) map[string]any {
+	out := map[string]any{}
+	for k, v := range values {
+		switch u := v.(type) {
+		case map[string]any:
+			if _, ok := u["repository"].(string); ok {
+				if tag, _ := u["tag"].(string); tag != "" && !strings.HasSuffix(tag, suffix) {
+					out[k] = map[string]any{"tag": tag + suffix}
+				}
+			} else if sub := fipsTags(u, suffix); len(sub) > 0 {
+				out[k] = sub
+			}
+		case string:
+			if (k != "image" && !strings.HasSuffix(k, "Image")) || strings.Contains(u, "@") {
+				continue
+			}
+			i := strings.LastIndex(u, ":")
+			if i > strings.LastIndex(u, "/") && !strings.HasSuffix(u, suffix) {
+				out[k] = u + suffix
+			}
+		}
+	}
+	return out
+}
+
+// fipsEnv enables the FIPS 140-3 mode of the Go cryptographic module in Go
+// components built with Go 1.24 or later. The env entries of the chart defaults are
+// kept by MergeDefaultLists.
+func fipsEnv() (string, error) {
+	return toJSON([]map[string]string{
+		{"name": "GODEBUG", "value": "fips140=on"},
+	})
+}
@@ -0,0 +1,78 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package featuresets
+
+import (
+	"fmt"
+	"strconv"
+
+	"go.bytebuilders.dev/aceshifter/pkg/tracker"
+)
+
+const (
+	// KeyInfraPlacement schedules the pods of a Feature or HelmRelease on infra nodes,
+	// overriding the featuresets selected by the run command. Templates read the
+	// placement as {{ .infra }}.
+	KeyInfraPlacement = "aceshifter.appscode.com/infra-placement"
+)
+
+// ParseInfraPlacement parses the value of the KeyInfraPlacement annotation.
+func ParseInfraPlacement(s string) (bool, error) {
+	v, err := strconv.ParseBool(s)
+	if err != nil {
+		return false, fmt.Errorf("%s annotation value %q is not a boolean", KeyInfraPlacement, s)
+	}
+	return v, nil
+}
+
+// Placement is the node placement rendered into the overlays of features that run
+// on infra nodes. Templates use the infraNodeSelector and infraTolerations functions.
+type Placement struct {
+	NodeSelector map[string]string
+	// TolerationKeys are tolerated with the Exists operator for every effect.
+	TolerationKeys []string
+}
+
+// InfraPlacement returns the placement on OpenShift infra nodes.
+func InfraPlacement() *Placement {
+	return &Placement{
+		NodeSelector:   map[string]string{tracker.LabelInfraNode: ""},
+		TolerationKeys: []string{tracker.LabelInfraNode},
+	}
+}
+
+func (p *Placement) nodeSelector() (string, error) {
+	selector := map[string]string{}
+	if p != nil {
+		selector = p.NodeSelector
+	}
+	return toJSON(selector)
+}
+
+func (p *Placement) tolerations() (string, error) {
+	type toleration struct {
+		Key      string `json:"key"`
+		Operator string `json:"operator"`
+	}
+	tolerations := []toleration{}
+	if p != nil {
+		for _, key := range p.TolerationKeys {
+			tolerations = append(tolerations, toleration{Key: key, Operator: "Exists"})
+		}
+	}
+	return toJSON(tolerations)
+}
@@ -0,0 +1,48 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package featuresets
+
+import (
+	"fmt"
+)
+
+// KeyIngressMode selects how a Feature or HelmRelease is exposed outside the cluster.
+// Templates read it as {{ .ingressMode }}.
+const KeyIngressMode = "aceshifter.appscode.com/ingress-mode"
+
+type IngressMode string
+
+const (
+	// IngressModeIngress exposes charts through their own ingress controllers.
+	IngressModeIngress IngressMode = "ingress"
+	// IngressModeRoute disables the chart ingress controllers and exposes the
+	// Ingresses and Gateways through the OpenShift router.
+	IngressModeRoute IngressMode = "route"
+)
+
+// IngressClassRoute is the class of the chart Ingresses in the route ingress mode.
+// No IngressClass claims it, so neither an ingress controller nor the OpenShift
+// ingress-to-route controller picks them up, and aceshifter generates their Routes.
+const IngressClassRoute = "aceshifter-route"
+
+func ParseIngressMode(s string) (IngressMode, error) {
+	switch IngressMode(s) {
+	case "", IngressModeIngress, IngressModeRoute:
+		return IngressMode(s), nil
+	}
+	return "", fmt.Errorf("unknown ingress mode %q, must be one of ingress|route", s)
+}
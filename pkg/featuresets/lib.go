@@ -19,25 +19,171 @@ package featuresets
 import (
 	"bytes"
 	"embed"
+	"errors"
 	"fmt"
+	iofs "io/fs"
+	"strings"
+	"sync"
 	"text/template"
+
+	"sigs.k8s.io/yaml"
 )
 
 //go:embed *.yaml **/*.yaml
 var fs embed.FS
 
-func Render(filename string, uid int64) ([]byte, error) {
-	t, err := template.ParseFS(fs, filename)
+var catalog = sync.OnceValues(LoadCatalog)
+
+type Options struct {
+	UidStart int64
+	UidRange int64
+	// Strategy overrides the uid strategy set in the template metadata.
+	Strategy Strategy
+	// DefaultStrategy is used when neither Strategy nor the template metadata set one.
+	DefaultStrategy Strategy
+	// UidOffset is added to UidStart by the offset strategy.
+	UidOffset int64
+	// IngressMode selects the networking overlay. Defaults to IngressModeIngress.
+	IngressMode IngressMode
+	// ServiceCA renders the service-ca overlay of charts that can use certificates
+	// issued by the OpenShift service-ca operator.
+	ServiceCA bool
+	// Release is the Helm release name, used by templates to name chart resources.
+	Release string
+	// Values are the values of the release. Templates read the name overrides of
+	// subcharts from them.
+	Values map[string]any
+	// MonitoringMode selects the monitoring overlay. MonitoringModeAuto must be
+	// resolved by the caller. Defaults to MonitoringModePrometheus.
+	MonitoringMode MonitoringMode
+	// Proxy is the egress proxy config, nil if none is propagated.
+	Proxy *Proxy
+	// Infra is the infra node placement, nil if the feature is not placed on infra nodes.
+	Infra *Placement
+	// TLS is the TLS security profile of the cluster, nil if none is applied.
+	TLS *TLS
+	// IngressTLS is the TLS security profile of the default OpenShift ingress
+	// controller, applied to the ingress controllers of the features. Nil if none
+	// is applied.
+	IngressTLS *TLS
+	// FIPS renders the FIPS overlays. FIPSModeAuto must be resolved by the caller.
+	FIPS bool
+	// Storage is the default storage of the cluster, nil if storage overlays are
+	// not rendered.
+	Storage *Storage
+}
+
+// ErrNoTemplate is returned by Render for a feature that has neither a template nor
+// a catalog entry. Its overlay is empty.
+var ErrNoTemplate = errors.New("no template or catalog entry found")
+
+// Render renders the overlay of a feature. The security contexts of its catalog
+// entry, if any, are generated first and its template, if any, is merged over them,
+// so that templates only need to hold what the catalog can't express.
+func Render(filename string, opts Options) ([]byte, error) {
+	data, err := fs.ReadFile(filename)
+	hasTemplate := err == nil
+	if err != nil && !errors.Is(err, iofs.ErrNotExist) {
+		return nil, err
+	}
+	c, err := catalog()
+	if err != nil {
+		return nil, err
+	}
+	entry, hasEntry := c[strings.TrimSuffix(filename, ".yaml")]
+	switch {
+	case !hasTemplate && !hasEntry:
+		return nil, fmt.Errorf("%w for %s", ErrNoTemplate, filename)
+	case !hasEntry:
+		return renderTemplate(filename, data, opts)
+	}
+
+	_, uid, err := opts.resolve(templateStrategy(data))
+	if err != nil {
+		return nil, err
+	}
+	if !hasTemplate {
+		return entry.render(uid)
+	}
+	vals, err := entry.values(uid)
+	if err != nil {
+		return nil, err
+	}
+	out, err := renderTemplate(filename, data, opts)
+	if err != nil {
+		return nil, err
+	}
+	var tpl map[string]any
+	if err := yaml.Unmarshal(out, &tpl); err != nil {
+		return nil, fmt.Errorf("failed to parse rendered template: %w", err)
+	}
+	vals = MergeValues(vals, tpl)
+	if len(vals) == 0 {
+		return []byte("{}"), nil
+	}
+	out, err = yaml.Marshal(vals)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.TrimSpace(out), nil
+}
+
+func renderTemplate(filename string, data []byte, opts Options) ([]byte, error) {
+	strategy, uid, err := opts.resolve(templateStrategy(data))
+	if err != nil {
+		return nil, err
+	}
+	if uid == nil {
+		uid = "null"
+	}
+
+	t, err := template.New(filename).
+		Funcs(template.FuncMap{
+			"uidFor":               opts.uidFor(strategy),
+			"fullname":             fullname(opts.Release, opts.Values),
+			"proxyEnv":             opts.Proxy.env,
+			"trustedCAVolume":      opts.Proxy.volume,
+			"trustedCAVolumeMount": opts.Proxy.volumeMount,
+			"infraNodeSelector":    opts.Infra.nodeSelector,
+			"infraTolerations":     opts.Infra.tolerations,
+			"tlsConfig":            opts.TLS.config,
+			"nginxTLSConfig":       opts.IngressTLS.nginxConfig,
+			"fipsEnv":              fipsEnv,
+		}).
+		Parse(string(data))
 	if err != nil {
 		return nil, err
 	}
 
 	var buf bytes.Buffer
+	ingressMode := opts.IngressMode
+	if ingressMode == "" {
+		ingressMode = IngressModeIngress
+	}
+	monitoringMode := opts.MonitoringMode
+	if monitoringMode == "" || monitoringMode == MonitoringModeAuto {
+		monitoringMode = MonitoringModePrometheus
+	}
 	err = t.Execute(&buf, map[string]any{
-		"uid": uid,
+		"uid":            uid,
+		"ingressMode":    string(ingressMode),
+		"serviceCA":      opts.ServiceCA,
+		"release":        opts.Release,
+		"monitoringMode": string(monitoringMode),
+		"thanosQuerier":  ThanosQuerierURL,
+		"proxy":          opts.Proxy,
+		"infra":          opts.Infra,
+		"tls":            opts.TLS,
+		"ingressTLS":     opts.IngressTLS,
+		"fips":           opts.FIPS,
+		"storage":        opts.Storage,
 	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to render template: %w", err)
 	}
-	return bytes.TrimSpace(buf.Bytes()), nil
+	out := bytes.TrimSpace(buf.Bytes())
+	if len(out) == 0 {
+		return []byte("{}"), nil
+	}
+	return out, nil
 }
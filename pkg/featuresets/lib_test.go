@@ -0,0 +1,646 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package featuresets
+
+import (
+	iofs "io/fs"
+	"reflect"
+	"strings"
+	"testing"
+
+	"go.bytebuilders.dev/aceshifter/pkg/tracker"
+
+	"sigs.k8s.io/yaml"
+)
+
+func TestRenderStrategy(t *testing.T) {
+	tests := []struct {
+		name     string
+		filename string
+		opts     Options
+		expected string
+		wantErr  bool
+	}{
+		{
+			name:     "pin",
+			filename: "opscenter-core/aceshifter.yaml",
+			opts:     Options{UidStart: 1000, UidRange: 10000},
+			expected: "securityContext:\n  runAsUser: 1000\npodSecurityContext:\n  fsGroup: 1000",
+		},
+		{
+			name:     "omit",
+			filename: "opscenter-core/aceshifter.yaml",
+			opts:     Options{UidStart: 1000, UidRange: 10000, DefaultStrategy: StrategyOmit},
+			expected: "securityContext:\n  runAsUser: null\npodSecurityContext:\n  fsGroup: null",
+		},
+		{
+			name:     "offset",
+			filename: "ocm-hub/fluxcd-manager.yaml",
+			opts:     Options{UidStart: 1000, UidRange: 10000, Strategy: StrategyOffset, UidOffset: 5},
+			expected: "securityContext:\n  runAsUser: 1005",
+		},
+		{
+			name:     "catalog omit",
+			filename: "ocm-hub/fluxcd-manager.yaml",
+			opts:     Options{UidStart: 1000, UidRange: 10000, Strategy: StrategyOmit},
+			expected: "securityContext:\n  runAsUser: null",
+		},
+		{
+			name:     "offset out of range",
+			filename: "opscenter-core/aceshifter.yaml",
+			opts:     Options{UidStart: 1000, UidRange: 10000, Strategy: StrategyOffset, UidOffset: 10000},
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := Render(tt.filename, tt.opts)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Render() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if string(out) != tt.expected {
+				t.Errorf("expected:\n%s\ngot:\n%s", tt.expected, out)
+			}
+		})
+	}
+}
+
+func TestTemplateStrategy(t *testing.T) {
+	data := []byte("# " + KeyUidStrategy + ": omit\nsecurityContext:\n  runAsUser: {{ .uid }}\n")
+	if s := templateStrategy(data); s != StrategyOmit {
+		t.Errorf("expected %s, got %s", StrategyOmit, s)
+	}
+}
+
+func TestRenderUidFor(t *testing.T) {
+	opts := Options{UidStart: 1000, UidRange: 10000, Strategy: StrategyOffset}
+	out, err := Render("ace.yaml", opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var vals map[string]any
+	if err := yaml.Unmarshal(out, &vals); err != nil {
+		t.Fatal(err)
+	}
+	uids := map[float64]string{}
+	for _, key := range []string{"nats", "openfga", "platform-api"} {
+		sc := vals[key].(map[string]any)["securityContext"].(map[string]any)
+		uid := sc["runAsUser"].(float64)
+		if uid <= 1000 || uid >= 11000 {
+			t.Errorf("uid %v of %s is outside the range", uid, key)
+		}
+		if other, ok := uids[uid]; ok {
+			t.Errorf("%s and %s have the same uid %v", key, other, uid)
+		}
+		uids[uid] = key
+	}
+
+	again, err := Render("ace.yaml", opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != string(again) {
+		t.Error("uid assignment is not stable")
+	}
+}
+
+func TestRenderIngressMode(t *testing.T) {
+	for _, tt := range []struct {
+		mode      IngressMode
+		className any
+		nginx     map[string]any
+	}{
+		{mode: "", nginx: map[string]any{"controller": map[string]any{"image": map[string]any{"runAsUser": float64(1000)}}}},
+		{mode: IngressModeRoute, className: IngressClassRoute, nginx: map[string]any{"enabled": false}},
+	} {
+		data, err := Render("ace.yaml", Options{UidStart: 1000, UidRange: 10000, IngressMode: tt.mode})
+		if err != nil {
+			t.Fatalf("mode %q: %v", tt.mode, err)
+		}
+		var vals map[string]any
+		if err := yaml.Unmarshal(data, &vals); err != nil {
+			t.Fatalf("mode %q: %v", tt.mode, err)
+		}
+		var className any
+		if ing, ok := vals["ingress"].(map[string]any); ok {
+			className = ing["className"]
+		}
+		if className != tt.className {
+			t.Errorf("mode %q: ingress.className = %v, want %v", tt.mode, className, tt.className)
+		}
+		gotNginx, _ := yaml.Marshal(vals["ingress-nginx"])
+		wantNginx, _ := yaml.Marshal(tt.nginx)
+		if string(gotNginx) != string(wantNginx) {
+			t.Errorf("mode %q: ingress-nginx = %s, want %s", tt.mode, gotNginx, wantNginx)
+		}
+	}
+}
+
+func TestRenderServiceCA(t *testing.T) {
+	for _, serviceCA := range []bool{false, true} {
+		data, err := Render("opscenter-datastore/kubedb.yaml", Options{UidStart: 1000, UidRange: 10000, ServiceCA: serviceCA, Release: "kubedb"})
+		if err != nil {
+			t.Fatalf("serviceCA %v: %v", serviceCA, err)
+		}
+		var vals struct {
+			WebhookServer struct {
+				Apiserver *struct {
+					ServingCerts struct {
+						Generate bool `json:"generate"`
+					} `json:"servingCerts"`
+				} `json:"apiserver"`
+				Service struct {
+					Annotations map[string]string `json:"annotations"`
+				} `json:"service"`
+			} `json:"kubedb-webhook-server"`
+		}
+		if err := yaml.Unmarshal(data, &vals); err != nil {
+			t.Fatalf("serviceCA %v: %v", serviceCA, err)
+		}
+		if !serviceCA {
+			if vals.WebhookServer.Apiserver != nil {
+				t.Errorf("serviceCA false: unexpected apiserver values")
+			}
+			continue
+		}
+		if vals.WebhookServer.Apiserver == nil || vals.WebhookServer.Apiserver.ServingCerts.Generate {
+			t.Errorf("serviceCA true: servingCerts.generate must be false")
+		}
+		if got, want := vals.WebhookServer.Service.Annotations[KeyServingCertSecretName], "kubedb-kubedb-webhook-server-apiserver-cert"; got != want {
+			t.Errorf("serviceCA true: %s = %q, want %q", KeyServingCertSecretName, got, want)
+		}
+	}
+}
+
+func TestRenderMonitoringMode(t *testing.T) {
+	for _, tt := range []struct {
+		filename string
+		mode     MonitoringMode
+		key      string
+		want     any
+	}{
+		{filename: "opscenter-observability/kube-prometheus-stack.yaml", mode: MonitoringModeAuto, key: "prometheus.prometheusSpec.securityContext.runAsUser", want: float64(1000)},
+		{filename: "opscenter-observability/kube-prometheus-stack.yaml", mode: MonitoringModeUserWorkload, key: "prometheus.enabled", want: false},
+		{filename: "opscenter-observability/kube-prometheus-stack.yaml", mode: MonitoringModeUserWorkload, key: "nodeExporter.enabled", want: false},
+		{filename: "opscenter-observability/panopticon.yaml", mode: MonitoringModePrometheus, key: "prometheus.url", want: nil},
+		{filename: "opscenter-observability/panopticon.yaml", mode: MonitoringModeUserWorkload, key: "prometheus.url", want: ThanosQuerierURL},
+		{filename: "opscenter-observability/monitoring-operator.yaml", mode: MonitoringModeUserWorkload, key: "prometheus.url", want: ThanosQuerierURL},
+		{filename: "opscenter-observability/kube-grafana-dashboards.yaml", mode: MonitoringModeUserWorkload, key: "prometheus.url", want: ThanosQuerierURL},
+	} {
+		data, err := Render(tt.filename, Options{UidStart: 1000, UidRange: 10000, MonitoringMode: tt.mode})
+		if err != nil {
+			t.Fatalf("%s %s: %v", tt.filename, tt.mode, err)
+		}
+		var vals map[string]any
+		if err := yaml.Unmarshal(data, &vals); err != nil {
+			t.Fatalf("%s %s: %v", tt.filename, tt.mode, err)
+		}
+		got, _ := getPath(vals, splitPath(tt.key))
+		if got != tt.want {
+			t.Errorf("%s %s: %s = %v, want %v", tt.filename, tt.mode, tt.key, got, tt.want)
+		}
+	}
+}
+
+func TestQueriesThanos(t *testing.T) {
+	err := iofs.WalkDir(fs, ".", func(path string, d iofs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		data, err := fs.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if got, want := QueriesThanos(path), strings.Contains(string(data), ".thanosQuerier"); got != want {
+			t.Errorf("QueriesThanos(%q) = %v, want %v", path, got, want)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestUsesProxy(t *testing.T) {
+	err := iofs.WalkDir(fs, ".", func(path string, d iofs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		data, err := fs.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if got, want := UsesProxy(path), strings.Contains(string(data), ".proxy"); got != want {
+			t.Errorf("UsesProxy(%q) = %v, want %v", path, got, want)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestRenderPlatformOverlays checks the overlays rendered from the cluster config:
+// each path is set to its value with the config, and is unset without it. A nil
+// value must stay unset.
+func TestRenderPlatformOverlays(t *testing.T) {
+	proxy := &Proxy{HTTPSProxy: "http://proxy.example.com:3128", NoProxy: ".cluster.local,.svc", TrustedCA: "ace-trusted-ca-bundle"}
+	proxyEnv := []any{
+		map[string]any{"name": "HTTPS_PROXY", "value": proxy.HTTPSProxy},
+		map[string]any{"name": "NO_PROXY", "value": proxy.NoProxy},
+		map[string]any{"name": "SSL_CERT_FILE", "value": "/etc/ssl/certs/trusted-ca/ca-bundle.crt"},
+	}
+	proxyVolumes := []any{map[string]any{
+		"name": "trusted-ca",
+		"configMap": map[string]any{
+			"name":     proxy.TrustedCA,
+			"optional": true,
+			"items":    []any{map[string]any{"key": "ca-bundle.crt", "path": "ca-bundle.crt"}},
+		},
+	}}
+	infraSelector := map[string]any{tracker.LabelInfraNode: ""}
+	infraTolerations := []any{map[string]any{"key": tracker.LabelInfraNode, "operator": "Exists"}}
+	profile := &TLS{
+		MinVersion:   "VersionTLS12",
+		CipherSuites: []string{"TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256", "TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256"},
+	}
+	tlsConfig := map[string]any{
+		"minVersion":   profile.MinVersion,
+		"cipherSuites": []any{profile.CipherSuites[0], profile.CipherSuites[1]},
+	}
+	ingressProfile := &TLS{
+		MinVersion: "VersionTLS12",
+		Ciphers:    []string{"TLS_AES_128_GCM_SHA256", "ECDHE-ECDSA-AES128-GCM-SHA256", "ECDHE-RSA-AES128-GCM-SHA256"},
+	}
+	nginxConfig := map[string]any{
+		"ssl-protocols": "TLSv1.2 TLSv1.3",
+		"ssl-ciphers":   "ECDHE-ECDSA-AES128-GCM-SHA256:ECDHE-RSA-AES128-GCM-SHA256",
+	}
+	thin := &Storage{ClassName: "thin-csi", Provisioner: "csi.vsphere.vmware.com"}
+	ceph := &Storage{ClassName: "ocs-storagecluster-ceph-rbd", Provisioner: "openshift-storage.rbd.csi.ceph.com", SELinuxMount: true}
+
+	for _, tt := range []struct {
+		filename string
+		opts     Options
+		want     map[string]any
+		// kept are paths set with and without the config
+		kept []string
+	}{
+		{filename: "opscenter-core/flux2.yaml", opts: Options{Proxy: proxy}, want: map[string]any{"sourceController.extraEnv": proxyEnv, "sourceController.volumes": proxyVolumes}},
+		{filename: "opscenter-core/license-proxyserver.yaml", opts: Options{Proxy: proxy}, want: map[string]any{"env": proxyEnv, "volumes": proxyVolumes}},
+		{filename: "opscenter-security/scanner.yaml", opts: Options{Proxy: proxy}, want: map[string]any{"app.env": proxyEnv, "app.volumes": proxyVolumes}},
+		{filename: "opscenter-networking/external-dns-operator.yaml", opts: Options{Proxy: proxy}, want: map[string]any{"env": proxyEnv, "volumes": proxyVolumes}},
+
+		{filename: "opscenter-core/aceshifter.yaml", opts: Options{Infra: InfraPlacement()}, want: map[string]any{"nodeSelector": nil, "tolerations": nil}},
+		{filename: "opscenter-core/flux2.yaml", opts: Options{Infra: InfraPlacement()}, want: map[string]any{"helmController.nodeSelector": infraSelector, "cli.tolerations": infraTolerations}},
+		{filename: "opscenter-core/kube-ui-server.yaml", opts: Options{Infra: InfraPlacement()}, want: map[string]any{"nodeSelector": infraSelector, "tolerations": infraTolerations}},
+		{filename: "opscenter-core/license-proxyserver.yaml", opts: Options{Infra: InfraPlacement()}, want: map[string]any{"nodeSelector": infraSelector, "tolerations": infraTolerations}},
+		{filename: "opscenter-core/opscenter-features.yaml", opts: Options{Infra: InfraPlacement()}, want: map[string]any{"nodeSelector": infraSelector, "tolerations": infraTolerations}},
+
+		{filename: "ace.yaml", opts: Options{TLS: profile}, want: map[string]any{"platform-api.tls": tlsConfig}},
+		{filename: "opscenter-core/kube-ui-server.yaml", opts: Options{TLS: profile}, want: map[string]any{"apiserver.tls": tlsConfig}},
+		{filename: "ocm-mc/kube-ui-server.yaml", opts: Options{TLS: profile}, want: map[string]any{"apiserver.tls": tlsConfig}},
+		{filename: "opscenter-datastore/kubedb.yaml", opts: Options{TLS: profile}, want: map[string]any{"kubedb-webhook-server.apiserver.tls": tlsConfig}},
+		{
+			filename: "opscenter-secret-management/kubevault.yaml",
+			opts:     Options{TLS: profile, ServiceCA: true},
+			want:     map[string]any{"kubevault-webhook-server.apiserver.tls": tlsConfig},
+			kept:     []string{"kubevault-webhook-server.apiserver.servingCerts.generate"},
+		},
+		{
+			filename: "ace.yaml",
+			opts:     Options{IngressTLS: ingressProfile},
+			want:     map[string]any{"ingress-nginx.controller.config": nginxConfig},
+			kept:     []string{"ingress-nginx.controller.image.runAsUser"},
+		},
+		{filename: "ace.yaml", opts: Options{IngressTLS: ingressProfile, IngressMode: IngressModeRoute}, want: map[string]any{"ingress-nginx.controller": nil}},
+		{filename: "ocm-mc/ingress-nginx.yaml", opts: Options{IngressTLS: ingressProfile}, want: map[string]any{"controller.config": nginxConfig}},
+
+		{filename: "ace.yaml", opts: Options{Storage: thin}, want: map[string]any{
+			"nats.securityContext.fsGroupChangePolicy":         "OnRootMismatch",
+			"nats.securityContext.seLinuxChangePolicy":         nil,
+			"nats.nats.jetstream.fileStorage.storageClassName": thin.ClassName,
+		}},
+		{filename: "ace.yaml", opts: Options{Storage: ceph}, want: map[string]any{
+			"nats.securityContext.fsGroupChangePolicy": "OnRootMismatch",
+			"nats.securityContext.seLinuxChangePolicy": "MountOption",
+		}},
+		{filename: "opscenter-datastore/kubedb.yaml", opts: Options{Storage: ceph}, want: map[string]any{
+			"petset.podSecurityContext.fsGroupChangePolicy": "OnRootMismatch",
+			"petset.podSecurityContext.seLinuxChangePolicy": "MountOption",
+		}},
+		{filename: "opscenter-observability/kube-prometheus-stack.yaml", opts: Options{Storage: thin}, want: map[string]any{
+			"prometheus.prometheusSpec.securityContext.fsGroupChangePolicy":     "OnRootMismatch",
+			"alertmanager.alertmanagerSpec.securityContext.fsGroupChangePolicy": "OnRootMismatch",
+			"prometheus.prometheusSpec.securityContext.seLinuxChangePolicy":     nil,
+		}},
+		{filename: "opscenter-observability/kube-prometheus-stack.yaml", opts: Options{Storage: ceph}, want: map[string]any{
+			"prometheus.prometheusSpec.securityContext.seLinuxChangePolicy":     "MountOption",
+			"alertmanager.alertmanagerSpec.securityContext.seLinuxChangePolicy": "MountOption",
+		}},
+	} {
+		tt.opts.UidStart, tt.opts.UidRange = 1000, 10000
+		base := tt.opts
+		base.Proxy, base.Infra, base.TLS, base.IngressTLS, base.Storage = nil, nil, nil, nil, nil
+
+		render := func(opts Options) map[string]any {
+			data, err := Render(tt.filename, opts)
+			if err != nil {
+				t.Fatalf("%s: %v", tt.filename, err)
+			}
+			var vals map[string]any
+			if err := yaml.Unmarshal(data, &vals); err != nil {
+				t.Fatalf("%s: %v\n%s", tt.filename, err, data)
+			}
+			return vals
+		}
+		without, with := render(base), render(tt.opts)
+		for path, want := range tt.want {
+			if got, ok := getPath(without, splitPath(path)); ok {
+				t.Errorf("%s: %s = %v without the cluster config", tt.filename, path, got)
+			}
+			got, _ := getPath(with, splitPath(path))
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("%s: %s = %v, want %v", tt.filename, path, got, want)
+			}
+		}
+		for _, path := range tt.kept {
+			if _, ok := getPath(with, splitPath(path)); !ok {
+				t.Errorf("%s: %s lost with the cluster config", tt.filename, path)
+			}
+		}
+	}
+}
+
+func TestDropUndeclaredTLS(t *testing.T) {
+	tls := func() map[string]any {
+		return map[string]any{"minVersion": "VersionTLS12", "cipherSuites": []any{"TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256"}}
+	}
+	overlay := map[string]any{
+		"apiserver": map[string]any{"tls": tls()},
+		"platform-api": map[string]any{
+			"securityContext": map[string]any{"runAsUser": 1000},
+			"tls":             tls(),
+		},
+		"webhook": map[string]any{"apiserver": map[string]any{"tls": tls()}},
+	}
+	defaults := map[string]any{
+		"apiserver":    map[string]any{"tls": map[string]any{"minVersion": "", "cipherSuites": []any{}}},
+		"platform-api": map[string]any{"tls": map[string]any{"minVersion": ""}},
+	}
+	dropped := DropUndeclaredTLS(overlay, defaults)
+	expected := []string{"platform-api.tls.cipherSuites", "webhook.apiserver.tls.cipherSuites", "webhook.apiserver.tls.minVersion"}
+	if !reflect.DeepEqual(dropped, expected) {
+		t.Errorf("expected dropped %v, got %v", expected, dropped)
+	}
+	want := map[string]any{
+		"apiserver": map[string]any{"tls": tls()},
+		"platform-api": map[string]any{
+			"securityContext": map[string]any{"runAsUser": 1000},
+			"tls":             map[string]any{"minVersion": "VersionTLS12"},
+		},
+	}
+	if !reflect.DeepEqual(overlay, want) {
+		t.Errorf("expected %v, got %v", want, overlay)
+	}
+
+	// without chart defaults only the settings other than tls are kept
+	DropUndeclaredTLS(overlay, nil)
+	want = map[string]any{
+		"platform-api": map[string]any{"securityContext": map[string]any{"runAsUser": 1000}},
+	}
+	if !reflect.DeepEqual(overlay, want) {
+		t.Errorf("expected %v, got %v", want, overlay)
+	}
+}
+
+func TestRenderFIPS(t *testing.T) {
+	for _, filename := range []string{
+		"opscenter-core/aceshifter.yaml",
+		"opscenter-core/kube-ui-server.yaml",
+		"ocm-mc/kube-ui-server.yaml",
+	} {
+		for _, fips := range []bool{false, true} {
+			data, err := Render(filename, Options{UidStart: 1000, UidRange: 10000, FIPS: fips})
+			if err != nil {
+				t.Fatalf("%s: %v", filename, err)
+			}
+			var vals map[string]any
+			if err := yaml.Unmarshal(data, &vals); err != nil {
+				t.Fatalf("%s: %v\n%s", filename, err, data)
+			}
+			env, ok := vals["env"]
+			if !fips {
+				if ok {
+					t.Errorf("%s: env rendered without FIPS", filename)
+				}
+				continue
+			}
+			want := []any{map[string]any{"name": "GODEBUG", "value": "fips140=on"}}
+			if !reflect.DeepEqual(env, want) {
+				t.Errorf("%s: env = %v, want %v", filename, env, want)
+			}
+		}
+	}
+}
+
+func TestFIPSNonCompliant(t *testing.T) {
+	fc, err := loadFIPSCatalog()
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := LoadCatalog()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for feature, reason := range fc.Refused {
+		if reason == "" {
+			t.Errorf("feature %s has no reason", feature)
+		}
+		if _, err := fs.ReadFile(feature + ".yaml"); err != nil {
+			if _, ok := c[feature]; !ok {
+				t.Errorf("feature %s has neither a template nor a catalog entry", feature)
+			}
+		}
+	}
+	for feature := range fc.Capable {
+		if _, err := fs.ReadFile(feature + ".yaml"); err != nil {
+			t.Errorf("FIPS capable feature %s has no template", feature)
+		}
+	}
+
+	tests := []struct {
+		filename string
+		mode     FIPSMode
+		refused  bool
+	}{
+		{filename: "opscenter-core/flux2.yaml", mode: FIPSModeAuto},
+		{filename: "opscenter-networking/voyager.yaml", mode: FIPSModeAuto, refused: true},
+		{filename: "opscenter-networking/voyager.yaml", mode: FIPSModeOn, refused: true},
+		{filename: "opscenter-networking/voyager-gateway.yaml", mode: FIPSModeOn, refused: true},
+		{filename: "opscenter-core/aceshifter.yaml", mode: FIPSModeAuto},
+		{filename: "opscenter-core/kube-ui-server.yaml", mode: FIPSModeAuto, refused: true},
+		{filename: "opscenter-core/kube-ui-server.yaml", mode: FIPSModeOn},
+	}
+	for _, tt := range tests {
+		reason, refused, err := FIPSNonCompliant(tt.filename, tt.mode)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.filename, err)
+		}
+		if refused != tt.refused {
+			t.Errorf("%s in mode %s: expected refused %v, got %v", tt.filename, tt.mode, tt.refused, refused)
+		}
+		if refused && reason == "" {
+			t.Errorf("%s in mode %s: refused without reason", tt.filename, tt.mode)
+		}
+	}
+}
+
+func TestFIPSTags(t *testing.T) {
+	values := map[string]any{
+		"image": map[string]any{"registry": "appscode", "repository": "kube-ui-server", "tag": "v0.0.50"},
+		"operator": map[string]any{
+			"image": map[string]any{"repository": "appscode/operator", "tag": "v1.0.0-fips"},
+		},
+		"cleaner": map[string]any{
+			"image": map[string]any{"repository": "appscode/cleaner"},
+		},
+		"initImage":    "busybox:1.36",
+		"sidecarImage": "ghcr.io/appscode/sidecar@sha256:0123",
+		"proxyImage":   "localhost:5000/proxy",
+		"name":         "demo:v1",
+	}
+	want := map[string]any{
+		"image":     map[string]any{"tag": "v0.0.50-fips"},
+		"initImage": "busybox:1.36-fips",
+	}
+	if got := fipsTags(values, "-fips"); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+
+	images, err := FIPSImages("opscenter-core/kube-ui-server.yaml", values)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(images) != 0 {
+		t.Errorf("expected no FIPS images for a feature without tag suffix, got %v", images)
+	}
+}
+
+func TestRequiredSCC(t *testing.T) {
+	tests := []struct {
+		filename string
+		mode     MonitoringMode
+		want     string
+	}{
+		{filename: "opscenter-storage/longhorn.yaml", want: "privileged"},
+		{filename: "opscenter-storage/longhorn.yaml", mode: MonitoringModeUserWorkload, want: "privileged"},
+		{filename: "opscenter-observability/kube-prometheus-stack.yaml", want: "hostnetwork-v2"},
+		{filename: "opscenter-observability/kube-prometheus-stack.yaml", mode: MonitoringModePrometheus, want: "hostnetwork-v2"},
+		{filename: "opscenter-observability/kube-prometheus-stack.yaml", mode: MonitoringModeUserWorkload},
+		{filename: "opscenter-core/flux2.yaml"},
+	}
+	for _, tt := range tests {
+		got, err := RequiredSCC(tt.filename, Options{MonitoringMode: tt.mode})
+		if err != nil {
+			t.Fatalf("%s %s: %v", tt.filename, tt.mode, err)
+		}
+		if got != tt.want {
+			t.Errorf("%s %s: expected SCC %q, got %q", tt.filename, tt.mode, tt.want, got)
+		}
+	}
+}
+
+func TestRenderLonghornStorage(t *testing.T) {
+	for _, tt := range []struct {
+		storage  *Storage
+		disabled bool
+	}{
+		{storage: nil},
+		{storage: &Storage{ClassName: "longhorn", Provisioner: "driver.longhorn.io"}},
+		{storage: &Storage{ClassName: "thin-csi", Provisioner: "csi.vsphere.vmware.com"}, disabled: true},
+	} {
+		data, err := Render("opscenter-storage/longhorn.yaml", Options{UidStart: 1000, UidRange: 10000, Storage: tt.storage})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var vals map[string]any
+		if err := yaml.Unmarshal(data, &vals); err != nil {
+			t.Fatalf("%v\n%s", err, data)
+		}
+		v, ok := getPath(vals, splitPath("persistence.defaultClass"))
+		if ok != tt.disabled || (ok && v != false) {
+			t.Errorf("storage %v: persistence.defaultClass = %v", tt.storage, v)
+		}
+	}
+}
+
+func TestKeepStorageClassNames(t *testing.T) {
+	render := func() map[string]any {
+		return map[string]any{"nats": map[string]any{
+			"securityContext": map[string]any{"fsGroupChangePolicy": "OnRootMismatch"},
+			"nats":            map[string]any{"jetstream": map[string]any{"fileStorage": map[string]any{"storageClassName": "thin-csi"}}},
+		}}
+	}
+
+	// installed with the storage overlays
+	overlay := render()
+	previous := map[string]any{"nats": map[string]any{
+		"nats": map[string]any{"jetstream": map[string]any{"fileStorage": map[string]any{"storageClassName": "ocs-storagecluster-ceph-rbd"}}},
+	}}
+	if !KeepStorageClassNames(overlay, previous) {
+		t.Error("expected the class of the previous overlay")
+	}
+	if v, _ := getPath(overlay, splitPath("nats.nats.jetstream.fileStorage.storageClassName")); v != "ocs-storagecluster-ceph-rbd" {
+		t.Errorf("storageClassName = %v, want the class of the previous overlay", v)
+	}
+
+	// installed before the storage overlays
+	overlay = render()
+	if !KeepStorageClassNames(overlay, map[string]any{"nats": map[string]any{}}) {
+		t.Error("expected the class to be dropped")
+	}
+	expected := map[string]any{"nats": map[string]any{
+		"securityContext": map[string]any{"fsGroupChangePolicy": "OnRootMismatch"},
+	}}
+	if !reflect.DeepEqual(overlay, expected) {
+		t.Errorf("expected %v, got %v", expected, overlay)
+	}
+
+	overlay = render()
+	if KeepStorageClassNames(overlay, render()) {
+		t.Error("expected no change with the same class")
+	}
+}
+
+func TestFullname(t *testing.T) {
+	for _, tt := range []struct {
+		release string
+		values  map[string]any
+		want    string
+	}{
+		{release: "kubedb", want: "kubedb-kubedb-webhook-server"},
+		{release: "kubedb-webhook-server-prod", want: "kubedb-webhook-server-prod"},
+		{release: "kubedb", values: map[string]any{"kubedb-webhook-server": map[string]any{"nameOverride": "webhook"}}, want: "kubedb-webhook"},
+		{release: "kubedb", values: map[string]any{"kubedb-webhook-server": map[string]any{"fullnameOverride": "kubedb-webhook"}}, want: "kubedb-webhook"},
+		{release: strings.Repeat("x", 60), want: strings.Repeat("x", 60) + "-ku"},
+	} {
+		if got := fullname(tt.release, tt.values)("kubedb-webhook-server"); got != tt.want {
+			t.Errorf("fullname(%q, %v) = %q, want %q", tt.release, tt.values, got, tt.want)
+		}
+	}
+}
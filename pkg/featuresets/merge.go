@@ -0,0 +1,194 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package featuresets
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+)
+
+// KeySkipPaths lists the comma separated values paths of a Feature or HelmRelease
+// that aceshifter must not overwrite, eg, "nats.securityContext,grafana.securityContext.runAsUser"
+const KeySkipPaths = "aceshifter.appscode.com/skip-paths"
+
+// MergeValues deep merges src into dst and returns dst. Maps are merged
+// recursively, any other value in src replaces the one in dst.
+func MergeValues(dst, src map[string]any) map[string]any {
+	if dst == nil {
+		dst = map[string]any{}
+	}
+	for k, v := range src {
+		if sm, ok := v.(map[string]any); ok {
+			if dm, ok := dst[k].(map[string]any); ok {
+				dst[k] = MergeValues(dm, sm)
+				continue
+			}
+			dst[k] = MergeValues(nil, sm)
+			continue
+		}
+		dst[k] = v
+	}
+	return dst
+}
+
+// MergeOverlay drops the skipPaths from a rendered overlay, so that the user provided
+// values of a feature are kept there, and returns it together with the values the chart
+// is installed with: the overlay merged on top of the user provided values. The user
+// values are not copied into the overlay, helm-controller merges them from the Feature,
+// except for the entries of lists of named objects, see mergeNamedLists.
+func MergeOverlay(overlay []byte, values map[string]any, skipPaths []string) ([]byte, map[string]any, error) {
+	var ov map[string]any
+	if err := yaml.Unmarshal(overlay, &ov); err != nil {
+		return nil, nil, fmt.Errorf("failed to parse overlay: %w", err)
+	}
+	for _, p := range skipPaths {
+		if keys := splitPath(p); len(keys) > 0 && ov != nil {
+			deletePath(ov, keys)
+		}
+	}
+	listsMerged := mergeNamedLists(ov, values)
+	merged := MergeValues(MergeValues(nil, values), ov)
+	if len(skipPaths) == 0 && !listsMerged {
+		return overlay, merged, nil
+	}
+	if len(ov) == 0 {
+		return []byte("{}"), merged, nil
+	}
+
+	data, err := yaml.Marshal(ov)
+	if err != nil {
+		return nil, nil, err
+	}
+	return bytes.TrimSpace(data), merged, nil
+}
+
+// mergeNamedLists copies the entries of the user provided lists of named objects,
+// like env, volumes and volumeMounts, into the lists the overlay sets at the same
+// path, unless the overlay sets an entry of the same name. Helm replaces lists
+// instead of merging them, so the overlay would drop them otherwise. It returns true
+// if the overlay changed.
+func mergeNamedLists(ov, values map[string]any) bool {
+	changed := false
+	for k, v := range ov {
+		switch ovv := v.(type) {
+		case map[string]any:
+			if vm, ok := values[k].(map[string]any); ok && mergeNamedLists(ovv, vm) {
+				changed = true
+			}
+		case []any:
+			vl, ok := values[k].([]any)
+			if !ok || !namedList(ovv) || !namedList(vl) {
+				continue
+			}
+			names := map[string]bool{}
+			for _, e := range ovv {
+				names[e.(map[string]any)["name"].(string)] = true
+			}
+			var list []any
+			for _, e := range vl {
+				if !names[e.(map[string]any)["name"].(string)] {
+					list = append(list, e)
+				}
+			}
+			if len(list) > 0 {
+				ov[k] = append(list, ovv...)
+				changed = true
+			}
+		}
+	}
+	return changed
+}
+
+// MergeDefaultLists copies the entries of the lists of named objects of the chart
+// defaults into the lists the overlay sets at the same path, like MergeOverlay does
+// for the user provided values. It returns true if the overlay changed.
+func MergeDefaultLists(overlay, defaults map[string]any) bool {
+	return mergeNamedLists(overlay, defaults)
+}
+
+func namedList(list []any) bool {
+	for _, e := range list {
+		m, ok := e.(map[string]any)
+		if !ok {
+			return false
+		}
+		if _, ok := m["name"].(string); !ok {
+			return false
+		}
+	}
+	return len(list) > 0
+}
+
+// SkipPaths parses the value of the KeySkipPaths annotation.
+func SkipPaths(s string) []string {
+	var paths []string
+	for _, p := range strings.Split(s, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			paths = append(paths, p)
+		}
+	}
+	return paths
+}
+
+func splitPath(p string) []string {
+	return strings.FieldsFunc(p, func(r rune) bool { return r == '.' })
+}
+
+func getPath(m map[string]any, keys []string) (any, bool) {
+	var cur any = m
+	for _, k := range keys {
+		cm, ok := cur.(map[string]any)
+		if !ok {
+			return nil, false
+		}
+		if cur, ok = cm[k]; !ok {
+			return nil, false
+		}
+	}
+	return cur, true
+}
+
+// SetPath sets v at the dotted path p of m, creating the intermediate maps.
+func SetPath(m map[string]any, p string, v any) {
+	setPath(m, splitPath(p), v)
+}
+
+func setPath(m map[string]any, keys []string, v any) {
+	for _, k := range keys[:len(keys)-1] {
+		next, ok := m[k].(map[string]any)
+		if !ok {
+			next = map[string]any{}
+			m[k] = next
+		}
+		m = next
+	}
+	m[keys[len(keys)-1]] = v
+}
+
+func deletePath(m map[string]any, keys []string) {
+	for _, k := range keys[:len(keys)-1] {
+		next, ok := m[k].(map[string]any)
+		if !ok {
+			return
+		}
+		m = next
+	}
+	delete(m, keys[len(keys)-1])
+}
@@ -0,0 +1,127 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package featuresets
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMergeOverlay(t *testing.T) {
+	overlay := []byte("nats:\n  securityContext:\n    runAsUser: 1000\n    fsGroup: 1000\ngrafana:\n  securityContext:\n    runAsUser: 1000")
+	values := map[string]any{
+		"nats": map[string]any{
+			"securityContext": map[string]any{
+				"runAsUser":    float64(2000),
+				"runAsNonRoot": true,
+			},
+		},
+		"grafana": map[string]any{
+			"securityContext": map[string]any{
+				"runAsUser": float64(3000),
+			},
+		},
+	}
+	out, merged, err := MergeOverlay(overlay, values, SkipPaths("grafana.securityContext.runAsUser, nats.securityContext.fsGroup"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `grafana:
+  securityContext: {}
+nats:
+  securityContext:
+    runAsUser: 1000`
+	if string(out) != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, out)
+	}
+
+	expectedValues := map[string]any{
+		"grafana": map[string]any{
+			"securityContext": map[string]any{
+				"runAsUser": float64(3000),
+			},
+		},
+		"nats": map[string]any{
+			"securityContext": map[string]any{
+				"runAsUser":    float64(1000),
+				"runAsNonRoot": true,
+			},
+		},
+	}
+	if !reflect.DeepEqual(merged, expectedValues) {
+		t.Errorf("expected values %v, got %v", expectedValues, merged)
+	}
+}
+
+func TestMergeOverlayNamedLists(t *testing.T) {
+	overlay := []byte(`env: [{"name": "HTTPS_PROXY", "value": "http://proxy:3128"}]
+tolerations: [{"key": "node-role.kubernetes.io/infra", "effect": "NoSchedule"}]`)
+	values := map[string]any{
+		"env": []any{
+			map[string]any{"name": "LOG_LEVEL", "value": "debug"},
+			map[string]any{"name": "HTTPS_PROXY", "value": "http://other:3128"},
+		},
+		"tolerations": []any{
+			map[string]any{"key": "dedicated", "effect": "NoSchedule"},
+		},
+	}
+	out, _, err := MergeOverlay(overlay, values, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `env:
+- name: LOG_LEVEL
+  value: debug
+- name: HTTPS_PROXY
+  value: http://proxy:3128
+tolerations:
+- effect: NoSchedule
+  key: node-role.kubernetes.io/infra`
+	if string(out) != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, out)
+	}
+}
+
+func TestMergeDefaultLists(t *testing.T) {
+	overlay := map[string]any{
+		"env": []any{map[string]any{"name": "GODEBUG", "value": "fips140=on"}},
+		"app": map[string]any{"volumes": []any{map[string]any{"name": "trusted-ca"}}},
+	}
+	defaults := map[string]any{
+		"env": []any{
+			map[string]any{"name": "GOMAXPROCS", "value": "2"},
+			map[string]any{"name": "GODEBUG", "value": "madvdontneed=1"},
+		},
+		"app": map[string]any{"volumes": []any{}},
+	}
+	if !MergeDefaultLists(overlay, defaults) {
+		t.Fatal("expected the overlay to change")
+	}
+	expected := map[string]any{
+		"env": []any{
+			map[string]any{"name": "GOMAXPROCS", "value": "2"},
+			map[string]any{"name": "GODEBUG", "value": "fips140=on"},
+		},
+		"app": map[string]any{"volumes": []any{map[string]any{"name": "trusted-ca"}}},
+	}
+	if !reflect.DeepEqual(overlay, expected) {
+		t.Errorf("expected %v, got %v", expected, overlay)
+	}
+	if MergeDefaultLists(overlay, nil) {
+		t.Error("expected no change without chart defaults")
+	}
+}
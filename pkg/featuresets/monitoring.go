@@ -0,0 +1,70 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package featuresets
+
+import (
+	"fmt"
+	"slices"
+)
+
+const (
+	// KeyMonitoringMode selects the monitoring stack of a Feature or HelmRelease.
+	// Templates read it as {{ .monitoringMode }}.
+	KeyMonitoringMode = "aceshifter.appscode.com/monitoring-mode"
+
+	// ThanosQuerierURL is the OpenShift Thanos Querier endpoint that serves both
+	// platform and user-workload metrics to service accounts bound to the
+	// cluster-monitoring-view ClusterRole. Templates read it as {{ .thanosQuerier }}.
+	ThanosQuerierURL = "https://thanos-querier.openshift-monitoring.svc:9091"
+)
+
+type MonitoringMode string
+
+const (
+	// MonitoringModeAuto picks MonitoringModeUserWorkload when OpenShift user-workload
+	// monitoring is enabled, MonitoringModePrometheus otherwise. It is resolved
+	// before rendering.
+	MonitoringModeAuto MonitoringMode = "auto"
+	// MonitoringModePrometheus runs the ACE kube-prometheus-stack.
+	MonitoringModePrometheus MonitoringMode = "prometheus"
+	// MonitoringModeUserWorkload disables the ACE Prometheus stack and queries the
+	// OpenShift user-workload monitoring stack through the Thanos Querier.
+	MonitoringModeUserWorkload MonitoringMode = "user-workload"
+)
+
+// thanosClients are the features that query the Thanos Querier in the
+// user-workload monitoring mode.
+var thanosClients = []string{
+	"opscenter-observability/kube-grafana-dashboards.yaml",
+	"opscenter-observability/monitoring-operator.yaml",
+	"opscenter-observability/panopticon.yaml",
+}
+
+// QueriesThanos returns true if the overlay of a feature points it at the Thanos
+// Querier in the user-workload monitoring mode. Its service accounts then need the
+// cluster-monitoring-view ClusterRole.
+func QueriesThanos(filename string) bool {
+	return slices.Contains(thanosClients, filename)
+}
+
+func ParseMonitoringMode(s string) (MonitoringMode, error) {
+	switch MonitoringMode(s) {
+	case "", MonitoringModeAuto, MonitoringModePrometheus, MonitoringModeUserWorkload:
+		return MonitoringMode(s), nil
+	}
+	return "", fmt.Errorf("unknown monitoring mode %q, must be one of auto|prometheus|user-workload", s)
+}
@@ -0,0 +1,111 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package featuresets
+
+import (
+	"encoding/json"
+	"path"
+	"slices"
+)
+
+const (
+	trustedCAVolumeName = "trusted-ca"
+	trustedCAMountPath  = "/etc/ssl/certs/trusted-ca"
+	trustedCAKey        = "ca-bundle.crt"
+)
+
+// proxyClients are the features whose overlays render the egress proxy config.
+var proxyClients = []string{
+	"opscenter-core/flux2.yaml",
+	"opscenter-core/license-proxyserver.yaml",
+	"opscenter-networking/external-dns-operator.yaml",
+	"opscenter-security/scanner.yaml",
+}
+
+// UsesProxy returns true if the overlay of a feature renders the egress proxy config.
+func UsesProxy(filename string) bool {
+	return slices.Contains(proxyClients, filename)
+}
+
+// Proxy is the egress proxy config rendered into the overlays of features that
+// pull charts or talk to external services. Templates read it as {{ .proxy }} and
+// use the proxyEnv, trustedCAVolume and trustedCAVolumeMount functions. The env,
+// volumes and volumeMounts lists replace the chart defaults; the user provided
+// entries are kept, see MergeOverlay.
+type Proxy struct {
+	HTTPProxy  string
+	HTTPSProxy string
+	NoProxy    string
+	// TrustedCA is the ConfigMap in the target namespace that holds the trusted CA
+	// bundle under the ca-bundle.crt key. No CA is mounted if it is empty.
+	TrustedCA string
+}
+
+func (p *Proxy) env() (string, error) {
+	type envVar struct {
+		Name  string `json:"name"`
+		Value string `json:"value"`
+	}
+	env := []envVar{}
+	if p != nil {
+		for _, e := range []envVar{
+			{"HTTP_PROXY", p.HTTPProxy},
+			{"HTTPS_PROXY", p.HTTPSProxy},
+			{"NO_PROXY", p.NoProxy},
+		} {
+			if e.Value != "" {
+				env = append(env, e)
+			}
+		}
+		if p.TrustedCA != "" {
+			env = append(env, envVar{"SSL_CERT_FILE", path.Join(trustedCAMountPath, trustedCAKey)})
+		}
+	}
+	return toJSON(env)
+}
+
+func (p *Proxy) volume() (string, error) {
+	name := ""
+	if p != nil {
+		name = p.TrustedCA
+	}
+	return toJSON(map[string]any{
+		"name": trustedCAVolumeName,
+		"configMap": map[string]any{
+			"name":     name,
+			"optional": true,
+			"items": []map[string]string{
+				{"key": trustedCAKey, "path": trustedCAKey},
+			},
+		},
+	})
+}
+
+func (p *Proxy) volumeMount() (string, error) {
+	return toJSON(map[string]any{
+		"name":      trustedCAVolumeName,
+		"mountPath": trustedCAMountPath,
+		"readOnly":  true,
+	})
+}
+
+// toJSON renders the values of template functions. JSON is valid YAML flow content,
+// so templates can place it at any indentation.
+func toJSON(v any) (string, error) {
+	data, err := json.Marshal(v)
+	return string(data), err
+}
@@ -0,0 +1,47 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package featuresets
+
+import (
+	"context"
+	"fmt"
+
+	helmapi "github.com/fluxcd/helm-controller/api/v2"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	uiapi "kmodules.xyz/resource-metadata/apis/ui/v1alpha1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// TemplateFile returns the featureset template of a HelmRelease and loads its Feature.
+// It returns an empty filename for HelmReleases that are not managed by aceshifter.
+func TemplateFile(ctx context.Context, kc client.Reader, hr *helmapi.HelmRelease, feature *uiapi.Feature) (string, error) {
+	if err := kc.Get(ctx, client.ObjectKey{Name: hr.Name}, feature); err != nil {
+		if apierrors.IsNotFound(err) && hr.Spec.Chart != nil && hr.Spec.Chart.Spec.Chart == "ace" {
+			return hr.Name + ".yaml", nil
+		}
+		return "", client.IgnoreNotFound(err)
+	}
+	return fmt.Sprintf("%s/%s.yaml", feature.Spec.FeatureSet, feature.Name), nil
+}
+
+// OverlayKey returns the key of the overlay ConfigMap that holds the values of a HelmRelease.
+func OverlayKey(hr *helmapi.HelmRelease) string {
+	if hr.Name == "ace" && hr.Namespace == "ace-gw" {
+		return "ace-gw.yaml"
+	}
+	return hr.Name + ".yaml"
+}
@@ -0,0 +1,44 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package featuresets
+
+import (
+	"fmt"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+)
+
+const SCCFile = "scc.yaml"
+
+// RequiredSCC returns the SCC that the workloads of a feature need when its overlay
+// is rendered with opts, or an empty string if they don't need one.
+func RequiredSCC(filename string, opts Options) (string, error) {
+	data, err := fs.ReadFile(SCCFile)
+	if err != nil {
+		return "", err
+	}
+	out, err := renderTemplate(SCCFile, data, opts)
+	if err != nil {
+		return "", err
+	}
+	var m map[string]string
+	if err := yaml.UnmarshalStrict(out, &m); err != nil {
+		return "", fmt.Errorf("failed to parse %s: %w", SCCFile, err)
+	}
+	return m[strings.TrimSuffix(filename, ".yaml")], nil
+}
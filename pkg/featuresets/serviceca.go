@@ -0,0 +1,84 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package featuresets
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	// KeyServiceCA switches a Feature or HelmRelease to certificates issued by the
+	// OpenShift service-ca operator. Templates read it as {{ .serviceCA }}.
+	KeyServiceCA = "aceshifter.appscode.com/service-ca"
+
+	// KeyServingCertSecretName asks the service-ca operator to issue a serving
+	// certificate for a Service into the named Secret.
+	KeyServingCertSecretName = "service.beta.openshift.io/serving-cert-secret-name"
+	// KeyInjectCABundle asks the service-ca operator to inject the service CA into
+	// webhook configurations, APIServices, CRDs and ConfigMaps.
+	KeyInjectCABundle = "service.beta.openshift.io/inject-cabundle"
+)
+
+// ParseServiceCA parses the value of the KeyServiceCA annotation.
+func ParseServiceCA(s string) (bool, error) {
+	v, err := strconv.ParseBool(s)
+	if err != nil {
+		return false, fmt.Errorf("%s annotation value %q is not a boolean", KeyServiceCA, s)
+	}
+	return v, nil
+}
+
+// fullname returns the fullname of a subchart of a release, so that templates can
+// refer to the Secrets and Services the chart creates. It follows the fullname
+// helper that `helm create` scaffolds into charts:
+//
+//	{{- if .Values.fullnameOverride }}
+//	{{- .Values.fullnameOverride | trunc 63 | trimSuffix "-" }}
+//	{{- else }}
+//	{{- $name := default .Chart.Name .Values.nameOverride }}
+//	{{- if contains $name .Release.Name }}
+//	{{- .Release.Name | trunc 63 | trimSuffix "-" }}
+//	{{- else }}
+//	{{- printf "%s-%s" .Release.Name $name | trunc 63 | trimSuffix "-" }}
+//
+// with the fullnameOverride and nameOverride of the subchart read from the release
+// values.
+func fullname(release string, values map[string]any) func(chart string) string {
+	return func(chart string) string {
+		sub, _ := values[chart].(map[string]any)
+		if v, _ := sub["fullnameOverride"].(string); v != "" {
+			return truncName(v)
+		}
+		name := chart
+		if v, _ := sub["nameOverride"].(string); v != "" {
+			name = v
+		}
+		if strings.Contains(release, name) {
+			return truncName(release)
+		}
+		return truncName(release + "-" + name)
+	}
+}
+
+func truncName(name string) string {
+	if len(name) > 63 {
+		name = name[:63]
+	}
+	return strings.TrimSuffix(name, "-")
+}
@@ -0,0 +1,86 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package featuresets
+
+import (
+	"reflect"
+	"strings"
+)
+
+const keyStorageClassName = "storageClassName"
+
+// Storage is the default storage of the cluster, rendered into the overlays of
+// features with persistent volumes. Templates read it as {{ .storage }}.
+type Storage struct {
+	// ClassName is the default StorageClass, pinned by charts that create PVCs. It is
+	// only pinned at the first install, see KeepStorageClassNames.
+	ClassName string
+	// Provisioner is the provisioner of the default StorageClass.
+	Provisioner string
+	// SELinuxMount is set if the CSI driver mounts volumes with the SELinux context
+	// of the pod and the API server supports seLinuxChangePolicy, so that pods can
+	// use seLinuxChangePolicy: MountOption instead of relabeling every file of the
+	// volume.
+	SELinuxMount bool
+}
+
+// KeepStorageClassNames sets the storageClassName values of the overlay of an
+// installed release to the ones of its previous overlay, and drops those the previous
+// overlay did not set. The storage class of a PVC or of the volumeClaimTemplates of a
+// StatefulSet can't change, so it is only pinned at the first install. It returns
+// true if the overlay changed.
+func KeepStorageClassNames(overlay, previous map[string]any) bool {
+	want := map[string]any{}
+	collectStorageClassNames(previous, nil, want)
+	have := map[string]any{}
+	collectStorageClassNames(overlay, nil, have)
+	if reflect.DeepEqual(want, have) {
+		return false
+	}
+	for p := range have {
+		keys := splitPath(p)
+		deletePath(overlay, keys)
+		pruneEmpty(overlay, keys[:len(keys)-1])
+	}
+	for p, v := range want {
+		setPath(overlay, splitPath(p), v)
+	}
+	return true
+}
+
+func collectStorageClassNames(m map[string]any, path []string, out map[string]any) {
+	for k, v := range m {
+		if k == keyStorageClassName {
+			out[strings.Join(append(path, k), ".")] = v
+			continue
+		}
+		if vm, ok := v.(map[string]any); ok {
+			collectStorageClassNames(vm, append(append([]string{}, path...), k), out)
+		}
+	}
+}
+
+// pruneEmpty deletes the maps along keys that are left empty, deepest first.
+func pruneEmpty(m map[string]any, keys []string) {
+	for i := len(keys); i > 0; i-- {
+		v, ok := getPath(m, keys[:i])
+		if vm, isMap := v.(map[string]any); !ok || !isMap || len(vm) > 0 {
+			return
+		}
+		deletePath(m, keys[:i])
+	}
+}
@@ -0,0 +1,113 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package featuresets
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+)
+
+const (
+	// KeyUidStrategy selects the uid strategy of a Feature or HelmRelease.
+	// Templates set it as a comment, eg, "# aceshifter.appscode.com/uid-strategy: omit"
+	KeyUidStrategy = "aceshifter.appscode.com/uid-strategy"
+	// KeyUidOffset sets the offset from the start of the namespace uid range used by the offset strategy.
+	KeyUidOffset = "aceshifter.appscode.com/uid-offset"
+)
+
+// Strategy decides how the uid of the namespace range is rendered into the overlays.
+type Strategy string
+
+const (
+	// StrategyPin sets uids to the start of the namespace uid range.
+	StrategyPin Strategy = "pin"
+	// StrategyOmit renders null, so that chart defaults are cleared and
+	// OpenShift SCC admission picks the uids from the namespace range.
+	StrategyOmit Strategy = "omit"
+	// StrategyOffset sets uids to the start of the namespace uid range plus an offset,
+	// and assigns each component referenced by uidFor a distinct uid inside the range.
+	StrategyOffset Strategy = "offset"
+)
+
+var templateStrategyRE = regexp.MustCompile(`(?m)^#\s*` + regexp.QuoteMeta(KeyUidStrategy) + `:\s*(\S+)\s*$`)
+
+func ParseStrategy(s string) (Strategy, error) {
+	switch Strategy(s) {
+	case "", StrategyPin, StrategyOmit, StrategyOffset:
+		return Strategy(s), nil
+	}
+	return "", fmt.Errorf("unknown uid strategy %q, must be one of pin|omit|offset", s)
+}
+
+// ParseOffset parses the value of the KeyUidOffset annotation.
+func ParseOffset(s string) (int64, error) {
+	offset, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || offset < 0 {
+		return 0, fmt.Errorf("%s annotation value %q is not a non-negative integer", KeyUidOffset, s)
+	}
+	return offset, nil
+}
+
+func templateStrategy(data []byte) Strategy {
+	if m := templateStrategyRE.FindSubmatch(data); m != nil {
+		return Strategy(m[1])
+	}
+	return ""
+}
+
+// resolve returns the effective strategy and the uid to render, or nil for the omit strategy.
+func (opts Options) resolve(tplStrategy Strategy) (Strategy, any, error) {
+	strategy := opts.Strategy
+	if strategy == "" {
+		strategy = tplStrategy
+	}
+	if strategy == "" {
+		strategy = opts.DefaultStrategy
+	}
+
+	switch strategy {
+	case "", StrategyPin:
+		return StrategyPin, opts.UidStart, nil
+	case StrategyOmit:
+		return strategy, nil, nil
+	case StrategyOffset:
+		if opts.UidRange > 0 && opts.UidOffset >= opts.UidRange {
+			return strategy, nil, fmt.Errorf("uid offset %d is outside the namespace uid range %d/%d", opts.UidOffset, opts.UidStart, opts.UidRange)
+		}
+		return strategy, opts.UidStart + opts.UidOffset, nil
+	}
+	return strategy, nil, fmt.Errorf("unknown uid strategy %q", strategy)
+}
+
+// uidFor returns the uidFor template function. Only the offset strategy assigns
+// a distinct uid to each component, others render the same value as .uid
+func (opts Options) uidFor(strategy Strategy) func(key string) (any, error) {
+	var a *Allocator
+	if strategy == StrategyOffset {
+		a = NewAllocator(opts.UidStart, opts.UidRange, opts.UidStart, opts.UidStart+opts.UidOffset)
+	}
+	return func(key string) (any, error) {
+		switch strategy {
+		case StrategyOmit:
+			return "null", nil
+		case StrategyOffset:
+			return a.UidFor(key)
+		}
+		return opts.UidStart, nil
+	}
+}
@@ -0,0 +1,116 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package featuresets
+
+import (
+	"sort"
+	"strings"
+)
+
+// TLS is the TLS config rendered into the overlays of components that serve TLS.
+// Templates read it as {{ .tls }} and use the tlsConfig function. The config of
+// the ingress controllers is read as {{ .ingressTLS }} and uses the nginxTLSConfig
+// function.
+type TLS struct {
+	// MinVersion is the minimum TLS version, as VersionTLS1x.
+	MinVersion string
+	// CipherSuites are the IANA names of the allowed TLS 1.2 and older cipher suites.
+	CipherSuites []string
+	// Ciphers are the OpenSSL names of the allowed cipher suites.
+	Ciphers []string
+}
+
+// tlsKeys are the keys of the config tlsConfig renders.
+var tlsKeys = []string{"minVersion", "cipherSuites"}
+
+func (t *TLS) config() (string, error) {
+	cfg := map[string]any{}
+	if t != nil {
+		cfg["minVersion"] = t.MinVersion
+		cfg["cipherSuites"] = append([]string{}, t.CipherSuites...)
+	}
+	return toJSON(cfg)
+}
+
+// nginxProtocols are the ssl-protocols of ingress-nginx for a minimum TLS version.
+var nginxProtocols = map[string]string{
+	"VersionTLS10": "TLSv1 TLSv1.1 TLSv1.2 TLSv1.3",
+	"VersionTLS11": "TLSv1.1 TLSv1.2 TLSv1.3",
+	"VersionTLS12": "TLSv1.2 TLSv1.3",
+	"VersionTLS13": "TLSv1.3",
+}
+
+// nginxConfig returns the ingress-nginx controller config entries of the TLS config.
+// TLS 1.3 ciphers are not configurable in ingress-nginx and are left out.
+func (t *TLS) nginxConfig() (string, error) {
+	cfg := map[string]any{}
+	if t != nil {
+		cfg["ssl-protocols"] = nginxProtocols[t.MinVersion]
+		var ciphers []string
+		for _, c := range t.Ciphers {
+			if !strings.HasPrefix(c, "TLS_") {
+				ciphers = append(ciphers, c)
+			}
+		}
+		if len(ciphers) > 0 {
+			cfg["ssl-ciphers"] = strings.Join(ciphers, ":")
+		}
+	}
+	return toJSON(cfg)
+}
+
+// DropUndeclaredTLS removes the keys of the tls configs of an overlay that the chart
+// defaults do not declare at the same path, so that charts only get the TLS settings
+// they read. Without chart defaults, for example when they can't be fetched, every
+// tls key is removed and the overlay falls back to the one rendered without a TLS
+// profile. It returns the dotted paths of the removed keys.
+func DropUndeclaredTLS(overlay, defaults map[string]any) []string {
+	dropped := dropUndeclaredTLS(overlay, defaults, "")
+	sort.Strings(dropped)
+	return dropped
+}
+
+func dropUndeclaredTLS(overlay, defaults map[string]any, prefix string) []string {
+	var dropped []string
+	for k, v := range overlay {
+		m, ok := v.(map[string]any)
+		if !ok {
+			continue
+		}
+		def, _ := defaults[k].(map[string]any)
+		var d []string
+		if k == "tls" {
+			for _, key := range tlsKeys {
+				if _, ok := m[key]; !ok {
+					continue
+				}
+				if _, declared := def[key]; !declared {
+					delete(m, key)
+					d = append(d, prefix+k+"."+key)
+				}
+			}
+		} else {
+			d = dropUndeclaredTLS(m, def, prefix+k+".")
+		}
+		if len(d) > 0 && len(m) == 0 {
+			// nothing is left to set under the key
+			delete(overlay, k)
+		}
+		dropped = append(dropped, d...)
+	}
+	return dropped
+}
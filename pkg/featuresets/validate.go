@@ -0,0 +1,106 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package featuresets
+
+import (
+	"fmt"
+	"strconv"
+
+	"go.bytebuilders.dev/aceshifter/pkg/tracker"
+
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"sigs.k8s.io/yaml"
+)
+
+// Validate checks that every runAsUser, runAsGroup, fsGroup and supplementalGroups
+// value of a rendered overlay falls inside the ranges of the target namespace.
+// Null values are left to SCC admission and always pass.
+func Validate(data []byte, ranges tracker.Ranges) error {
+	var vals any
+	if err := yaml.Unmarshal(data, &vals); err != nil {
+		return fmt.Errorf("failed to parse overlay: %w", err)
+	}
+	return validate(vals, ranges)
+}
+
+// ValidateValues is Validate for parsed values.
+func ValidateValues(vals map[string]any, ranges tracker.Ranges) error {
+	return validate(vals, ranges)
+}
+
+func validate(vals any, ranges tracker.Ranges) error {
+	var errs []error
+	walkIDs(vals, "", func(path, field string, id int64) {
+		if field == "runAsUser" {
+			if !ranges.ContainsUid(id) {
+				errs = append(errs, fmt.Errorf("%s: uid %d is outside the namespace uid range %v", path, id, ranges.Uid))
+			}
+		} else if !ranges.ContainsGroup(id) {
+			errs = append(errs, fmt.Errorf("%s: gid %d is outside the namespace supplemental groups range %v", path, id, ranges.Groups))
+		}
+	})
+	return utilerrors.NewAggregate(errs)
+}
+
+func walkIDs(v any, path string, fn func(path, field string, id int64)) {
+	switch u := v.(type) {
+	case map[string]any:
+		for k, val := range u {
+			p := join(path, k)
+			switch k {
+			case "runAsUser", "runAsGroup", "fsGroup":
+				if id, ok := toID(val); ok {
+					fn(p, k, id)
+				}
+			case "supplementalGroups":
+				if ids, ok := val.([]any); ok {
+					for i, e := range ids {
+						if id, ok := toID(e); ok {
+							fn(p+"["+strconv.Itoa(i)+"]", k, id)
+						}
+					}
+				}
+			default:
+				walkIDs(val, p, fn)
+			}
+		}
+	case []any:
+		for i, e := range u {
+			walkIDs(e, path+"["+strconv.Itoa(i)+"]", fn)
+		}
+	}
+}
+
+func toID(v any) (int64, bool) {
+	switch u := v.(type) {
+	case float64:
+		return int64(u), true
+	case int64:
+		return u, true
+	case string:
+		id, err := strconv.ParseInt(u, 10, 64)
+		return id, err == nil
+	}
+	return 0, false
+}
+
+func join(prefix, key string) string {
+	if prefix == "" {
+		return key
+	}
+	return prefix + "." + key
+}
@@ -0,0 +1,72 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package featuresets
+
+import (
+	"testing"
+
+	"go.bytebuilders.dev/aceshifter/pkg/tracker"
+)
+
+func TestValidate(t *testing.T) {
+	uid, err := tracker.ParseRanges("1000/100")
+	if err != nil {
+		t.Fatal(err)
+	}
+	groups, err := tracker.ParseRanges("1000/100, 5000-5009")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ranges := tracker.Ranges{Uid: uid, Groups: groups}
+
+	tests := []struct {
+		name    string
+		overlay string
+		wantErr bool
+	}{
+		{
+			name:    "inside",
+			overlay: "a:\n  securityContext:\n    runAsUser: 1000\n    runAsGroup: 1099\n  podSecurityContext:\n    fsGroup: 5005\n    supplementalGroups: [1001, 5009]",
+		},
+		{
+			name:    "null",
+			overlay: "securityContext:\n  runAsUser: null",
+		},
+		{
+			name:    "uid outside",
+			overlay: "securityContext:\n  runAsUser: 65534",
+			wantErr: true,
+		},
+		{
+			name:    "group outside",
+			overlay: "podSecurityContext:\n  fsGroup: 5000\n  supplementalGroups: [5010]",
+			wantErr: true,
+		},
+		{
+			name:    "in list",
+			overlay: "sidecars:\n- securityContext:\n    runAsUser: 1100",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := Validate([]byte(tt.overlay), ranges); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
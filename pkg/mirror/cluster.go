@@ -0,0 +1,73 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mirror
+
+import (
+	"context"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+var (
+	ImageDigestMirrorSetGVK     = schema.GroupVersionKind{Group: "config.openshift.io", Version: "v1", Kind: "ImageDigestMirrorSet"}
+	ImageTagMirrorSetGVK        = schema.GroupVersionKind{Group: "config.openshift.io", Version: "v1", Kind: "ImageTagMirrorSet"}
+	ImageContentSourcePolicyGVK = schema.GroupVersionKind{Group: "operator.openshift.io", Version: "v1alpha1", Kind: "ImageContentSourcePolicy"}
+)
+
+var clusterMirrorSources = []struct {
+	gvk   schema.GroupVersionKind
+	field string
+}{
+	{ImageDigestMirrorSetGVK, "imageDigestMirrors"},
+	{ImageTagMirrorSetGVK, "imageTagMirrors"},
+	{ImageContentSourcePolicyGVK, "repositoryDigestMirrors"},
+}
+
+// LoadClusterRules reads the mirror rules of the OpenShift ImageDigestMirrorSets,
+// ImageTagMirrorSets and ImageContentSourcePolicies. The first mirror of each source
+// is used. APIs that are not installed are skipped.
+func LoadClusterRules(ctx context.Context, kc client.Reader) (Rules, error) {
+	var rules Rules
+	for _, src := range clusterMirrorSources {
+		var list unstructured.UnstructuredList
+		list.SetGroupVersionKind(src.gvk.GroupVersion().WithKind(src.gvk.Kind + "List"))
+		if err := kc.List(ctx, &list); err != nil {
+			if meta.IsNoMatchError(err) {
+				continue
+			}
+			return nil, err
+		}
+		for _, item := range list.Items {
+			entries, _, _ := unstructured.NestedSlice(item.Object, "spec", src.field)
+			for _, e := range entries {
+				entry, ok := e.(map[string]any)
+				if !ok {
+					continue
+				}
+				source, _, _ := unstructured.NestedString(entry, "source")
+				mirrors, _, _ := unstructured.NestedStringSlice(entry, "mirrors")
+				if source != "" && len(mirrors) > 0 {
+					rules = append(rules, Rule{Source: source, Mirror: mirrors[0]})
+				}
+			}
+		}
+	}
+	return Rules{}.Merge(rules), nil
+}
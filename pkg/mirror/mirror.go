@@ -0,0 +1,246 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mirror
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"go.bytebuilders.dev/aceshifter/pkg/featuresets"
+	"go.bytebuilders.dev/aceshifter/pkg/scaffold"
+)
+
+// Rule mirrors the images of a source repository, or of every repository below it.
+type Rule struct {
+	Source string
+	Mirror string
+}
+
+// Rules are applied longest source first.
+type Rules []Rule
+
+// ParseRules parses mirror rules given as <source>=<mirror>.
+func ParseRules(specs []string) (Rules, error) {
+	var rules Rules
+	for _, spec := range specs {
+		src, dst, ok := strings.Cut(spec, "=")
+		src, dst = strings.TrimSuffix(strings.TrimSpace(src), "/"), strings.TrimSuffix(strings.TrimSpace(dst), "/")
+		if !ok || src == "" || dst == "" {
+			return nil, fmt.Errorf("image mirror %q is not in <source>=<mirror> format", spec)
+		}
+		rules = append(rules, Rule{Source: src, Mirror: dst})
+	}
+	return rules.sorted(), nil
+}
+
+// Merge returns the rules of r followed by the rules of other for sources not
+// mirrored by r.
+func (r Rules) Merge(other Rules) Rules {
+	seen := map[string]bool{}
+	out := make(Rules, 0, len(r)+len(other))
+	for _, rule := range append(append(Rules{}, r...), other...) {
+		if !seen[rule.Source] {
+			seen[rule.Source] = true
+			out = append(out, rule)
+		}
+	}
+	return out.sorted()
+}
+
+func (r Rules) sorted() Rules {
+	sort.SliceStable(r, func(i, j int) bool {
+		return len(r[i].Source) > len(r[j].Source)
+	})
+	return r
+}
+
+// Rewrite returns the mirrored image reference. The reference may carry a tag or
+// digest. Images without a registry are treated as docker.io images.
+func (r Rules) Rewrite(ref string) (string, bool) {
+	ref = normalize(ref)
+	for _, rule := range r {
+		if !strings.HasPrefix(ref, rule.Source) {
+			continue
+		}
+		rest := ref[len(rule.Source):]
+		if rest == "" || strings.ContainsRune("/:@", rune(rest[0])) {
+			return rule.Mirror + rest, true
+		}
+	}
+	return "", false
+}
+
+func normalize(ref string) string {
+	domain, rest, ok := strings.Cut(ref, "/")
+	if ok && (strings.ContainsAny(domain, ".:") || domain == "localhost") {
+		return ref
+	}
+	if !ok {
+		rest = "library/" + ref
+	} else {
+		rest = ref
+	}
+	return "docker.io/" + rest
+}
+
+// keyRegistryFQDN holds the registry host of the images of AppsCode charts. Their
+// image registry values only hold the organization, the chart joins them as
+// registryFQDN/registry/repository.
+const keyRegistryFQDN = "registryFQDN"
+
+// Overlay returns the values that rewrite every image of a chart to its mirror.
+// Images are either strings under keys named image or ending in Image, or maps
+// with a repository and an optional registry. The registry of an image map is
+// prefixed with the registryFQDN of the values holding it, if any.
+func Overlay(values map[string]any, rules Rules) map[string]any {
+	if len(rules) == 0 {
+		return map[string]any{}
+	}
+	return imagesOverlay(values, rules, "")
+}
+
+func imagesOverlay(values map[string]any, rules Rules, fqdn string) map[string]any {
+	if v, _ := values[keyRegistryFQDN].(string); v != "" {
+		return fqdnOverlay(values, rules, v)
+	}
+	out, _ := rewriteImages(values, rules, fqdn)
+	return out
+}
+
+// fqdnOverlay rewrites the images of values that set registryFQDN. The mirror of an
+// image may not share the registry host of the other images, so once an image
+// relative to registryFQDN is mirrored, registryFQDN is cleared and every relative
+// image gets its full registry.
+func fqdnOverlay(values map[string]any, rules Rules, fqdn string) map[string]any {
+	out, relative := rewriteImages(values, rules, fqdn)
+	if relative {
+		out[keyRegistryFQDN] = ""
+		pinRegistries(values, out, fqdn)
+	}
+	return out
+}
+
+// rewriteImages returns the values that rewrite the images of values and whether an
+// image relative to fqdn was rewritten.
+func rewriteImages(values map[string]any, rules Rules, fqdn string) (map[string]any, bool) {
+	out := map[string]any{}
+	relative := false
+	for k, v := range values {
+		switch u := v.(type) {
+		case map[string]any:
+			if img, rel := rewriteImage(u, rules, fqdn); img != nil {
+				out[k] = img
+				relative = relative || rel
+			} else if v, _ := u[keyRegistryFQDN].(string); v != "" {
+				if sub := fqdnOverlay(u, rules, v); len(sub) > 0 {
+					out[k] = sub
+				}
+			} else if sub, rel := rewriteImages(u, rules, fqdn); len(sub) > 0 {
+				out[k] = sub
+				relative = relative || rel
+			}
+		case string:
+			if k == "image" || strings.HasSuffix(k, "Image") {
+				if ref, ok := rules.Rewrite(u); ok && ref != u {
+					out[k] = ref
+				}
+			}
+		}
+	}
+	return out, relative
+}
+
+// pinRegistries sets the full registry of the images of values relative to fqdn
+// that out does not rewrite.
+func pinRegistries(values, out map[string]any, fqdn string) {
+	for k, v := range values {
+		u, ok := v.(map[string]any)
+		if !ok {
+			continue
+		}
+		if v, _ := u[keyRegistryFQDN].(string); v != "" {
+			continue
+		}
+		sub, _ := out[k].(map[string]any)
+		if sub == nil {
+			sub = map[string]any{}
+		}
+		if relativeImage(u, fqdn) {
+			if _, ok := sub["registry"]; !ok {
+				sub["registry"] = fqdn + "/" + u["registry"].(string)
+			}
+		} else {
+			pinRegistries(u, sub, fqdn)
+		}
+		if len(sub) > 0 {
+			out[k] = sub
+		}
+	}
+}
+
+// relativeImage returns true if m is an image map whose registry is an organization
+// below fqdn.
+func relativeImage(m map[string]any, fqdn string) bool {
+	repository, _ := m["repository"].(string)
+	registry, _ := m["registry"].(string)
+	return fqdn != "" && repository != "" && registry != "" &&
+		!strings.ContainsAny(registry, ".:") && registry != "localhost"
+}
+
+// rewriteImage returns the changed registry and repository values of an image map,
+// or nil if m is not an image or is not mirrored. It also returns whether the image
+// is relative to fqdn.
+func rewriteImage(m map[string]any, rules Rules, fqdn string) (map[string]any, bool) {
+	repository, ok := m["repository"].(string)
+	if !ok || repository == "" {
+		return nil, false
+	}
+	registry, hasRegistry := m["registry"].(string)
+	if !hasRegistry || registry == "" {
+		ref, ok := rules.Rewrite(repository)
+		if !ok || ref == repository {
+			return nil, false
+		}
+		return map[string]any{"repository": ref}, false
+	}
+
+	relative := relativeImage(m, fqdn)
+	if relative {
+		registry = fqdn + "/" + registry
+	}
+	ref, ok := rules.Rewrite(registry + "/" + repository)
+	if !ok || ref == registry+"/"+repository {
+		return nil, false
+	}
+	if newRegistry, ok := strings.CutSuffix(ref, "/"+repository); ok {
+		return map[string]any{"registry": newRegistry}, relative
+	}
+	newRegistry, newRepository, _ := strings.Cut(ref, "/")
+	return map[string]any{"registry": newRegistry, "repository": newRepository}, relative
+}
+
+// ChartValues returns the default values of a chart coalesced with the default
+// values of its subcharts, the way helm does.
+func ChartValues(c *scaffold.Chart) map[string]any {
+	values := featuresets.MergeValues(map[string]any{}, c.Values)
+	for name, sub := range c.Subcharts {
+		parent, _ := values[name].(map[string]any)
+		values[name] = featuresets.MergeValues(ChartValues(sub), parent)
+	}
+	return values
+}
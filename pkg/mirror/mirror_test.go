@@ -0,0 +1,152 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mirror
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseRules(t *testing.T) {
+	rules, err := ParseRules([]string{"ghcr.io=mirror.local/ghcr", " ghcr.io/appscode/ = mirror.local/appscode/ "})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := Rules{
+		{Source: "ghcr.io/appscode", Mirror: "mirror.local/appscode"},
+		{Source: "ghcr.io", Mirror: "mirror.local/ghcr"},
+	}
+	if !reflect.DeepEqual(rules, expected) {
+		t.Errorf("expected %v, got %v", expected, rules)
+	}
+
+	for _, spec := range []string{"ghcr.io", "=mirror.local", "ghcr.io="} {
+		if _, err := ParseRules([]string{spec}); err == nil {
+			t.Errorf("expected an error for %q", spec)
+		}
+	}
+}
+
+func TestRewrite(t *testing.T) {
+	rules, err := ParseRules([]string{
+		"ghcr.io=mirror.local/ghcr",
+		"ghcr.io/appscode=mirror.local/appscode",
+		"docker.io=mirror.local/docker",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := map[string]string{
+		"ghcr.io/appscode/kubedb:v1":        "mirror.local/appscode/kubedb:v1",
+		"ghcr.io/appscode-images/redis:7":   "mirror.local/ghcr/appscode-images/redis:7",
+		"ghcr.io/fluxcd/source@sha256:abcd": "mirror.local/ghcr/fluxcd/source@sha256:abcd",
+		"busybox:1.36":                      "mirror.local/docker/library/busybox:1.36",
+		"appscode/kubectl":                  "mirror.local/docker/appscode/kubectl",
+		"quay.io/prometheus/prometheus":     "",
+	}
+	for ref, expected := range cases {
+		got, ok := rules.Rewrite(ref)
+		if ok != (expected != "") || got != expected {
+			t.Errorf("%s: expected %q, got %q", ref, expected, got)
+		}
+	}
+}
+
+func TestMerge(t *testing.T) {
+	flags := Rules{{Source: "ghcr.io", Mirror: "flag.local"}}
+	cluster := Rules{{Source: "ghcr.io", Mirror: "cluster.local"}, {Source: "ghcr.io/appscode", Mirror: "cluster.local/appscode"}}
+	expected := Rules{
+		{Source: "ghcr.io/appscode", Mirror: "cluster.local/appscode"},
+		{Source: "ghcr.io", Mirror: "flag.local"},
+	}
+	if got := flags.Merge(cluster); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+}
+
+func TestOverlay(t *testing.T) {
+	rules, err := ParseRules([]string{"ghcr.io=mirror.local/ghcr", "docker.io=mirror.local/docker"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	values := map[string]any{
+		"image": map[string]any{
+			"registry":   "ghcr.io",
+			"repository": "appscode/kubedb",
+			"tag":        "v1",
+		},
+		"operator": map[string]any{
+			"image": map[string]any{"repository": "ghcr.io/appscode/operator"},
+		},
+		"initImage": "busybox",
+		"cleaner": map[string]any{
+			"image": "quay.io/appscode/cleaner",
+		},
+		"replicaCount": 1,
+	}
+	expected := map[string]any{
+		"image": map[string]any{"registry": "mirror.local/ghcr"},
+		"operator": map[string]any{
+			"image": map[string]any{"repository": "mirror.local/ghcr/appscode/operator"},
+		},
+		"initImage": "mirror.local/docker/library/busybox",
+	}
+	if got := Overlay(values, rules); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+}
+
+func TestOverlayRegistryFQDN(t *testing.T) {
+	rules, err := ParseRules([]string{"ghcr.io/appscode=mirror.local/appscode"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	values := map[string]any{
+		"registryFQDN": "ghcr.io",
+		"operator": map[string]any{
+			"registry":   "appscode",
+			"repository": "kubedb-provisioner",
+		},
+		"cleaner": map[string]any{
+			"registry":   "kubedb",
+			"repository": "cleaner",
+		},
+		"monitoring": map[string]any{
+			"exporter": map[string]any{"registry": "prom", "repository": "exporter"},
+		},
+	}
+	expected := map[string]any{
+		"registryFQDN": "",
+		"operator":     map[string]any{"registry": "mirror.local/appscode"},
+		"cleaner":      map[string]any{"registry": "ghcr.io/kubedb"},
+		"monitoring": map[string]any{
+			"exporter": map[string]any{"registry": "ghcr.io/prom"},
+		},
+	}
+	if got := Overlay(values, rules); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+
+	// nothing below registryFQDN is mirrored
+	rules, err = ParseRules([]string{"quay.io=mirror.local/quay"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := Overlay(values, rules); len(got) != 0 {
+		t.Errorf("expected no overlay, got %v", got)
+	}
+}
@@ -0,0 +1,186 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scaffold
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+)
+
+// Chart is the subset of a helm chart needed to discover its security context values.
+type Chart struct {
+	Name      string
+	Values    map[string]any
+	Templates map[string][]byte
+	// Subcharts are keyed by the name (or alias) used in the parent chart values.
+	Subcharts map[string]*Chart
+}
+
+type chartMetadata struct {
+	Name         string `json:"name"`
+	Dependencies []struct {
+		Name  string `json:"name"`
+		Alias string `json:"alias,omitempty"`
+	} `json:"dependencies,omitempty"`
+}
+
+// LoadChart loads a chart from a directory or a .tgz archive.
+func LoadChart(src string) (*Chart, error) {
+	fi, err := os.Stat(src)
+	if err != nil {
+		return nil, err
+	}
+	if fi.IsDir() {
+		files := map[string][]byte{}
+		err = filepath.WalkDir(src, func(p string, d os.DirEntry, err error) error {
+			if err != nil || d.IsDir() {
+				return err
+			}
+			rel, err := filepath.Rel(src, p)
+			if err != nil {
+				return err
+			}
+			data, err := os.ReadFile(p)
+			if err != nil {
+				return err
+			}
+			files[filepath.ToSlash(rel)] = data
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		return loadFiles(files)
+	}
+
+	data, err := os.ReadFile(src)
+	if err != nil {
+		return nil, err
+	}
+	return loadArchive(data)
+}
+
+// LoadChartArchive loads a chart from the data of a .tgz archive.
+func LoadChartArchive(data []byte) (*Chart, error) {
+	return loadArchive(data)
+}
+
+func loadArchive(data []byte) (*Chart, error) {
+	gz, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer gz.Close() // nolint:errcheck
+
+	files := map[string][]byte{}
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		// chart archives contain a single top level directory named after the chart
+		_, name, ok := strings.Cut(path.Clean(hdr.Name), "/")
+		if !ok {
+			continue
+		}
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			return nil, err
+		}
+		files[name] = data
+	}
+	return loadFiles(files)
+}
+
+func loadFiles(files map[string][]byte) (*Chart, error) {
+	data, ok := files["Chart.yaml"]
+	if !ok {
+		return nil, fmt.Errorf("Chart.yaml not found")
+	}
+	var meta chartMetadata
+	if err := yaml.Unmarshal(data, &meta); err != nil {
+		return nil, fmt.Errorf("failed to parse Chart.yaml: %w", err)
+	}
+
+	chart := Chart{
+		Name:      meta.Name,
+		Values:    map[string]any{},
+		Templates: map[string][]byte{},
+		Subcharts: map[string]*Chart{},
+	}
+	if data, ok := files["values.yaml"]; ok {
+		if err := yaml.Unmarshal(data, &chart.Values); err != nil {
+			return nil, fmt.Errorf("failed to parse values.yaml of chart %s: %w", meta.Name, err)
+		}
+		if chart.Values == nil {
+			chart.Values = map[string]any{}
+		}
+	}
+
+	subFiles := map[string]map[string][]byte{}
+	for name, data := range files {
+		switch {
+		case strings.HasPrefix(name, "templates/"):
+			chart.Templates[name] = data
+		case strings.HasPrefix(name, "charts/"):
+			rest := strings.TrimPrefix(name, "charts/")
+			if dir, file, ok := strings.Cut(rest, "/"); ok {
+				if subFiles[dir] == nil {
+					subFiles[dir] = map[string][]byte{}
+				}
+				subFiles[dir][file] = data
+			} else if strings.HasSuffix(rest, ".tgz") {
+				sub, err := loadArchive(data)
+				if err != nil {
+					return nil, fmt.Errorf("failed to load subchart %s: %w", rest, err)
+				}
+				chart.Subcharts[sub.Name] = sub
+			}
+		}
+	}
+	for dir, files := range subFiles {
+		sub, err := loadFiles(files)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load subchart %s: %w", dir, err)
+		}
+		chart.Subcharts[sub.Name] = sub
+	}
+
+	for _, dep := range meta.Dependencies {
+		if sub, ok := chart.Subcharts[dep.Name]; ok && dep.Alias != "" {
+			delete(chart.Subcharts, dep.Name)
+			chart.Subcharts[dep.Alias] = sub
+		}
+	}
+	return &chart, nil
+}
@@ -0,0 +1,92 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scaffold
+
+import (
+	"regexp"
+	"strings"
+
+	"go.bytebuilders.dev/aceshifter/pkg/featuresets"
+)
+
+var valuesRef = regexp.MustCompile(`\.Values\.((?:[A-Za-z0-9_]+\.)*[A-Za-z0-9_]*[Ss]ecurity[Cc]ontext)\b`)
+
+// Discover finds the security context values paths of a chart and its subcharts.
+// Paths are taken from the default values and from .Values references in templates.
+func Discover(chart *Chart) featuresets.Entry {
+	entry := featuresets.Entry{}
+	discover(chart, "", entry)
+	return entry
+}
+
+func discover(chart *Chart, prefix string, entry featuresets.Entry) {
+	walkValues(chart.Values, prefix, entry)
+
+	for _, data := range chart.Templates {
+		for _, m := range valuesRef.FindAllSubmatch(data, -1) {
+			p := join(prefix, string(m[1]))
+			if _, ok := entry[p]; !ok {
+				keys := strings.Split(string(m[1]), ".")
+				entry[p] = fieldsFor(keys[len(keys)-1], nil)
+			}
+		}
+	}
+
+	for key, sub := range chart.Subcharts {
+		discover(sub, join(prefix, key), entry)
+	}
+}
+
+func walkValues(values map[string]any, prefix string, entry featuresets.Entry) {
+	for k, v := range values {
+		p := join(prefix, k)
+		m, _ := v.(map[string]any)
+		if isSecurityContext(k) && (v == nil || m != nil) {
+			entry[p] = fieldsFor(k, m)
+			continue
+		}
+		if m != nil {
+			walkValues(m, p, entry)
+		}
+	}
+}
+
+func isSecurityContext(key string) bool {
+	return strings.HasSuffix(strings.ToLower(key), "securitycontext")
+}
+
+func fieldsFor(key string, defaults map[string]any) []featuresets.Field {
+	if strings.Contains(strings.ToLower(key), "pod") {
+		return []featuresets.Field{featuresets.FieldPod}
+	}
+	fields := []featuresets.Field{featuresets.FieldContainer}
+	if _, ok := defaults["runAsGroup"]; ok {
+		fields = append(fields, featuresets.FieldRunAsGroup)
+	}
+	// some charts use securityContext for the pod level security context
+	if _, ok := defaults["fsGroup"]; ok {
+		fields = append(fields, featuresets.FieldFsGroup)
+	}
+	return fields
+}
+
+func join(prefix, key string) string {
+	if prefix == "" {
+		return key
+	}
+	return prefix + "." + key
+}
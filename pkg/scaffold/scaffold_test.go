@@ -0,0 +1,90 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scaffold
+
+import (
+	"reflect"
+	"testing"
+
+	"go.bytebuilders.dev/aceshifter/pkg/featuresets"
+)
+
+func TestDiscover(t *testing.T) {
+	chart, err := loadFiles(map[string][]byte{
+		"Chart.yaml": []byte(`name: parent
+dependencies:
+- name: nats
+  alias: queue
+`),
+		"values.yaml": []byte(`podSecurityContext: {}
+securityContext:
+  runAsGroup: 65534
+operator:
+  securityContext:
+    fsGroup: 65534
+  disableSecurityContext: true
+`),
+		"templates/deployment.yaml": []byte(`securityContext:
+  {{- toYaml .Values.podSecurityContext | nindent 8 }}
+containers:
+- securityContext: {{ toYaml .Values.webhook.securityContext | nindent 12 }}
+  env: {{ .Values.webhook.securityContextEnabled }}
+  image: {{ .Values.image.repository }}
+`),
+		"charts/nats/Chart.yaml":                 []byte("name: nats\n"),
+		"charts/nats/values.yaml":                []byte("nats: {}\n"),
+		"charts/nats/templates/statefulset.yaml": []byte("{{ .Values.nats.containerSecurityContext }}\n"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := featuresets.Entry{
+		"podSecurityContext":                  {featuresets.FieldPod},
+		"securityContext":                     {featuresets.FieldContainer, featuresets.FieldRunAsGroup},
+		"operator.securityContext":            {featuresets.FieldContainer, featuresets.FieldFsGroup},
+		"webhook.securityContext":             {featuresets.FieldContainer},
+		"queue.nats.containerSecurityContext": {featuresets.FieldContainer},
+	}
+	if got := Discover(chart); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+}
+
+func TestValuesRef(t *testing.T) {
+	tests := []struct {
+		text string
+		path string
+	}{
+		{"{{ .Values.securityContext }}", "securityContext"},
+		{"{{ .Values.a.b_c.podSecurityContext | toYaml }}", "a.b_c.podSecurityContext"},
+		{"{{ .Values.nats.SecurityContext }}", "nats.SecurityContext"},
+		{"{{ .Values.securityContextEnabled }}", ""},
+		{"{{ .Values.securityContext.runAsUser }}", "securityContext"},
+		{"{{ .Values.image.tag }}", ""},
+	}
+	for _, tt := range tests {
+		m := valuesRef.FindStringSubmatch(tt.text)
+		var got string
+		if m != nil {
+			got = m[1]
+		}
+		if got != tt.path {
+			t.Errorf("%s: expected %q, got %q", tt.text, tt.path, got)
+		}
+	}
+}
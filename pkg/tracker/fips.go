@@ -0,0 +1,63 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tracker
+
+import (
+	"context"
+	"fmt"
+
+	core "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// ClusterConfigName is the ConfigMap that holds the install-config of an
+	// OpenShift cluster.
+	ClusterConfigName      = "cluster-config-v1"
+	ClusterConfigNamespace = "kube-system"
+
+	// LabelFIPSNode marks nodes booted in FIPS mode. It is set to "true" by a
+	// NodeFeatureRule that reads /proc/sys/crypto/fips_enabled.
+	LabelFIPSNode = "feature.node.kubernetes.io/fips-enabled"
+)
+
+// FIPSEnabled returns true if the cluster was installed in FIPS mode, or if any
+// node reports that it runs in FIPS mode.
+func FIPSEnabled(ctx context.Context, kc client.Reader) (bool, error) {
+	var cm core.ConfigMap
+	err := kc.Get(ctx, client.ObjectKey{Namespace: ClusterConfigNamespace, Name: ClusterConfigName}, &cm)
+	if client.IgnoreNotFound(err) != nil {
+		return false, err
+	} else if err == nil {
+		var cfg struct {
+			FIPS bool `json:"fips"`
+		}
+		if err := yaml.Unmarshal([]byte(cm.Data["install-config"]), &cfg); err != nil {
+			return false, fmt.Errorf("failed to parse %s/%s: %w", ClusterConfigNamespace, ClusterConfigName, err)
+		}
+		if cfg.FIPS {
+			return true, nil
+		}
+	}
+
+	var nodes core.NodeList
+	if err := kc.List(ctx, &nodes, client.MatchingLabels{LabelFIPSNode: "true"}, client.Limit(1)); err != nil {
+		return false, err
+	}
+	return len(nodes.Items) > 0, nil
+}
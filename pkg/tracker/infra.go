@@ -0,0 +1,37 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tracker
+
+import (
+	"context"
+
+	core "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// LabelInfraNode is the node role of OpenShift infra nodes. Infra nodes are usually
+// tainted with the same key.
+const LabelInfraNode = "node-role.kubernetes.io/infra"
+
+// InfraNodesExist returns true if any node has the infra node role.
+func InfraNodesExist(ctx context.Context, kc client.Reader) (bool, error) {
+	var list core.NodeList
+	if err := kc.List(ctx, &list, client.HasLabels{LabelInfraNode}, client.Limit(1)); err != nil {
+		return false, err
+	}
+	return len(list.Items) > 0, nil
+}
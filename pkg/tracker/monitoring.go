@@ -0,0 +1,57 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tracker
+
+import (
+	"context"
+	"fmt"
+
+	core "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// ClusterMonitoringConfigName is the ConfigMap that configures the OpenShift
+	// monitoring stack.
+	ClusterMonitoringConfigName      = "cluster-monitoring-config"
+	ClusterMonitoringConfigNamespace = "openshift-monitoring"
+
+	// LabelUserMonitoring opts a namespace in or out of user-workload monitoring.
+	LabelUserMonitoring = "openshift.io/user-monitoring"
+
+	// ClusterMonitoringViewRole lets service accounts query the Thanos Querier.
+	ClusterMonitoringViewRole = "cluster-monitoring-view"
+)
+
+// UserWorkloadMonitoringEnabled returns true if the OpenShift user-workload
+// monitoring stack is enabled in the cluster monitoring config.
+func UserWorkloadMonitoringEnabled(ctx context.Context, kc client.Reader) (bool, error) {
+	var cm core.ConfigMap
+	err := kc.Get(ctx, client.ObjectKey{Namespace: ClusterMonitoringConfigNamespace, Name: ClusterMonitoringConfigName}, &cm)
+	if err != nil {
+		return false, client.IgnoreNotFound(err)
+	}
+
+	var cfg struct {
+		EnableUserWorkload bool `json:"enableUserWorkload"`
+	}
+	if err := yaml.Unmarshal([]byte(cm.Data["config.yaml"]), &cfg); err != nil {
+		return false, fmt.Errorf("failed to parse %s/%s: %w", ClusterMonitoringConfigNamespace, ClusterMonitoringConfigName, err)
+	}
+	return cfg.EnableUserWorkload, nil
+}
@@ -0,0 +1,77 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tracker
+
+import (
+	"context"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// ClusterProxyName is the cluster-wide egress proxy config of OpenShift.
+	ClusterProxyName = "cluster"
+
+	// TrustedCABundleName is the ConfigMap created in each target namespace that the
+	// OpenShift cluster network operator injects the trusted CA bundle into.
+	TrustedCABundleName = "ace-trusted-ca-bundle"
+	// TrustedCABundleKey is the key of the injected CA bundle.
+	TrustedCABundleKey = "ca-bundle.crt"
+	// LabelInjectTrustedCABundle asks the cluster network operator to inject the
+	// trusted CA bundle into a ConfigMap.
+	LabelInjectTrustedCABundle = "config.openshift.io/inject-trusted-cabundle"
+)
+
+var ProxyGVK = schema.GroupVersionKind{Group: "config.openshift.io", Version: "v1", Kind: "Proxy"}
+
+// ClusterProxy is the effective cluster-wide egress proxy config.
+type ClusterProxy struct {
+	HTTPProxy  string
+	HTTPSProxy string
+	NoProxy    string
+	// TrustedCA is the ConfigMap in openshift-config with additional trusted CAs.
+	TrustedCA string
+}
+
+// IsZero returns true if neither a proxy nor additional trusted CAs are configured.
+func (p ClusterProxy) IsZero() bool {
+	return p == ClusterProxy{}
+}
+
+// GetClusterProxy reads the cluster-wide proxy config. The effective values from
+// its status are used, since the status also lists the cluster networks in noProxy.
+// It returns nil on clusters without the OpenShift config API.
+func GetClusterProxy(ctx context.Context, kc client.Reader) (*ClusterProxy, error) {
+	var u unstructured.Unstructured
+	u.SetGroupVersionKind(ProxyGVK)
+	if err := kc.Get(ctx, client.ObjectKey{Name: ClusterProxyName}, &u); err != nil {
+		if meta.IsNoMatchError(err) {
+			return nil, nil
+		}
+		return nil, client.IgnoreNotFound(err)
+	}
+
+	var p ClusterProxy
+	p.HTTPProxy, _, _ = unstructured.NestedString(u.Object, "status", "httpProxy")
+	p.HTTPSProxy, _, _ = unstructured.NestedString(u.Object, "status", "httpsProxy")
+	p.NoProxy, _, _ = unstructured.NestedString(u.Object, "status", "noProxy")
+	p.TrustedCA, _, _ = unstructured.NestedString(u.Object, "spec", "trustedCA", "name")
+	return &p, nil
+}
@@ -0,0 +1,108 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tracker
+
+import (
+	"context"
+	"fmt"
+
+	core "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+const (
+	// RegistryName is the ConfigMap that records the uid range of each namespace,
+	// keyed by namespace name. Copy it to another cluster before a restore to
+	// pre-seed the ranges of the restored namespaces.
+	RegistryName      = "ace-openshift-uid-ranges"
+	RegistryNamespace = "kubeops"
+
+	// KeyPinnedFor is set on a namespace to its metadata uid once its uid range is
+	// recorded or restored. A recreated or restored namespace has a new metadata uid,
+	// which tells it apart from a namespace whose range was changed on purpose.
+	KeyPinnedFor = "aceshifter.appscode.com/uid-range-pinned-for"
+)
+
+// Registry is a durable record of namespace uid ranges that outlives the namespaces.
+type Registry struct {
+	client.Client
+}
+
+func (r Registry) Get(ctx context.Context, ns string) (string, bool, error) {
+	var cm core.ConfigMap
+	err := r.Client.Get(ctx, client.ObjectKey{Namespace: RegistryNamespace, Name: RegistryName}, &cm)
+	if err != nil {
+		return "", false, client.IgnoreNotFound(err)
+	}
+	v, ok := cm.Data[ns]
+	return v, ok, nil
+}
+
+// Record stores the uid range of a namespace, replacing the recorded one.
+func (r Registry) Record(ctx context.Context, ns, uidRange string) error {
+	if _, err := ParseRanges(uidRange); err != nil {
+		return fmt.Errorf("can't record uid range of namespace %s: %w", ns, err)
+	}
+
+	cm := core.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      RegistryName,
+			Namespace: RegistryNamespace,
+		},
+	}
+	_, err := controllerutil.CreateOrPatch(ctx, r.Client, &cm, func() error {
+		if cm.Data == nil {
+			cm.Data = map[string]string{}
+		}
+		cm.Data[ns] = uidRange
+		return nil
+	})
+	return err
+}
+
+// List returns the recorded uid ranges keyed by namespace name.
+func (r Registry) List(ctx context.Context) (map[string]string, error) {
+	var cm core.ConfigMap
+	err := r.Client.Get(ctx, client.ObjectKey{Namespace: RegistryNamespace, Name: RegistryName}, &cm)
+	if err != nil {
+		return nil, client.IgnoreNotFound(err)
+	}
+	return cm.Data, nil
+}
+
+// Forget removes the recorded uid ranges of namespaces.
+func (r Registry) Forget(ctx context.Context, namespaces ...string) error {
+	var cm core.ConfigMap
+	err := r.Client.Get(ctx, client.ObjectKey{Namespace: RegistryNamespace, Name: RegistryName}, &cm)
+	if err != nil {
+		return client.IgnoreNotFound(err)
+	}
+	patch := client.MergeFrom(cm.DeepCopy())
+	changed := false
+	for _, ns := range namespaces {
+		if _, ok := cm.Data[ns]; ok {
+			delete(cm.Data, ns)
+			changed = true
+		}
+	}
+	if !changed {
+		return nil
+	}
+	return r.Client.Patch(ctx, &cm, patch)
+}
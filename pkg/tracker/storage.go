@@ -0,0 +1,101 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tracker
+
+import (
+	"context"
+	"fmt"
+
+	storage "k8s.io/api/storage/v1"
+	"k8s.io/apimachinery/pkg/util/version"
+	"k8s.io/client-go/discovery"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// KeyDefaultStorageClass marks the default StorageClass of a cluster.
+	KeyDefaultStorageClass = "storageclass.kubernetes.io/is-default-class"
+	// KeyBetaDefaultStorageClass is the deprecated beta annotation, still set by
+	// some storage operators.
+	KeyBetaDefaultStorageClass = "storageclass.beta.kubernetes.io/is-default-class"
+)
+
+// DefaultStorage is the default StorageClass of a cluster and the CSI driver that
+// provisions it.
+type DefaultStorage struct {
+	ClassName   string
+	Provisioner string
+	// Driver is nil for in-tree provisioners and CSI drivers without a CSIDriver object.
+	Driver *storage.CSIDriver
+}
+
+// GetDefaultStorage returns the default StorageClass of the cluster, or nil if none
+// is set. If more than one is marked as default, the most recently created one wins,
+// as in the DefaultStorageClass admission plugin.
+func GetDefaultStorage(ctx context.Context, kc client.Reader) (*DefaultStorage, error) {
+	var list storage.StorageClassList
+	if err := kc.List(ctx, &list); err != nil {
+		return nil, err
+	}
+	var class *storage.StorageClass
+	for i := range list.Items {
+		sc := &list.Items[i]
+		if sc.Annotations[KeyDefaultStorageClass] != "true" && sc.Annotations[KeyBetaDefaultStorageClass] != "true" {
+			continue
+		}
+		if class == nil || sc.CreationTimestamp.After(class.CreationTimestamp.Time) ||
+			(sc.CreationTimestamp.Equal(&class.CreationTimestamp) && sc.Name < class.Name) {
+			class = sc
+		}
+	}
+	if class == nil {
+		return nil, nil
+	}
+
+	out := &DefaultStorage{ClassName: class.Name, Provisioner: class.Provisioner}
+	var driver storage.CSIDriver
+	if err := kc.Get(ctx, client.ObjectKey{Name: class.Provisioner}, &driver); err == nil {
+		out.Driver = &driver
+	} else if client.IgnoreNotFound(err) != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// SELinuxMount returns true if the CSI driver mounts volumes with the SELinux
+// context of the pod, so that they need not be relabeled recursively.
+func (s *DefaultStorage) SELinuxMount() bool {
+	return s.Driver != nil && s.Driver.Spec.SELinuxMount != nil && *s.Driver.Spec.SELinuxMount
+}
+
+// seLinuxChangePolicyVersion is the first Kubernetes version that serves the
+// seLinuxChangePolicy field of pod security contexts by default.
+var seLinuxChangePolicyVersion = version.MajorMinor(1, 33)
+
+// SupportsSELinuxChangePolicy returns true if the API server keeps the
+// seLinuxChangePolicy field of pod security contexts. Older servers drop it.
+func SupportsSELinuxChangePolicy(dc discovery.ServerVersionInterface) (bool, error) {
+	info, err := dc.ServerVersion()
+	if err != nil {
+		return false, err
+	}
+	v, err := version.ParseGeneric(info.GitVersion)
+	if err != nil {
+		return false, fmt.Errorf("failed to parse the server version %q: %w", info.GitVersion, err)
+	}
+	return v.AtLeast(seLinuxChangePolicyVersion), nil
+}
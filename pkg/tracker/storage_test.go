@@ -0,0 +1,50 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tracker
+
+import (
+	"testing"
+
+	"k8s.io/apimachinery/pkg/version"
+)
+
+type serverVersion string
+
+func (v serverVersion) ServerVersion() (*version.Info, error) {
+	return &version.Info{GitVersion: string(v)}, nil
+}
+
+func TestSupportsSELinuxChangePolicy(t *testing.T) {
+	for v, want := range map[string]bool{
+		"v1.31.6":          false,
+		"v1.32.5":          false,
+		"v1.33.2":          true,
+		"v1.33.4+3c5b0c4e": true,
+		"v1.34.0":          true,
+	} {
+		got, err := SupportsSELinuxChangePolicy(serverVersion(v))
+		if err != nil {
+			t.Fatalf("%s: %v", v, err)
+		}
+		if got != want {
+			t.Errorf("%s: got %v, want %v", v, got, want)
+		}
+	}
+	if _, err := SupportsSELinuxChangePolicy(serverVersion("unknown")); err == nil {
+		t.Error("expected an error for an unparsable version")
+	}
+}
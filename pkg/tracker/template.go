@@ -0,0 +1,101 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tracker
+
+import (
+	"fmt"
+	"os"
+
+	core "k8s.io/api/core/v1"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	LabelManagedBy = "app.kubernetes.io/managed-by"
+	ManagedBy      = "aceshifter"
+)
+
+// NamespaceTemplate configures the namespaces aceshifter creates for HelmRelease target namespaces.
+//
+//	labels:
+//	  pod-security.kubernetes.io/enforce: restricted
+//	annotations:
+//	  openshift.io/node-selector: ""
+//	ranges:
+//	  kubeops: 1000680000/10000
+type NamespaceTemplate struct {
+	Labels      map[string]string `json:"labels,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+	// Ranges pre-seeds the uid and supplemental group range annotations of the
+	// listed namespaces, in <start>/<size> or <start>-<end> format.
+	Ranges map[string]string `json:"ranges,omitempty"`
+}
+
+func DefaultNamespaceTemplate() *NamespaceTemplate {
+	return &NamespaceTemplate{
+		Labels: map[string]string{
+			LabelManagedBy: ManagedBy,
+		},
+	}
+}
+
+func LoadNamespaceTemplate(filename string) (*NamespaceTemplate, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	var t NamespaceTemplate
+	if err := yaml.UnmarshalStrict(data, &t); err != nil {
+		return nil, fmt.Errorf("failed to parse namespace template %s: %w", filename, err)
+	}
+	for ns, r := range t.Ranges {
+		ranges, err := ParseRanges(r)
+		if err != nil || len(ranges) != 1 {
+			return nil, fmt.Errorf("range %q of namespace %s is not a single range in <start>/<size> or <start>-<end> format", r, ns)
+		}
+		// the namespace annotations only accept <start>/<size>
+		t.Ranges[ns] = ranges[0].String()
+	}
+	if t.Labels == nil {
+		t.Labels = map[string]string{}
+	}
+	if _, ok := t.Labels[LabelManagedBy]; !ok {
+		t.Labels[LabelManagedBy] = ManagedBy
+	}
+	return &t, nil
+}
+
+// Apply sets the labels and annotations of the template on a namespace.
+func (t *NamespaceTemplate) Apply(ns *core.Namespace) {
+	if len(t.Labels) > 0 && ns.Labels == nil {
+		ns.Labels = map[string]string{}
+	}
+	for k, v := range t.Labels {
+		ns.Labels[k] = v
+	}
+	r, pinned := t.Ranges[ns.Name]
+	if (len(t.Annotations) > 0 || pinned) && ns.Annotations == nil {
+		ns.Annotations = map[string]string{}
+	}
+	for k, v := range t.Annotations {
+		ns.Annotations[k] = v
+	}
+	if pinned {
+		ns.Annotations[KeyUid] = r
+		ns.Annotations[KeyFsGroup] = r
+	}
+}
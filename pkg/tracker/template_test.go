@@ -0,0 +1,159 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tracker
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	core "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestLoadNamespaceTemplate(t *testing.T) {
+	cases := []struct {
+		name    string
+		data    string
+		want    *NamespaceTemplate
+		wantErr bool
+	}{
+		{
+			name: "empty",
+			want: &NamespaceTemplate{Labels: map[string]string{LabelManagedBy: ManagedBy}},
+		},
+		{
+			name: "labels, annotations and ranges",
+			data: `labels:
+  pod-security.kubernetes.io/enforce: restricted
+annotations:
+  openshift.io/node-selector: ""
+ranges:
+  kubeops: 1000680000/10000
+  kubedb: 1000690000-1000699999
+`,
+			want: &NamespaceTemplate{
+				Labels: map[string]string{
+					"pod-security.kubernetes.io/enforce": "restricted",
+					LabelManagedBy:                       ManagedBy,
+				},
+				Annotations: map[string]string{"openshift.io/node-selector": ""},
+				Ranges: map[string]string{
+					"kubeops": "1000680000/10000",
+					"kubedb":  "1000690000/10000",
+				},
+			},
+		},
+		{
+			name: "managed-by set by the user",
+			data: "labels:\n  " + LabelManagedBy + ": installer\n",
+			want: &NamespaceTemplate{Labels: map[string]string{LabelManagedBy: "installer"}},
+		},
+		{
+			name:    "several ranges",
+			data:    "ranges:\n  kubeops: 1000680000/10000,1000700000/10000\n",
+			wantErr: true,
+		},
+		{
+			name:    "unknown field",
+			data:    "label:\n  a: b\n",
+			wantErr: true,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			filename := filepath.Join(t.TempDir(), "template.yaml")
+			if err := os.WriteFile(filename, []byte(c.data), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			got, err := LoadNamespaceTemplate(filename)
+			if (err != nil) != c.wantErr {
+				t.Fatalf("expected error %v, got %v", c.wantErr, err)
+			}
+			if !c.wantErr && !reflect.DeepEqual(got, c.want) {
+				t.Errorf("expected %+v, got %+v", c.want, got)
+			}
+		})
+	}
+}
+
+func TestNamespaceTemplateApply(t *testing.T) {
+	tmpl := &NamespaceTemplate{
+		Labels:      map[string]string{LabelManagedBy: ManagedBy, "pod-security.kubernetes.io/enforce": "restricted"},
+		Annotations: map[string]string{"openshift.io/node-selector": ""},
+		Ranges:      map[string]string{"kubeops": "1000680000/10000"},
+	}
+	cases := []struct {
+		name string
+		tmpl *NamespaceTemplate
+		ns   string
+		want core.Namespace
+	}{
+		{
+			name: "default template",
+			tmpl: DefaultNamespaceTemplate(),
+			ns:   "kubeops",
+			want: core.Namespace{ObjectMeta: metav1.ObjectMeta{
+				Name:   "kubeops",
+				Labels: map[string]string{LabelManagedBy: ManagedBy},
+			}},
+		},
+		{
+			name: "pinned range",
+			tmpl: tmpl,
+			ns:   "kubeops",
+			want: core.Namespace{ObjectMeta: metav1.ObjectMeta{
+				Name:   "kubeops",
+				Labels: map[string]string{LabelManagedBy: ManagedBy, "pod-security.kubernetes.io/enforce": "restricted"},
+				Annotations: map[string]string{
+					"openshift.io/node-selector": "",
+					KeyUid:                       "1000680000/10000",
+					KeyFsGroup:                   "1000680000/10000",
+				},
+			}},
+		},
+		{
+			name: "namespace without range",
+			tmpl: tmpl,
+			ns:   "kubedb",
+			want: core.Namespace{ObjectMeta: metav1.ObjectMeta{
+				Name:        "kubedb",
+				Labels:      map[string]string{LabelManagedBy: ManagedBy, "pod-security.kubernetes.io/enforce": "restricted"},
+				Annotations: map[string]string{"openshift.io/node-selector": ""},
+			}},
+		},
+		{
+			name: "ranges only",
+			tmpl: &NamespaceTemplate{Ranges: map[string]string{"kubeops": "1000680000/10000"}},
+			ns:   "kubeops",
+			want: core.Namespace{ObjectMeta: metav1.ObjectMeta{
+				Name:        "kubeops",
+				Annotations: map[string]string{KeyUid: "1000680000/10000", KeyFsGroup: "1000680000/10000"},
+			}},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			ns := core.Namespace{ObjectMeta: metav1.ObjectMeta{Name: c.ns}}
+			c.tmpl.Apply(&ns)
+			if !reflect.DeepEqual(ns, c.want) {
+				t.Errorf("expected %+v, got %+v", c.want.ObjectMeta, ns.ObjectMeta)
+			}
+		})
+	}
+}
@@ -0,0 +1,232 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tracker
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// ClusterAPIServerName is the cluster-wide API server config of OpenShift, whose TLS
+// security profile all platform components follow.
+const ClusterAPIServerName = "cluster"
+
+// DefaultIngressControllerName is the IngressController of the default OpenShift
+// router, in IngressControllerNamespace.
+const (
+	DefaultIngressControllerName = "default"
+	IngressControllerNamespace   = "openshift-ingress-operator"
+)
+
+var (
+	APIServerGVK         = schema.GroupVersionKind{Group: "config.openshift.io", Version: "v1", Kind: "APIServer"}
+	IngressControllerGVK = schema.GroupVersionKind{Group: "operator.openshift.io", Version: "v1", Kind: "IngressController"}
+)
+
+// TLSProfile is an OpenShift TLS security profile. Ciphers use the OpenSSL names and
+// MinTLSVersion the VersionTLS1x names of the config API.
+type TLSProfile struct {
+	Type          string   `json:"type"`
+	MinTLSVersion string   `json:"minTLSVersion"`
+	Ciphers       []string `json:"ciphers"`
+}
+
+// tlsProfiles are the predefined profiles of the OpenShift config API.
+var tlsProfiles = map[string]TLSProfile{
+	"Old": {
+		MinTLSVersion: "VersionTLS10",
+		Ciphers: []string{
+			"TLS_AES_128_GCM_SHA256",
+			"TLS_AES_256_GCM_SHA384",
+			"TLS_CHACHA20_POLY1305_SHA256",
+			"ECDHE-ECDSA-AES128-GCM-SHA256",
+			"ECDHE-RSA-AES128-GCM-SHA256",
+			"ECDHE-ECDSA-AES256-GCM-SHA384",
+			"ECDHE-RSA-AES256-GCM-SHA384",
+			"ECDHE-ECDSA-CHACHA20-POLY1305",
+			"ECDHE-RSA-CHACHA20-POLY1305",
+			"DHE-RSA-AES128-GCM-SHA256",
+			"DHE-RSA-AES256-GCM-SHA384",
+			"DHE-RSA-CHACHA20-POLY1305",
+			"ECDHE-ECDSA-AES128-SHA256",
+			"ECDHE-RSA-AES128-SHA256",
+			"ECDHE-ECDSA-AES128-SHA",
+			"ECDHE-RSA-AES128-SHA",
+			"ECDHE-ECDSA-AES256-SHA384",
+			"ECDHE-RSA-AES256-SHA384",
+			"ECDHE-ECDSA-AES256-SHA",
+			"ECDHE-RSA-AES256-SHA",
+			"DHE-RSA-AES128-SHA256",
+			"DHE-RSA-AES256-SHA256",
+			"AES128-GCM-SHA256",
+			"AES256-GCM-SHA384",
+			"AES128-SHA256",
+			"AES256-SHA256",
+			"AES128-SHA",
+			"AES256-SHA",
+			"DES-CBC3-SHA",
+		},
+	},
+	"Intermediate": {
+		MinTLSVersion: "VersionTLS12",
+		Ciphers: []string{
+			"TLS_AES_128_GCM_SHA256",
+			"TLS_AES_256_GCM_SHA384",
+			"TLS_CHACHA20_POLY1305_SHA256",
+			"ECDHE-ECDSA-AES128-GCM-SHA256",
+			"ECDHE-RSA-AES128-GCM-SHA256",
+			"ECDHE-ECDSA-AES256-GCM-SHA384",
+			"ECDHE-RSA-AES256-GCM-SHA384",
+			"ECDHE-ECDSA-CHACHA20-POLY1305",
+			"ECDHE-RSA-CHACHA20-POLY1305",
+			"DHE-RSA-AES128-GCM-SHA256",
+			"DHE-RSA-AES256-GCM-SHA384",
+		},
+	},
+	"Modern": {
+		MinTLSVersion: "VersionTLS13",
+		Ciphers: []string{
+			"TLS_AES_128_GCM_SHA256",
+			"TLS_AES_256_GCM_SHA384",
+			"TLS_CHACHA20_POLY1305_SHA256",
+		},
+	},
+}
+
+// opensslToIANA maps the OpenSSL cipher names to the IANA names used by Go. TLS 1.3
+// ciphers keep their name and DHE ciphers are not supported by Go.
+var opensslToIANA = map[string]string{
+	"ECDHE-ECDSA-AES128-GCM-SHA256": "TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256",
+	"ECDHE-RSA-AES128-GCM-SHA256":   "TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256",
+	"ECDHE-ECDSA-AES256-GCM-SHA384": "TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384",
+	"ECDHE-RSA-AES256-GCM-SHA384":   "TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384",
+	"ECDHE-ECDSA-CHACHA20-POLY1305": "TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256",
+	"ECDHE-RSA-CHACHA20-POLY1305":   "TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256",
+	"ECDHE-ECDSA-AES128-SHA256":     "TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA256",
+	"ECDHE-RSA-AES128-SHA256":       "TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA256",
+	"ECDHE-ECDSA-AES128-SHA":        "TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA",
+	"ECDHE-RSA-AES128-SHA":          "TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA",
+	"ECDHE-ECDSA-AES256-SHA":        "TLS_ECDHE_ECDSA_WITH_AES_256_CBC_SHA",
+	"ECDHE-RSA-AES256-SHA":          "TLS_ECDHE_RSA_WITH_AES_256_CBC_SHA",
+	"AES128-GCM-SHA256":             "TLS_RSA_WITH_AES_128_GCM_SHA256",
+	"AES256-GCM-SHA384":             "TLS_RSA_WITH_AES_256_GCM_SHA384",
+	"AES128-SHA256":                 "TLS_RSA_WITH_AES_128_CBC_SHA256",
+	"AES128-SHA":                    "TLS_RSA_WITH_AES_128_CBC_SHA",
+	"AES256-SHA":                    "TLS_RSA_WITH_AES_256_CBC_SHA",
+	"DES-CBC3-SHA":                  "TLS_RSA_WITH_3DES_EDE_CBC_SHA",
+}
+
+var tlsVersions = map[string]uint16{
+	"VersionTLS10": tls.VersionTLS10,
+	"VersionTLS11": tls.VersionTLS11,
+	"VersionTLS12": tls.VersionTLS12,
+	"VersionTLS13": tls.VersionTLS13,
+}
+
+// GetTLSProfile reads the TLS security profile of the cluster API server. A cluster
+// without a profile uses the Intermediate one. It returns nil on clusters without
+// the OpenShift config API.
+func GetTLSProfile(ctx context.Context, kc client.Reader) (*TLSProfile, error) {
+	var u unstructured.Unstructured
+	u.SetGroupVersionKind(APIServerGVK)
+	if err := kc.Get(ctx, client.ObjectKey{Name: ClusterAPIServerName}, &u); err != nil {
+		if meta.IsNoMatchError(err) {
+			return nil, nil
+		}
+		return nil, client.IgnoreNotFound(err)
+	}
+	spec, _, _ := unstructured.NestedMap(u.Object, "spec", "tlsSecurityProfile")
+	return ParseTLSProfile(spec)
+}
+
+// GetIngressTLSProfile reads the TLS security profile of the default OpenShift
+// IngressController, which the router serves to clients. An IngressController
+// without a profile follows the one of the cluster API server. It returns nil on
+// clusters without the OpenShift operator API.
+func GetIngressTLSProfile(ctx context.Context, kc client.Reader) (*TLSProfile, error) {
+	var u unstructured.Unstructured
+	u.SetGroupVersionKind(IngressControllerGVK)
+	err := kc.Get(ctx, client.ObjectKey{Namespace: IngressControllerNamespace, Name: DefaultIngressControllerName}, &u)
+	if meta.IsNoMatchError(err) {
+		return nil, nil
+	} else if client.IgnoreNotFound(err) != nil {
+		return nil, err
+	}
+	spec, ok, _ := unstructured.NestedMap(u.Object, "spec", "tlsSecurityProfile")
+	if !ok || spec["type"] == nil || spec["type"] == "" {
+		return GetTLSProfile(ctx, kc)
+	}
+	return ParseTLSProfile(spec)
+}
+
+// ParseTLSProfile parses a tlsSecurityProfile of the OpenShift config API. An empty
+// profile is the Intermediate one.
+func ParseTLSProfile(spec map[string]any) (*TLSProfile, error) {
+	profileType, _, _ := unstructured.NestedString(spec, "type")
+	if profileType == "" {
+		profileType = "Intermediate"
+	}
+	if profileType == "Custom" {
+		p := TLSProfile{Type: profileType}
+		p.MinTLSVersion, _, _ = unstructured.NestedString(spec, "custom", "minTLSVersion")
+		p.Ciphers, _, _ = unstructured.NestedStringSlice(spec, "custom", "ciphers")
+		if _, ok := tlsVersions[p.MinTLSVersion]; !ok {
+			return nil, fmt.Errorf("unknown minTLSVersion %q in the custom TLS security profile", p.MinTLSVersion)
+		}
+		return &p, nil
+	}
+	p, ok := tlsProfiles[profileType]
+	if !ok {
+		return nil, fmt.Errorf("unknown TLS security profile type %q", profileType)
+	}
+	p.Type = profileType
+	return &p, nil
+}
+
+// IANACipherSuites returns the ciphers of the profile that Go servers can use, by
+// their IANA names. TLS 1.3 ciphers are not configurable in Go and are left out.
+func (p *TLSProfile) IANACipherSuites() []string {
+	var out []string
+	for _, c := range p.Ciphers {
+		if name, ok := opensslToIANA[c]; ok {
+			out = append(out, name)
+		}
+	}
+	return out
+}
+
+// Apply configures a Go TLS server with the minimum version and ciphers of the profile.
+func (p *TLSProfile) Apply(c *tls.Config) {
+	c.MinVersion = tlsVersions[p.MinTLSVersion]
+
+	ids := map[string]uint16{}
+	for _, s := range append(tls.CipherSuites(), tls.InsecureCipherSuites()...) {
+		ids[s.Name] = s.ID
+	}
+	c.CipherSuites = nil
+	for _, name := range p.IANACipherSuites() {
+		if id, ok := ids[name]; ok {
+			c.CipherSuites = append(c.CipherSuites, id)
+		}
+	}
+}
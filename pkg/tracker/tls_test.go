@@ -0,0 +1,173 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the AppsCode Community License 1.0.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://github.com/appscode/licenses/raw/1.0.0/AppsCode-Community-1.0.0.md
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tracker
+
+import (
+	"context"
+	"crypto/tls"
+	"reflect"
+	"testing"
+
+	kerr "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func TestParseTLSProfile(t *testing.T) {
+	cases := []struct {
+		name    string
+		spec    map[string]any
+		want    *TLSProfile
+		wantErr bool
+	}{
+		{
+			name: "unset",
+			want: &TLSProfile{Type: "Intermediate", MinTLSVersion: "VersionTLS12", Ciphers: tlsProfiles["Intermediate"].Ciphers},
+		},
+		{
+			name: "modern",
+			spec: map[string]any{"type": "Modern", "modern": map[string]any{}},
+			want: &TLSProfile{Type: "Modern", MinTLSVersion: "VersionTLS13", Ciphers: tlsProfiles["Modern"].Ciphers},
+		},
+		{
+			name: "custom",
+			spec: map[string]any{"type": "Custom", "custom": map[string]any{
+				"minTLSVersion": "VersionTLS11",
+				"ciphers":       []any{"ECDHE-RSA-AES128-GCM-SHA256", "DHE-RSA-AES128-GCM-SHA256"},
+			}},
+			want: &TLSProfile{Type: "Custom", MinTLSVersion: "VersionTLS11", Ciphers: []string{"ECDHE-RSA-AES128-GCM-SHA256", "DHE-RSA-AES128-GCM-SHA256"}},
+		},
+		{
+			name:    "custom without a version",
+			spec:    map[string]any{"type": "Custom", "custom": map[string]any{"ciphers": []any{"AES128-SHA"}}},
+			wantErr: true,
+		},
+		{
+			name:    "unknown type",
+			spec:    map[string]any{"type": "Ancient"},
+			wantErr: true,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got, err := ParseTLSProfile(c.spec)
+			if c.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got %+v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, c.want) {
+				t.Errorf("expected %+v, got %+v", c.want, got)
+			}
+		})
+	}
+}
+
+func TestTLSProfileApply(t *testing.T) {
+	p := &TLSProfile{
+		MinTLSVersion: "VersionTLS12",
+		Ciphers:       []string{"TLS_AES_128_GCM_SHA256", "ECDHE-RSA-AES128-GCM-SHA256", "DHE-RSA-AES128-GCM-SHA256", "AES128-SHA"},
+	}
+	expected := []string{"TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256", "TLS_RSA_WITH_AES_128_CBC_SHA"}
+	if got := p.IANACipherSuites(); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+
+	c := &tls.Config{CipherSuites: []uint16{tls.TLS_RSA_WITH_3DES_EDE_CBC_SHA}}
+	p.Apply(c)
+	if c.MinVersion != tls.VersionTLS12 {
+		t.Errorf("expected min version %x, got %x", tls.VersionTLS12, c.MinVersion)
+	}
+	if ids := []uint16{tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256, tls.TLS_RSA_WITH_AES_128_CBC_SHA}; !reflect.DeepEqual(c.CipherSuites, ids) {
+		t.Errorf("expected cipher suites %v, got %v", ids, c.CipherSuites)
+	}
+}
+
+func TestGetIngressTLSProfile(t *testing.T) {
+	apiServer := map[string]any{"spec": map[string]any{"tlsSecurityProfile": map[string]any{"type": "Old", "old": map[string]any{}}}}
+	cases := []struct {
+		name    string
+		objects map[schema.GroupVersionKind]map[string]any
+		want    string
+	}{
+		{
+			name:    "no OpenShift",
+			objects: nil,
+		},
+		{
+			name: "own profile",
+			objects: map[schema.GroupVersionKind]map[string]any{
+				APIServerGVK:         apiServer,
+				IngressControllerGVK: {"spec": map[string]any{"tlsSecurityProfile": map[string]any{"type": "Modern"}}},
+			},
+			want: "Modern",
+		},
+		{
+			name: "follows the API server",
+			objects: map[schema.GroupVersionKind]map[string]any{
+				APIServerGVK:         apiServer,
+				IngressControllerGVK: {"spec": map[string]any{}},
+			},
+			want: "Old",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			p, err := GetIngressTLSProfile(context.TODO(), fakeReader(c.objects))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if c.want == "" {
+				if p != nil {
+					t.Errorf("expected no profile, got %+v", p)
+				}
+				return
+			}
+			if p == nil || p.Type != c.want {
+				t.Errorf("expected the %s profile, got %+v", c.want, p)
+			}
+		})
+	}
+}
+
+// fakeReader serves one object per kind. A nil reader has no OpenShift APIs.
+type fakeReader map[schema.GroupVersionKind]map[string]any
+
+func (r fakeReader) Get(_ context.Context, key client.ObjectKey, obj client.Object, _ ...client.GetOption) error {
+	u := obj.(*unstructured.Unstructured)
+	gvk := u.GroupVersionKind()
+	if r == nil {
+		return &meta.NoKindMatchError{GroupKind: gvk.GroupKind(), SearchedVersions: []string{gvk.Version}}
+	}
+	o, ok := r[gvk]
+	if !ok {
+		return kerr.NewNotFound(schema.GroupResource{Group: gvk.Group, Resource: gvk.Kind}, key.Name)
+	}
+	u.Object = o
+	u.SetGroupVersionKind(gvk)
+	return nil
+}
+
+func (r fakeReader) List(context.Context, client.ObjectList, ...client.ListOption) error {
+	return nil
+}
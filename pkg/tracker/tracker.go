@@ -32,6 +32,13 @@ const (
 	KeyFsGroup            = "openshift.io/sa.scc.supplemental-groups"
 	UidRange              = 10000
 	UidNone               = -1
+
+	// OverlayName is the ConfigMap that holds the rendered overlay of each HelmRelease.
+	OverlayName      = "ace-openshift-scc"
+	OverlayNamespace = "kubeops"
+	// KeyRenderedUidPrefix prefixes the overlay ConfigMap annotations that record
+	// the namespace uid range start last rendered for each HelmRelease.
+	KeyRenderedUidPrefix = "uid.aceshifter.appscode.com/"
 )
 
 func GetUid(kc client.Reader, ns string) (int64, int64, error) {
@@ -40,9 +47,14 @@ func GetUid(kc client.Reader, ns string) (int64, int64, error) {
 	if err != nil {
 		return UidNone, UidNone, client.IgnoreNotFound(err)
 	}
+	return NamespaceUid(&obj)
+}
 
-	curUid, foundUid := obj.Annotations[KeyUid]
-	curFsGroupUid, foundFsGroup := obj.Annotations[KeyFsGroup]
+// NamespaceUid returns the start and size of the uid range of a namespace, or
+// UidNone if it has no range annotations.
+func NamespaceUid(ns *core.Namespace) (int64, int64, error) {
+	curUid, foundUid := ns.Annotations[KeyUid]
+	curFsGroupUid, foundFsGroup := ns.Annotations[KeyFsGroup]
 	if !foundUid && !foundFsGroup {
 		return UidNone, UidNone, nil
 	}
@@ -65,3 +77,102 @@ func GetUid(kc client.Reader, ns string) (int64, int64, error) {
 	}
 	return uid, uidRange, nil
 }
+
+// Range is a block of ids in the <start>/<size> form used by the OpenShift namespace annotations.
+type Range struct {
+	Start int64
+	Size  int64
+}
+
+func (r Range) Contains(id int64) bool {
+	return id >= r.Start && id < r.Start+r.Size
+}
+
+func (r Range) Overlaps(o Range) bool {
+	return r.Start < o.Start+o.Size && o.Start < r.Start+r.Size
+}
+
+func (r Range) String() string {
+	return fmt.Sprintf("%d/%d", r.Start, r.Size)
+}
+
+// ParseRanges parses a comma separated list of ranges in <start>/<size> or <start>-<end> format.
+func ParseRanges(s string) ([]Range, error) {
+	var ranges []Range
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		if strStart, strSize, ok := strings.Cut(part, "/"); ok {
+			start, err1 := strconv.ParseInt(strStart, 10, 64)
+			size, err2 := strconv.ParseInt(strSize, 10, 64)
+			if err1 != nil || err2 != nil || size <= 0 {
+				return nil, fmt.Errorf("range %q is not in <start>/<size> format", part)
+			}
+			ranges = append(ranges, Range{Start: start, Size: size})
+		} else if strStart, strEnd, ok := strings.Cut(part, "-"); ok {
+			start, err1 := strconv.ParseInt(strStart, 10, 64)
+			end, err2 := strconv.ParseInt(strEnd, 10, 64)
+			if err1 != nil || err2 != nil || end < start {
+				return nil, fmt.Errorf("range %q is not in <start>-<end> format", part)
+			}
+			ranges = append(ranges, Range{Start: start, Size: end - start + 1})
+		} else {
+			return nil, fmt.Errorf("range %q is not in <start>/<size> or <start>-<end> format", part)
+		}
+	}
+	return ranges, nil
+}
+
+// Ranges are the ids a namespace allows for users and for groups.
+type Ranges struct {
+	Uid    []Range
+	Groups []Range
+}
+
+func contains(ranges []Range, id int64) bool {
+	for _, r := range ranges {
+		if r.Contains(id) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r Ranges) ContainsUid(id int64) bool {
+	return contains(r.Uid, id)
+}
+
+func (r Ranges) ContainsGroup(id int64) bool {
+	return contains(r.Groups, id)
+}
+
+// GetRanges returns the uid and supplemental group ranges of a namespace.
+// It returns nil if the namespace does not exist or has no range annotations.
+func GetRanges(kc client.Reader, ns string) (*Ranges, error) {
+	var obj core.Namespace
+	err := kc.Get(context.TODO(), client.ObjectKey{Name: ns}, &obj)
+	if err != nil {
+		return nil, client.IgnoreNotFound(err)
+	}
+	return NamespaceRanges(&obj)
+}
+
+func NamespaceRanges(ns *core.Namespace) (*Ranges, error) {
+	curUid, foundUid := ns.Annotations[KeyUid]
+	curFsGroupUid, foundFsGroup := ns.Annotations[KeyFsGroup]
+	if !foundUid && !foundFsGroup {
+		return nil, nil
+	}
+
+	var ranges Ranges
+	var err error
+	if ranges.Uid, err = ParseRanges(curUid); err != nil {
+		return nil, fmt.Errorf("%s annotation: %w", KeyUid, err)
+	}
+	if ranges.Groups, err = ParseRanges(curFsGroupUid); err != nil {
+		return nil, fmt.Errorf("%s annotation: %w", KeyFsGroup, err)
+	}
+	return &ranges, nil
+}